@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/export"
+)
+
+// backupCommand writes a backup to the given file, or without one a snapshot into BACKUP_DIR that counts towards
+// its retention rules.
+func backupCommand(cfg *config.Config, args []string) error {
+	if len(args) > 1 {
+		return errors.New("expected backup [<file>]")
+	}
+	if len(args) == 0 && cfg.Backup.Dir == "" {
+		return errors.New("expected backup <file>, or BACKUP_DIR to be set")
+	}
+
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if len(args) == 1 {
+		if err := database.Backup(ctx, db, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Backed up the database to %s.\n", args[0])
+		return nil
+	}
+
+	now := time.Now()
+	path, err := database.Snapshot(ctx, db, cfg.Backup.Dir, now)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up the database to %s.\n", path)
+	deleted, err := database.PruneSnapshots(cfg.Backup.Dir, cfg.Backup.Keep, cfg.Backup.MaxAge, now)
+	for _, path := range deleted {
+		fmt.Printf("Deleted old backup %s.\n", path)
+	}
+	return err
+}
+
+// restoreCommand swaps a backup in for the database after checking it. It does not open the database the usual
+// way, as that would keep it in use and could migrate it before the swap.
+func restoreCommand(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "replace the database without asking")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("expected restore [--yes] <file>")
+	}
+	backupPath := flags.Arg(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	version, err := database.CheckBackup(ctx, backupPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s passed the integrity check at schema version %d.\n", backupPath, version)
+
+	if !*yes {
+		fmt.Printf("Replace %s with it? The current database is kept next to it. [y/N] ", cfg.DBPath)
+		var answer string
+		fmt.Scanln(&answer)
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return errors.New("restore cancelled")
+		}
+	}
+
+	previous, err := database.Restore(ctx, backupPath, cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		fmt.Printf("Moved the previous database to %s.\n", previous)
+	}
+	fmt.Printf("Restored %s from %s.\n", cfg.DBPath, backupPath)
+
+	if latest, err := database.LatestVersion(); err == nil && version < latest {
+		fmt.Println("The backup predates the latest migrations. serve applies them on start, or run the migrate command.")
+	}
+	return nil
+}
+
+// exportCommand writes a user's phrases in one of the export formats. Like the export endpoint it leaves out the trash.
+func exportCommand(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	userRef := flags.String("user", "", "user ID, username or email to export")
+	format := flags.String("format", export.FormatJSON, "export format")
+	outPath := flags.String("out", "", "file to write, standard output by default")
+	flags.Parse(args)
+	if *userRef == "" {
+		return errors.New("--user is required")
+	}
+	if !slices.Contains(export.ValidFormats, *format) {
+		return fmt.Errorf("unknown format %q, expected one of %v", *format, export.ValidFormats)
+	}
+
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	user, err := findUser(ctx, db, *userRef)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.OpenFile(*outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	writer, err := export.NewWriter(*format, out)
+	if err != nil {
+		return err
+	}
+	phraseModel := database.PhraseModel{DB: db}
+	if err := phraseModel.Each(ctx, user.ID, database.ExcludeTrashed, writer.Write); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if f, ok := out.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
@@ -4,13 +4,11 @@ go 1.23.5
 
 require (
 	github.com/davecgh/go-spew v1.1.1
+	github.com/go-chi/chi/v5 v5.2.1
 	github.com/gorilla/sessions v1.4.0
 	github.com/joho/godotenv v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.24
 	golang.org/x/oauth2 v0.27.0
 )
 
-require (
-	github.com/go-chi/chi/v5 v5.2.1 // indirect
-	github.com/gorilla/securecookie v1.1.2 // indirect
-)
+require github.com/gorilla/securecookie v1.1.2 // indirect
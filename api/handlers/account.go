@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/export"
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+// ExportData streams a zip of everything held about the user: profile, providers, sessions and phrases,
+// including those in the trash. Provider tokens are left out. Like Export, it runs outside the request timeout.
+func (h *UserHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	// The small tables are read up front, so a failure can still be reported as an error response.
+	readCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	userModel := database.UserModel{DB: h.DB}
+	user, err := userModel.ByID(readCtx, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	providerModel := database.ProviderModel{DB: h.DB}
+	providers, err := providerModel.ByUserID(readCtx, userSession.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	sessionModel := database.SessionModel{DB: h.DB}
+	sessions, err := sessionModel.ByUserIDWithProvider(readCtx, userSession.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if providers == nil {
+		providers = []models.OauthProvider{}
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == userSession.ID
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="vocab-thing-data-%s.zip"`, time.Now().UTC().Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", user},
+		{"providers.json", providers},
+		{"sessions.json", sessions},
+	}
+	for _, file := range files {
+		if err := writeZipJSON(archive, file.name, file.data); err != nil {
+			// The status line is already sent, so a failed export can only be cut short.
+			log.Printf("error writing %s of data export for user %s: %s", file.name, userSession.UserID, err.Error())
+			return
+		}
+	}
+
+	phrasesFile, err := archive.Create("phrases.json")
+	if err != nil {
+		log.Printf("error writing phrases.json of data export for user %s: %s", userSession.UserID, err.Error())
+		return
+	}
+	writer, err := export.NewWriter(export.FormatJSON, phrasesFile)
+	if err != nil {
+		log.Printf("error starting phrases.json of data export for user %s: %s", userSession.UserID, err.Error())
+		return
+	}
+	phraseModel := database.PhraseModel{DB: h.DB}
+	err = phraseModel.Each(ctx, userSession.UserID, database.IncludeTrashed, writer.Write)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		log.Printf("error streaming data export for user %s: %s", userSession.UserID, err.Error())
+	}
+}
+
+func writeZipJSON(archive *zip.Writer, name string, data any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// DeleteAccount deletes the user and everything they own. It is routed behind RequireRecentAuth, so a
+// stolen cookie alone cannot delete an account.
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	userModel := database.UserModel{DB: h.DB}
+	if err := userModel.Delete(ctx, userSession.UserID); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.Cookie.Delete(w)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,30 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeleteAccountRecentAuth(t *testing.T) {
+	s := newTestServer(t)
+	email := "leaving@example.com"
+	old := s.signIn(email)
+
+	hourAgo := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if _, err := s.db.Exec(`UPDATE sessions SET createdAt = ? WHERE userId = ?`, hourAgo, s.userID(email)); err != nil {
+		t.Fatalf("Failed to age session: %v", err)
+	}
+	if w := s.do(http.MethodDelete, "/user", "", old); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected an old session to need a recent sign in, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Signing in again on the same device must count as a recent sign in.
+	session := s.signIn(email)
+	if w := s.do(http.MethodGet, "/user/sessions", "", old); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the replaced session to be revoked, got %d", w.Code)
+	}
+	if w := s.do(http.MethodDelete, "/user", "", session); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the account to be deleted after signing in again, got %d %s", w.Code, w.Body.String())
+	}
+}
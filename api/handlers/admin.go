@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/httpmiddleware"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminHandler struct {
+	*Handler
+}
+
+type expireSessionsResponse struct {
+	Expired int64 `json:"expired"`
+}
+
+type jobsResponse struct {
+	Jobs []models.JobRun `json:"jobs"`
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	pagination, ok := httpmiddleware.PaginationFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoPaginationData, http.StatusInternalServerError)
+		return
+	}
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
+
+	userModel := database.UserModel{DB: h.DB}
+	page, err := userModel.List(ctx, pagination.Page, pagination.PageSize, search)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "id"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userModel := database.UserModel{DB: h.DB}
+	detail, err := userModel.Detail(ctx, userID)
+	if err != nil {
+		if errors.Is(err, errorcode.ErrUserNotFound) {
+			errorcode.WriteJSONError(w, err, http.StatusNotFound)
+			return
+		}
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// DisableUser stops a user from signing in or using their tokens, and expires their sessions.
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "id"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+	// An admin disabling themselves could leave nobody able to undo it.
+	if disabled && userID == userSession.UserID {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"id": "cannot disable yourself"}), http.StatusBadRequest)
+		return
+	}
+
+	userModel := database.UserModel{DB: h.DB}
+	if err := userModel.SetDisabled(ctx, userID, disabled); err != nil {
+		if errors.Is(err, errorcode.ErrUserNotFound) {
+			errorcode.WriteJSONError(w, err, http.StatusNotFound)
+			return
+		}
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if disabled {
+		// Disabled users are already refused on every request; expiring the sessions also clears them from their devices.
+		sessionModel := database.SessionModel{DB: h.DB}
+		if _, err := sessionModel.ExpireByUserID(ctx, userID); err != nil {
+			errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExpireSessions signs the user out of every device without disabling them.
+func (h *AdminHandler) ExpireSessions(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "id"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userModel := database.UserModel{DB: h.DB}
+	if _, err := userModel.Detail(ctx, userID); err != nil {
+		if errors.Is(err, errorcode.ErrUserNotFound) {
+			errorcode.WriteJSONError(w, err, http.StatusNotFound)
+			return
+		}
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	sessionModel := database.SessionModel{DB: h.DB}
+	expired, err := sessionModel.ExpireByUserID(ctx, userID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expireSessionsResponse{Expired: expired})
+}
+
+// ListJobs returns the state of the background jobs, as recorded by every server running against the database.
+func (h *AdminHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	jobModel := database.JobModel{DB: h.DB}
+	jobs, err := jobModel.All(ctx, time.Now())
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jobsResponse{Jobs: jobs})
+}
@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+// signInAdmin signs in and promotes the user to admin.
+func (s *testServer) signInAdmin(email string) *http.Cookie {
+	s.t.Helper()
+	session := s.signIn(email)
+	if _, err := s.db.Exec(`UPDATE users SET role = 'admin' WHERE email = ?`, email); err != nil {
+		s.t.Fatalf("Failed to promote user: %v", err)
+	}
+	return session
+}
+
+func TestRequireAdmin(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signInAdmin("admin@example.com")
+	user := s.signIn("user@example.com")
+
+	tests := []struct {
+		name    string
+		session *http.Cookie
+		want    int
+	}{
+		{"Not Admin", user, http.StatusForbidden},
+		{"Admin", admin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodGet, "/admin/users", "", tt.session)
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("Demoted", func(t *testing.T) {
+		if _, err := s.db.Exec(`UPDATE users SET role = 'user' WHERE email = ?`, "admin@example.com"); err != nil {
+			t.Fatalf("Failed to demote user: %v", err)
+		}
+		if w := s.do(http.MethodGet, "/admin/users", "", admin); w.Code != http.StatusForbidden {
+			t.Errorf("Expected a demoted admin to be refused at once, got %d", w.Code)
+		}
+	})
+}
+
+func TestAdminUsers(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signInAdmin("admin@example.com")
+	user := s.signIn("user@example.com")
+	userID := s.userID("user@example.com")
+
+	t.Run("List", func(t *testing.T) {
+		w := s.do(http.MethodGet, "/admin/users?search=user@", "", admin)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to list users: %d %s", w.Code, w.Body.String())
+		}
+		var page models.UserPage
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode users: %v", err)
+		}
+		if page.TotalCount != 1 || len(page.Items) != 1 || page.Items[0].ID != userID {
+			t.Errorf("Expected only the searched user, got %+v", page)
+		}
+	})
+
+	t.Run("Disable Yourself", func(t *testing.T) {
+		w := s.do(http.MethodPost, "/admin/users/"+s.userID("admin@example.com")+"/disable", "", admin)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected an admin to be unable to disable themselves, got %d", w.Code)
+		}
+	})
+
+	t.Run("Disable Unknown User", func(t *testing.T) {
+		if w := s.do(http.MethodPost, "/admin/users/missing/disable", "", admin); w.Code != http.StatusNotFound {
+			t.Errorf("Expected %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		if w := s.do(http.MethodPost, "/admin/users/"+userID+"/disable", "", admin); w.Code != http.StatusNoContent {
+			t.Fatalf("Failed to disable user: %d %s", w.Code, w.Body.String())
+		}
+		if w := s.do(http.MethodGet, "/user/sessions", "", user); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the disabled user's session to be refused, got %d", w.Code)
+		}
+
+		if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"user@example.com"}`, nil); w.Code != http.StatusAccepted {
+			t.Fatalf("Failed to start email login: %d", w.Code)
+		}
+		w := s.do(http.MethodPost, "/auth/email/verify", `{"token":"`+s.mail.lastToken(t, "user@example.com")+`"}`, nil)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected a disabled user to be unable to sign in, got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Disabled Session", func(t *testing.T) {
+		// A disabled user is refused on every request, even with a session that was never expired.
+		other := s.signIn("other@example.com")
+		disabledAt := time.Now().UTC().Format(time.RFC3339)
+		if _, err := s.db.Exec(`UPDATE users SET disabledAt = ? WHERE email = ?`, disabledAt, "other@example.com"); err != nil {
+			t.Fatalf("Failed to disable user: %v", err)
+		}
+		if w := s.do(http.MethodGet, "/user/sessions", "", other); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the disabled user's session to be refused, got %d", w.Code)
+		}
+	})
+
+	t.Run("Enable", func(t *testing.T) {
+		if w := s.do(http.MethodPost, "/admin/users/"+userID+"/enable", "", admin); w.Code != http.StatusNoContent {
+			t.Fatalf("Failed to enable user: %d %s", w.Code, w.Body.String())
+		}
+		s.signIn("user@example.com")
+	})
+}
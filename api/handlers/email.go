@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+)
+
+type startEmailLoginRequest struct {
+	Email string `json:"email"`
+}
+
+// StartEmailLogin sends a login link to the address. The response is the same whether or not a user has it.
+func (h *UserHandler) StartEmailLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var data startEmailLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	provider := h.Providers.NewEmail(ctx, h.DB, h.Mailer)
+	if err := provider.SendLoginLink(data.Email); err != nil {
+		switch {
+		case errors.Is(err, errorcode.ErrInvalidEmail):
+			errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		case errors.Is(err, errorcode.ErrTooManyEmails):
+			errorcode.WriteJSONError(w, err, http.StatusTooManyRequests)
+		default:
+			errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type verifyEmailLoginRequest struct {
+	Token       string `json:"token"`
+	Fingerprint string `json:"fingerprint"`
+	IP          string `json:"ip"`
+}
+
+// VerifyEmailLogin redeems a login link and signs the user in the same way as an OAuth callback.
+func (h *UserHandler) VerifyEmailLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var data verifyEmailLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Token == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	provider := h.Providers.NewEmail(ctx, h.DB, h.Mailer)
+	user, p, err := provider.AuthenticateWithToken(data.Token)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	mfaRequired, err := h.signIn(ctx, w, r, *user, *p, data.Fingerprint, data.IP)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, signInErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, signInResponse{MFARequired: mfaRequired})
+}
@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("Issue", func(t *testing.T) {
+		if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"New@Example.com"}`, nil); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d %s", w.Code, w.Body.String())
+		}
+		msg := s.mail.sent[len(s.mail.sent)-1]
+		if msg.To != "new@example.com" || !strings.Contains(msg.Body, "http://localhost:3000/auth/email/callback?token=") {
+			t.Errorf("Expected a login link to the lowercased address, got %+v", msg)
+		}
+		var stored int
+		s.db.QueryRow(`SELECT COUNT(*) FROM email_login_tokens WHERE tokenHash = ?`, s.mail.lastToken(t, "new@example.com")).Scan(&stored)
+		if stored != 0 {
+			t.Error("Expected only the token's hash to be stored")
+		}
+	})
+
+	t.Run("Invalid Address", func(t *testing.T) {
+		for _, email := range []string{"", "not an address", "Bob <bob@example.com>"} {
+			if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"`+email+`"}`, nil); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for %q, got %d", email, w.Code)
+			}
+		}
+	})
+
+	t.Run("Redeem And Reuse", func(t *testing.T) {
+		token := s.mail.lastToken(t, "new@example.com")
+		w := s.do(http.MethodPost, "/auth/email/verify", `{"token":"`+token+`"}`, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+		}
+		session := sessionCookie(t, w)
+		if w := s.do(http.MethodGet, "/user/authenticated", "", session); w.Code != http.StatusOK {
+			t.Errorf("Expected the new session to work, got %d", w.Code)
+		}
+		s.userID("new@example.com")
+
+		if w := s.do(http.MethodPost, "/auth/email/verify", `{"token":"`+token+`"}`, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a used token to be refused with 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		s.do(http.MethodPost, "/auth/email/start", `{"email":"late@example.com"}`, nil)
+		_, err := s.db.Exec(`UPDATE email_login_tokens SET expiresAt = ? WHERE email = ?`,
+			time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), "late@example.com")
+		if err != nil {
+			t.Fatalf("Failed to expire token: %v", err)
+		}
+		w := s.do(http.MethodPost, "/auth/email/verify", `{"token":"`+s.mail.lastToken(t, "late@example.com")+`"}`, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected an expired token to be refused with 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("Rate Limit", func(t *testing.T) {
+		for i := range 5 {
+			if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"busy@example.com"}`, nil); w.Code != http.StatusAccepted {
+				t.Fatalf("Expected email %d to be sent, got %d", i+1, w.Code)
+			}
+		}
+		if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"busy@example.com"}`, nil); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected 429 after 5 emails, got %d", w.Code)
+		}
+		if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"quiet@example.com"}`, nil); w.Code != http.StatusAccepted {
+			t.Errorf("Expected other addresses to be unaffected, got %d", w.Code)
+		}
+	})
+}
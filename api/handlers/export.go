@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/export"
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+type ExportHandler struct {
+	*Handler
+}
+
+// flushEvery is how many phrases are written between flushes of the response.
+const flushEvery = 100
+
+// Export streams the user's whole library. It is registered outside the request timeout,
+// so it runs for as long as the client stays connected.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatJSON
+	}
+	if !slices.Contains(export.ValidFormats, format) {
+		errorcode.WriteJSONError(w, errorcode.ErrUnsupportedFormat.WithDetails(map[string][]string{"valid": export.ValidFormats}), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="vocab-thing-%s.%s"`, time.Now().UTC().Format("20060102"), export.Extension(format)))
+	w.WriteHeader(http.StatusOK)
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		log.Printf("error starting %s export for user %s: %s", format, userSession.UserID, err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	written := 0
+	phraseModel := database.PhraseModel{DB: h.DB}
+	err = phraseModel.Each(ctx, userSession.UserID, database.ExcludeTrashed, func(phrase models.TaggedPhrase) error {
+		if err := writer.Write(phrase); err != nil {
+			return err
+		}
+		written++
+		if written%flushEvery == 0 {
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// The status line is already sent, so a failed export can only be cut short.
+		log.Printf("error streaming %s export for user %s: %s", format, userSession.UserID, err.Error())
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("error finishing %s export for user %s: %s", format, userSession.UserID, err.Error())
+	}
+}
@@ -4,15 +4,30 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/mailer"
+	"github.com/arinji2/vocab-thing/internal/oauth"
 )
 
 type Handler struct {
-	DB *sql.DB
+	DB        *sql.DB
+	Config    *config.Config
+	Providers *oauth.Providers
+	Mailer    mailer.Mailer
+	Cookie    auth.SessionCookie
 }
 
 // NewHandler creates a new base Handler.
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{DB: db}
+func NewHandler(db *sql.DB, cfg *config.Config, providers *oauth.Providers, m mailer.Mailer) *Handler {
+	return &Handler{
+		DB:        db,
+		Config:    cfg,
+		Providers: providers,
+		Mailer:    m,
+		Cookie:    auth.SessionCookie{Secure: cfg.Production()},
+	}
 }
 
 func writeJSON(w http.ResponseWriter, statusCode int, data any) {
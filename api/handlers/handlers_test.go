@@ -0,0 +1,135 @@
+package handlers_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/mailer"
+	"github.com/arinji2/vocab-thing/internal/oauth"
+	"github.com/arinji2/vocab-thing/routes"
+)
+
+// recordingMailer keeps sent emails, so tests can follow login links.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var loginTokenPattern = regexp.MustCompile(`token=([\w-]+)`)
+
+// lastToken returns the token in the last login link sent to the address.
+func (m *recordingMailer) lastToken(t *testing.T, email string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != email {
+			continue
+		}
+		if match := loginTokenPattern.FindStringSubmatch(m.sent[i].Body); match != nil {
+			return match[1]
+		}
+	}
+	t.Fatalf("Expected a login link sent to %s", email)
+	return ""
+}
+
+type testServer struct {
+	t      *testing.T
+	db     *sql.DB
+	mail   *recordingMailer
+	routes http.Handler
+}
+
+// newTestServer serves the routes over a fresh, migrated database.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db, err := database.SetupDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.MigrateUp(context.Background(), db); err != nil {
+		if strings.Contains(err.Error(), "sqlite_fts5") {
+			t.Skip("Needs the sqlite_fts5 build tag")
+		}
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	cfg := &config.Config{
+		Environment:   config.EnvDevelopment,
+		FrontendURL:   "http://localhost:3000",
+		SessionSecret: "test-session-secret",
+	}
+	providers, err := oauth.NewProviders(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create providers: %v", err)
+	}
+	m := &recordingMailer{}
+	return &testServer{t: t, db: db, mail: m, routes: routes.RegisterRoutes(db, cfg, providers, m)}
+}
+
+// do sends a request with an optional JSON body and session cookie.
+func (s *testServer) do(method, path, body string, session *http.Cookie) *httptest.ResponseRecorder {
+	s.t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if session != nil {
+		r.AddCookie(session)
+	}
+	w := httptest.NewRecorder()
+	s.routes.ServeHTTP(w, r)
+	return w
+}
+
+// signIn signs in with an email login link and returns the session cookie.
+func (s *testServer) signIn(email string) *http.Cookie {
+	s.t.Helper()
+	if w := s.do(http.MethodPost, "/auth/email/start", `{"email":"`+email+`"}`, nil); w.Code != http.StatusAccepted {
+		s.t.Fatalf("Failed to start email login: %d %s", w.Code, w.Body.String())
+	}
+	w := s.do(http.MethodPost, "/auth/email/verify", `{"token":"`+s.mail.lastToken(s.t, email)+`"}`, nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("Failed to verify email login: %d %s", w.Code, w.Body.String())
+	}
+	return sessionCookie(s.t, w)
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" && c.Value != "" {
+			return c
+		}
+	}
+	t.Fatal("Expected a session cookie")
+	return nil
+}
+
+// userID returns the id of the user with the email.
+func (s *testServer) userID(email string) string {
+	s.t.Helper()
+	var id string
+	if err := s.db.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&id); err != nil {
+		s.t.Fatalf("Failed to find user %s: %v", email, err)
+	}
+	return id
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/importer"
+)
+
+type ImportHandler struct {
+	*Handler
+}
+
+// maxImportSize bounds uploads; a large Kindle vocab.db is a few megabytes.
+const maxImportSize = 50 << 20
+
+func (h *ImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "file"}), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Kindle databases have to be opened by SQLite from disk, so every upload is spooled to a temporary file.
+	tmp, err := os.CreateTemp("", "vocab-thing-import-*")
+	if err != nil {
+		log.Printf("error creating import file: %s", err.Error())
+		errorcode.WriteJSONError(w, errorcode.ErrImport, http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		log.Printf("error saving import file: %s", err.Error())
+		errorcode.WriteJSONError(w, errorcode.ErrImport, http.StatusInternalServerError)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		head := make([]byte, 512)
+		n, _ := tmp.ReadAt(head, 0)
+		format = importer.Detect(header.Filename, head[:n])
+	}
+	if !slices.Contains(importer.ValidFormats, format) {
+		errorcode.WriteJSONError(w, errorcode.ErrUnsupportedFormat, http.StatusBadRequest)
+		return
+	}
+
+	records, err := importer.ReadFile(ctx, format, tmp.Name())
+	if err != nil {
+		log.Printf("error reading %s import for user %s: %s", format, userSession.UserID, err.Error())
+		errorcode.WriteJSONError(w, errorcode.ErrInvalidImportFile, http.StatusBadRequest)
+		return
+	}
+
+	phraseModel := database.PhraseModel{DB: h.DB}
+	responseData, err := phraseModel.Import(ctx, userSession.UserID, format, records)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/oauth"
+	"github.com/arinji2/vocab-thing/internal/totp"
+)
+
+const (
+	// mfaChallengeExpiry is how long a pending session waits for the second factor.
+	mfaChallengeExpiry = 10 * time.Minute
+	// mfaMaxAttempts is how many wrong codes in a row lock the user's second factor, across all their sessions.
+	mfaMaxAttempts = 5
+	// mfaLockout is how long the second factor stays locked after mfaMaxAttempts wrong codes.
+	mfaLockout = 15 * time.Minute
+)
+
+type MFAHandler struct {
+	*Handler
+}
+
+type mfaStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+type mfaCodeRequest struct {
+	// Code is a code from the authenticator app or one of the recovery codes.
+	Code string `json:"code"`
+}
+
+type mfaEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningURI"`
+}
+
+type mfaRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (h *MFAHandler) GetMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	mfaModel := database.MFAModel{DB: h.DB}
+	enabled, err := mfaModel.Enabled(ctx, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	left, err := mfaModel.RecoveryCodesLeft(ctx, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaStatusResponse{Enabled: enabled, RecoveryCodesLeft: left})
+}
+
+// EnrollMFA creates a TOTP secret for the user to add to their authenticator app. MFA is only enabled once ConfirmMFA sees a code from it.
+func (h *MFAHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	userModel := database.UserModel{DB: h.DB}
+	user, err := userModel.ByID(ctx, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	secret := totp.GenerateSecret()
+	mfaModel := database.MFAModel{DB: h.DB}
+	if err := mfaModel.Enroll(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, errorcode.ErrMFAEnabled) {
+			errorcode.WriteJSONError(w, err, http.StatusConflict)
+			return
+		}
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(auth.MFAIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmMFA enables MFA with the first code from the authenticator app and returns the recovery codes, which are never shown again.
+func (h *MFAHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	mfaModel := database.MFAModel{DB: h.DB}
+	mfa, err := mfaModel.ByUserID(ctx, userSession.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			errorcode.WriteJSONError(w, errorcode.ErrMFANotEnabled, http.StatusBadRequest)
+			return
+		}
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if mfa.ConfirmedAt != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrMFAEnabled, http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(mfa.Secret, data.Code, time.Now())
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrInvalidMFACode, http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes := auth.NewRecoveryCodes()
+	if err := mfaModel.Confirm(ctx, userSession.UserID, step, hashes); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// The code was just checked, so the session enabling MFA counts as having passed it.
+	sessionModel := database.SessionModel{DB: h.DB}
+	if err := sessionModel.MarkMFAVerified(ctx, &userSession); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.Cookie.Set(w, userSession.Token, userSession.ExpiresAt)
+
+	writeJSON(w, http.StatusOK, mfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code. It needs a current code, so a stolen session cannot lock the user out.
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+	if err := h.checkSessionCode(ctx, w, userSession, data.Code); err != nil {
+		errorcode.WriteJSONError(w, err, codeErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	codes, hashes := auth.NewRecoveryCodes()
+	mfaModel := database.MFAModel{DB: h.DB}
+	if err := mfaModel.ReplaceRecoveryCodes(ctx, userSession.UserID, hashes); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA turns MFA off. Like regenerating recovery codes, it needs a current code.
+func (h *MFAHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+	if err := h.checkSessionCode(ctx, w, userSession, data.Code); err != nil {
+		errorcode.WriteJSONError(w, err, codeErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	mfaModel := database.MFAModel{DB: h.DB}
+	if err := mfaModel.Delete(ctx, userSession.UserID); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyMFA is the second step of signing in for users with MFA. It completes the pending session from the
+// sign in, which is revoked when its wrong codes lock the second factor.
+func (h *MFAHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessionToken, err := auth.GetUserSession(r)
+	if err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusUnauthorized)
+		return
+	}
+	sessionModel := database.SessionModel{DB: h.DB}
+	session, err := sessionModel.Validate(ctx, sessionToken)
+	if err != nil {
+		if err == auth.ErrSessionExpired {
+			h.Cookie.Delete(w)
+		}
+		errorcode.WriteJSONError(w, err, http.StatusUnauthorized)
+		return
+	}
+	if !session.MFAPending {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	var data mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.checkSessionCode(ctx, w, session, data.Code); err != nil {
+		errorcode.WriteJSONError(w, err, codeErrorStatus(err, http.StatusUnauthorized))
+		return
+	}
+
+	if err := sessionModel.CompleteMFA(ctx, &session, oauth.SessionExpiry(time.Now())); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.Cookie.Set(w, session.Token, session.ExpiresAt)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkSessionCode checks a code sent with the session. Wrong codes count against the user rather than the session,
+// so signing in again does not buy more guesses. The session whose wrong code locks the second factor is revoked.
+func (h *MFAHandler) checkSessionCode(ctx context.Context, w http.ResponseWriter, session models.Session, code string) error {
+	err := h.checkCode(ctx, session.UserID, code)
+	if !errors.Is(err, errorcode.ErrInvalidMFACode) {
+		return err
+	}
+
+	mfaModel := database.MFAModel{DB: h.DB}
+	locked, recordErr := mfaModel.RecordFailure(ctx, session.UserID, mfaMaxAttempts, time.Now().Add(mfaLockout))
+	if recordErr != nil || locked {
+		sessionModel := database.SessionModel{DB: h.DB}
+		sessionModel.Delete(ctx, session.ID, session.UserID)
+		h.Cookie.Delete(w)
+	}
+	return err
+}
+
+// codeErrorStatus is the status for an error from checkSessionCode, with wrongCode for a wrong code.
+func codeErrorStatus(err error, wrongCode int) int {
+	switch {
+	case errors.Is(err, errorcode.ErrInvalidMFACode):
+		return wrongCode
+	case errors.Is(err, errorcode.ErrMFALocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errorcode.ErrMFANotEnabled):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// checkCode accepts either a code from the authenticator app, each usable once, or an unused recovery code. While
+// the second factor is locked every code is refused unchecked.
+func (h *MFAHandler) checkCode(ctx context.Context, userID, code string) error {
+	mfaModel := database.MFAModel{DB: h.DB}
+	mfa, err := mfaModel.ByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errorcode.ErrMFANotEnabled
+		}
+		return err
+	}
+	if mfa.ConfirmedAt == nil {
+		return errorcode.ErrMFANotEnabled
+	}
+	if mfa.LockedUntil != nil && time.Now().Before(*mfa.LockedUntil) {
+		return errorcode.ErrMFALocked
+	}
+
+	if step, ok := totp.Validate(mfa.Secret, code, time.Now()); ok {
+		err = mfaModel.UseStep(ctx, userID, step)
+	} else {
+		err = mfaModel.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(code))
+	}
+	if err != nil {
+		return err
+	}
+	return mfaModel.ResetFailures(ctx, userID)
+}
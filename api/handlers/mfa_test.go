@@ -0,0 +1,188 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/totp"
+)
+
+// enableMFA enrolls and confirms MFA for the session's user and returns the session, which passed the second factor
+// on confirming, along with the recovery codes.
+func enableMFA(t *testing.T, s *testServer, session *http.Cookie) (*http.Cookie, []string) {
+	t.Helper()
+	w := s.do(http.MethodPost, "/user/mfa/enroll", "", session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to enroll: %d %s", w.Code, w.Body.String())
+	}
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(w.Body).Decode(&enrollment)
+
+	if w := s.do(http.MethodPost, "/user/mfa/confirm", `{"code":"000000x"}`, session); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong code to be refused with 400, got %d", w.Code)
+	}
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	w = s.do(http.MethodPost, "/user/mfa/confirm", `{"code":"`+code+`"}`, session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to confirm: %d %s", w.Code, w.Body.String())
+	}
+	return sessionCookie(t, w), recoveryCodes(t, w.Body)
+}
+
+func recoveryCodes(t *testing.T, body io.Reader) []string {
+	t.Helper()
+	var data struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := json.NewDecoder(body).Decode(&data); err != nil || len(data.RecoveryCodes) == 0 {
+		t.Fatalf("Expected recovery codes, got %v", err)
+	}
+	return data.RecoveryCodes
+}
+
+// signInWithMFA signs in and passes the second factor with the code.
+func signInWithMFA(t *testing.T, s *testServer, email, code string) *http.Cookie {
+	t.Helper()
+	pending := s.signIn(email)
+	w := s.do(http.MethodPost, "/auth/mfa/verify", `{"code":"`+code+`"}`, pending)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to verify code: %d %s", w.Code, w.Body.String())
+	}
+	return sessionCookie(t, w)
+}
+
+func TestMFA(t *testing.T) {
+	s := newTestServer(t)
+	session, codes := enableMFA(t, s, s.signIn("mfa@example.com"))
+
+	if w := s.do(http.MethodPost, "/user/mfa/enroll", "", session); w.Code != http.StatusConflict {
+		t.Errorf("Expected enrolling twice to be refused with 409, got %d", w.Code)
+	}
+	var status struct {
+		Enabled           bool `json:"enabled"`
+		RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+	}
+	json.NewDecoder(s.do(http.MethodGet, "/user/mfa", "", session).Body).Decode(&status)
+	if !status.Enabled || status.RecoveryCodesLeft != len(codes) {
+		t.Errorf("Expected MFA to be enabled with %d recovery codes, got %+v", len(codes), status)
+	}
+
+	t.Run("Pending Session", func(t *testing.T) {
+		pending := s.signIn("mfa@example.com")
+		if w := s.do(http.MethodGet, "/user/mfa", "", pending); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a pending session to be refused with 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("Regenerate", func(t *testing.T) {
+		if w := s.do(http.MethodPost, "/user/mfa/recovery-codes", `{"code":"wrong"}`, session); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a wrong code to be refused with 400, got %d", w.Code)
+		}
+		w := s.do(http.MethodPost, "/user/mfa/recovery-codes", `{"code":"`+codes[0]+`"}`, session)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to regenerate: %d %s", w.Code, w.Body.String())
+		}
+		newCodes := recoveryCodes(t, w.Body)
+		if w := s.do(http.MethodPost, "/user/mfa/recovery-codes", `{"code":"`+codes[1]+`"}`, session); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected an old recovery code to be refused, got %d", w.Code)
+		}
+		codes = newCodes
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		if w := s.do(http.MethodDelete, "/user/mfa", `{"code":"`+codes[0]+`"}`, session); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d %s", w.Code, w.Body.String())
+		}
+		if w := s.do(http.MethodDelete, "/user/mfa", `{"code":"`+codes[1]+`"}`, session); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected disabling twice to be refused with 400, got %d", w.Code)
+		}
+		json.NewDecoder(s.do(http.MethodGet, "/user/mfa", "", session).Body).Decode(&status)
+		if status.Enabled {
+			t.Error("Expected MFA to be disabled")
+		}
+	})
+}
+
+func TestMFAAttemptLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"Regenerate", http.MethodPost, "/user/mfa/recovery-codes"},
+		{"Disable", http.MethodDelete, "/user/mfa"},
+		{"Verify", http.MethodPost, "/auth/mfa/verify"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			_, codes := enableMFA(t, s, s.signIn("limit@example.com"))
+			session := signInWithMFA(t, s, "limit@example.com", codes[0])
+			if tt.name == "Verify" {
+				session = s.signIn("limit@example.com")
+			}
+
+			for i := 1; i <= 5; i++ {
+				w := s.do(tt.method, tt.path, `{"code":"wrong"}`, session)
+				if w.Code == http.StatusOK || w.Code == http.StatusNoContent {
+					t.Fatalf("Expected wrong code %d to be refused, got %d", i, w.Code)
+				}
+				revoked := false
+				for _, c := range w.Result().Cookies() {
+					revoked = revoked || (c.Name == "session" && c.MaxAge < 0)
+				}
+				if revoked != (i == 5) {
+					t.Errorf("Expected the session to be revoked only on wrong code 5, got revoked=%v on %d", revoked, i)
+				}
+			}
+
+			// Even the right code is too late once the session is gone.
+			if w := s.do(tt.method, tt.path, `{"code":"`+codes[1]+`"}`, session); w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected the revoked session to be refused with 401, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestMFALockoutAcrossSignIns(t *testing.T) {
+	s := newTestServer(t)
+	email := "lockout@example.com"
+	_, codes := enableMFA(t, s, s.signIn(email))
+	signIn := func() *http.Cookie {
+		// More sign ins than the email login limit allows.
+		if _, err := s.db.Exec(`DELETE FROM email_login_tokens`); err != nil {
+			t.Fatalf("Failed to clear login tokens: %v", err)
+		}
+		return s.signIn(email)
+	}
+
+	// Signing in again must not start the count over.
+	for i := 1; i <= 5; i++ {
+		pending := signIn()
+		if w := s.do(http.MethodPost, "/auth/mfa/verify", `{"code":"wrong"}`, pending); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected wrong code %d to be refused with 401, got %d", i, w.Code)
+		}
+	}
+
+	pending := signIn()
+	if w := s.do(http.MethodPost, "/auth/mfa/verify", `{"code":"`+codes[0]+`"}`, pending); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected even the right code to be refused while locked, got %d", w.Code)
+	}
+
+	if _, err := s.db.Exec(`UPDATE user_mfa SET lockedUntil = ? WHERE userId = ?`,
+		time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), s.userID(email)); err != nil {
+		t.Fatalf("Failed to end the lockout: %v", err)
+	}
+	if w := s.do(http.MethodPost, "/auth/mfa/verify", `{"code":"`+codes[0]+`"}`, pending); w.Code != http.StatusOK {
+		t.Errorf("Expected the right code to work once the lockout ends, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -34,7 +34,7 @@ func (h *UserHandler) GenerateCodeURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	provider, err := oauth.NewProvider(ctx, data.ProviderType)
+	provider, err := h.Providers.New(ctx, data.ProviderType)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
@@ -73,13 +73,13 @@ func (h *UserHandler) CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
 		return
 	}
-	provider, err := oauth.NewProvider(ctx, data.ProviderType)
+	provider, err := h.Providers.New(ctx, data.ProviderType)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	p, err := provider.AuthenticateWithCode(r, data.Code, data.State)
+	p, err := provider.AuthenticateWithCode(r, w, data.Code, data.State)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
@@ -91,96 +91,206 @@ func (h *UserHandler) CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userModel := database.UserModel{DB: h.DB}
-	dbUser, err := userModel.ByEmail(ctx, user.Email)
+	if p.Subject == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrFetchingOauthUser, http.StatusBadRequest)
+		return
+	}
+	user.Email = oauth.AccountEmail(user.Email, p.Type, p.Subject)
+
+	mfaRequired, err := h.signIn(ctx, w, r, *user, *p, data.Fingerprint, data.IP)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			err = userModel.Create(ctx, user)
-			sessionModel := database.SyncModel{DB: h.DB}
-			sessionModel.CreateSync(ctx, user.ID)
-		}
+		errorcode.WriteJSONError(w, err, signInErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, signInResponse{MFARequired: mfaRequired})
+}
+
+type signInResponse struct {
+	// MFARequired means the session cookie is only good for /auth/mfa/verify until a second factor is given.
+	MFARequired bool `json:"mfaRequired"`
+}
+
+// signIn finishes a login with a verified identity: a signed in guest is upgraded in place, anyone else is
+// matched to their user, created on first sign in. Either way a session is started, reporting whether it
+// still waits for the second factor.
+func (h *UserHandler) signIn(ctx context.Context, w http.ResponseWriter, r *http.Request, user models.User, p models.OauthProvider, fingerprint, ip string) (bool, error) {
+	// A signed in guest completing OAuth keeps their data instead of getting a fresh account.
+	if guestID, ok := h.guestFromRequest(ctx, r); ok {
+		userModel := database.UserModel{DB: h.DB}
+		upgradedUser, upgradedProvider, err := userModel.UpgradeGuest(ctx, guestID, user, p)
 		if err != nil {
-			errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-			return
+			return false, err
 		}
-	} else {
-		user = &dbUser
+		return h.startSession(ctx, w, upgradedUser, upgradedProvider, fingerprint, ip)
+	}
+
+	dbUser, selectedUserProvider, err := h.resolveOauthUser(ctx, user, p)
+	if err != nil {
+		return false, err
+	}
+	if dbUser.DisabledAt != nil {
+		return false, errorcode.ErrUserDisabled
+	}
+	return h.startSession(ctx, w, dbUser, selectedUserProvider, fingerprint, ip)
+}
+
+func signInErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errorcode.ErrUserDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, errorcode.ErrIdentityMismatch):
+		return http.StatusConflict
 	}
+	return http.StatusInternalServerError
+}
+
+// resolveOauthUser finds the user of an OAuth identity, creating the user and provider row on first sign in.
+// Identities are matched by provider subject, then by email for accounts linked before subjects were stored. The email
+// match only adopts a provider row without a subject; a row with one belongs to another identity at the provider.
+func (h *UserHandler) resolveOauthUser(ctx context.Context, user models.User, p models.OauthProvider) (models.User, models.OauthProvider, error) {
+	userModel := database.UserModel{DB: h.DB}
 	providerModel := database.ProviderModel{DB: h.DB}
-	selectedUserProvider := models.OauthProvider{}
 
-	userProviders, err := providerModel.ByUserID(ctx, user.ID)
+	linked, err := providerModel.BySubject(ctx, p.Type, p.Subject)
+	if err == nil {
+		dbUser, err := userModel.ByID(ctx, linked.UserID)
+		if err != nil {
+			return models.User{}, models.OauthProvider{}, err
+		}
+		linked.AccessToken, linked.RefreshToken, linked.ExpiresAt = p.AccessToken, p.RefreshToken, p.ExpiresAt
+		if err := providerModel.UpdateTokens(ctx, &linked); err != nil {
+			return models.User{}, models.OauthProvider{}, err
+		}
+		return dbUser, linked, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, models.OauthProvider{}, err
+	}
+
+	dbUser, err := userModel.ByEmail(ctx, user.Email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			selectedUserProvider = models.OauthProvider{
-				UserID:       user.ID,
-				Type:         p.Type,
-				AccessToken:  p.AccessToken,
-				RefreshToken: p.RefreshToken,
-				ExpiresAt:    p.ExpiresAt,
-			}
-			err = providerModel.Create(ctx, &selectedUserProvider)
-			if err != nil {
-				errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-				return
-			}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, models.OauthProvider{}, err
 		}
-	} else {
-		providerExists := slices.ContainsFunc(userProviders, func(provider models.OauthProvider) bool {
-			if provider.Type == p.Type {
-				selectedUserProvider = provider
-				return true
-			}
-			return false
-		})
-
-		if !providerExists {
-			selectedUserProvider = models.OauthProvider{
-				UserID:       user.ID,
-				Type:         p.Type,
-				AccessToken:  p.AccessToken,
-				RefreshToken: p.RefreshToken,
-				ExpiresAt:    p.ExpiresAt,
-			}
-			err = providerModel.Create(ctx, &selectedUserProvider)
-			if err != nil {
-				errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-				return
-			}
+		if err := userModel.Create(ctx, &user); err != nil {
+			return models.User{}, models.OauthProvider{}, err
+		}
+		syncModel := database.SyncModel{DB: h.DB}
+		syncModel.CreateSync(ctx, user.ID)
+		dbUser = user
+	}
+
+	userProviders, err := providerModel.ByUserID(ctx, dbUser.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, models.OauthProvider{}, err
+	}
+	for _, provider := range userProviders {
+		if provider.Type != p.Type {
+			continue
+		}
+		if provider.Subject != "" {
+			return models.User{}, models.OauthProvider{}, errorcode.ErrIdentityMismatch
+		}
+		provider.Subject = p.Subject
+		provider.AccessToken, provider.RefreshToken, provider.ExpiresAt = p.AccessToken, p.RefreshToken, p.ExpiresAt
+		if err := providerModel.UpdateTokens(ctx, &provider); err != nil {
+			return models.User{}, models.OauthProvider{}, err
 		}
+		return dbUser, provider, nil
 	}
 
+	selectedUserProvider := models.OauthProvider{
+		UserID:       dbUser.ID,
+		Type:         p.Type,
+		Subject:      p.Subject,
+		AccessToken:  p.AccessToken,
+		RefreshToken: p.RefreshToken,
+		ExpiresAt:    p.ExpiresAt,
+	}
+	if err := providerModel.Create(ctx, &selectedUserProvider); err != nil {
+		return models.User{}, models.OauthProvider{}, err
+	}
+	return dbUser, selectedUserProvider, nil
+}
+
+// startSession creates a session, replacing any of the same provider and device, and sets the session cookie.
+// Users with MFA get a short pending session instead, and true is returned until /auth/mfa/verify completes it.
+func (h *UserHandler) startSession(ctx context.Context, w http.ResponseWriter, user models.User, provider models.OauthProvider, fingerprint, ip string) (bool, error) {
 	sessionModel := database.SessionModel{DB: h.DB}
-	var userSession models.Session
+
+	mfaModel := database.MFAModel{DB: h.DB}
+	mfaEnabled, err := mfaModel.Enabled(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if mfaEnabled {
+		pendingSession := models.Session{
+			UserID:      user.ID,
+			ProviderID:  provider.ID,
+			Fingerprint: fingerprint,
+			IP:          ip,
+			ExpiresAt:   time.Now().Add(mfaChallengeExpiry),
+			MFAPending:  true,
+		}
+		if err := sessionModel.Create(ctx, &pendingSession); err != nil {
+			return false, err
+		}
+		h.Cookie.Set(w, pendingSession.Token, pendingSession.ExpiresAt)
+		return true, nil
+	}
+
 	existingSessions, err := sessionModel.ByUserIDWithProvider(ctx, user.ID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-		return
+		return false, err
 	}
 
+	// Signing in again replaces the device's session rather than reusing it, so the new one starts on a fresh token
+	// and counts as a recent sign in for RequireRecentAuth.
 	for _, session := range existingSessions {
-		if session.ProviderType == nil {
+		if session.ProviderType == nil || session.MFAPending {
 			continue
 		}
-		if *session.ProviderType == selectedUserProvider.Type && session.Fingerprint == data.Fingerprint && session.IP == data.IP && session.ExpiresAt.After(time.Now().Add(time.Hour*24)) {
-			userSession = session
+		if *session.ProviderType == provider.Type && session.Fingerprint == fingerprint && session.IP == ip {
+			if err := sessionModel.Delete(ctx, session.ID, user.ID); err != nil && !errors.Is(err, errorcode.ErrSessionNotFound) {
+				return false, err
+			}
 			break
 		}
 	}
-	if userSession.ID == "" {
-		userSession = models.Session{
-			UserID:      user.ID,
-			ProviderID:  selectedUserProvider.ID,
-			Fingerprint: data.Fingerprint,
-			IP:          data.IP,
-			ExpiresAt:   oauth.SessionExpiry(time.Now()),
-		}
-		err = sessionModel.Create(ctx, &userSession)
-		if err != nil {
-			errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-			return
-		}
+
+	userSession := models.Session{
+		UserID:      user.ID,
+		ProviderID:  provider.ID,
+		Fingerprint: fingerprint,
+		IP:          ip,
+		ExpiresAt:   oauth.SessionExpiry(time.Now()),
 	}
-	auth.CreateUserSessionCookie(w, userSession.ID, userSession.ExpiresAt)
-	w.WriteHeader(http.StatusOK)
+	if err := sessionModel.Create(ctx, &userSession); err != nil {
+		return false, err
+	}
+	h.Cookie.Set(w, userSession.Token, userSession.ExpiresAt)
+	return false, nil
+}
+
+// guestFromRequest returns the user of the request's session cookie when it belongs to a guest account.
+func (h *UserHandler) guestFromRequest(ctx context.Context, r *http.Request) (string, bool) {
+	sessionToken, err := auth.GetUserSession(r)
+	if err != nil {
+		return "", false
+	}
+	sessionModel := database.SessionModel{DB: h.DB}
+	session, err := sessionModel.Validate(ctx, sessionToken)
+	if err != nil || session.MFAPending {
+		return "", false
+	}
+
+	providerModel := database.ProviderModel{DB: h.DB}
+	providers, err := providerModel.ByUserID(ctx, session.UserID)
+	if err != nil {
+		return "", false
+	}
+	isGuest := slices.ContainsFunc(providers, func(provider models.OauthProvider) bool {
+		return provider.Type == "guest"
+	})
+	return session.UserID, isGuest
 }
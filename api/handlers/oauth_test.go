@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+func TestSignInEmailFallback(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	userModel := database.UserModel{DB: s.db}
+	providerModel := database.ProviderModel{DB: s.db}
+
+	// newLinkedUser creates a user with an email provider, as linked before subjects were stored when subject is empty.
+	newLinkedUser := func(email, subject string) models.OauthProvider {
+		user := models.User{Username: email, Email: email}
+		if err := userModel.Create(ctx, &user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		provider := models.OauthProvider{UserID: user.ID, Type: "email", Subject: subject}
+		if err := providerModel.Create(ctx, &provider); err != nil {
+			t.Fatalf("Failed to create provider: %v", err)
+		}
+		return provider
+	}
+	signIn := func(email string) *http.Response {
+		s.do(http.MethodPost, "/auth/email/start", `{"email":"`+email+`"}`, nil)
+		return s.do(http.MethodPost, "/auth/email/verify", `{"token":"`+s.mail.lastToken(t, email)+`"}`, nil).Result()
+	}
+	subject := func(id string) string {
+		var subject sql.NullString
+		if err := s.db.QueryRow(`SELECT subject FROM providers WHERE id = ?`, id).Scan(&subject); err != nil {
+			t.Fatalf("Failed to read provider: %v", err)
+		}
+		return subject.String
+	}
+
+	t.Run("Adopts Provider Without Subject", func(t *testing.T) {
+		provider := newLinkedUser("legacy@example.com", "")
+		if res := signIn("legacy@example.com"); res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", res.StatusCode)
+		}
+		if got := subject(provider.ID); got != "legacy@example.com" {
+			t.Errorf("Expected the subject to be stored, got %q", got)
+		}
+	})
+
+	t.Run("Refuses Another Identity", func(t *testing.T) {
+		provider := newLinkedUser("taken@example.com", "previous@example.com")
+		res := signIn("taken@example.com")
+		if res.StatusCode != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", res.StatusCode)
+		}
+		for _, c := range res.Cookies() {
+			if c.Name == "session" && c.Value != "" {
+				t.Error("Expected no session cookie")
+			}
+		}
+		if got := subject(provider.ID); got != "previous@example.com" {
+			t.Errorf("Expected the subject to be kept, got %q", got)
+		}
+	})
+}
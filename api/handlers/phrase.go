@@ -84,7 +84,7 @@ func (p *PhraseHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
 	}
 	phraseModel := database.PhraseModel{DB: p.DB}
 
-	verifiedData, err := phraseModel.ByID(ctx, data.PhraseID, userSession.UserID)
+	verifiedData, err := phraseModel.ByID(ctx, data.PhraseID, userSession.UserID, database.ExcludeTrashed)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
@@ -120,8 +120,13 @@ func (p *PhraseHandler) GetPhraseByID(w http.ResponseWriter, r *http.Request) {
 	}
 	phraseID := chi.URLParam(r, "id")
 
+	trash := database.ExcludeTrashed
+	if r.URL.Query().Get("includeTrashed") == "true" {
+		trash = database.IncludeTrashed
+	}
+
 	phraseModel := database.PhraseModel{DB: p.DB}
-	responseData, err := phraseModel.ByID(ctx, phraseID, userSession.UserID)
+	responseData, err := phraseModel.ByID(ctx, phraseID, userSession.UserID, trash)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
@@ -145,7 +150,7 @@ func (p *PhraseHandler) GetAllPhrases(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	phraseModel := database.PhraseModel{DB: p.DB}
-	responseData, err := phraseModel.All(ctx, paginationData.Page, paginationData.PageSize, paginationData.Sorting.SortBy, paginationData.Sorting.Order, paginationData.Sorting.GroupBy, userSession.UserID)
+	responseData, err := phraseModel.All(ctx, paginationData.Page, paginationData.PageSize, paginationData.Cursor, paginationData.Sorting.SortBy, paginationData.Sorting.Order, paginationData.Sorting.GroupBy, userSession.UserID)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
@@ -169,7 +174,7 @@ func (p *PhraseHandler) SearchPhrases(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	phraseModel := database.PhraseModel{DB: p.DB}
-	responseData, err := phraseModel.Search(ctx, searchingData.Term, userSession.UserID)
+	responseData, err := phraseModel.Search(ctx, searchingData.Term, userSession.UserID, searchingData.Limit)
 	if err != nil {
 		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
 		return
@@ -319,3 +324,86 @@ func (p *PhraseHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (p *PhraseHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+	paginationData, exists := httpmiddleware.PaginationFromContext(ctx)
+	if !exists {
+		errorcode.WriteJSONError(w, errorcode.ErrNoPaginationData, http.StatusInternalServerError)
+		return
+	}
+
+	phraseModel := database.PhraseModel{DB: p.DB}
+	responseData, err := phraseModel.Trash(ctx, paginationData.Page, paginationData.PageSize, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
+
+func (p *PhraseHandler) RestorePhrase(w http.ResponseWriter, r *http.Request) {
+	phraseID := chi.URLParam(r, "id")
+	if phraseID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "phraseID"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	phraseModel := database.PhraseModel{DB: p.DB}
+	err := phraseModel.RestorePhrase(ctx, phraseID, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	responseData, err := phraseModel.ByID(ctx, phraseID, userSession.UserID, database.ExcludeTrashed)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
+
+func (p *PhraseHandler) PurgePhrase(w http.ResponseWriter, r *http.Request) {
+	phraseID := chi.URLParam(r, "id")
+	if phraseID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "phraseID"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	phraseModel := database.PhraseModel{DB: p.DB}
+	err := phraseModel.PurgePhrase(ctx, phraseID, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
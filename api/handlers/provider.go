@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type ProviderHandler struct {
+	*Handler
+}
+
+func (h *ProviderHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	providerModel := database.ProviderModel{DB: h.DB}
+	responseData, err := providerModel.ByUserID(ctx, userSession.UserID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		responseData = []models.OauthProvider{}
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
+
+type linkProviderRequest struct {
+	ProviderType string `json:"providerType"`
+	Code         string `json:"code"`
+	State        string `json:"state"`
+}
+
+// LinkProvider completes an OAuth flow started with /oauth/generate-code-url and attaches the identity to the signed in user.
+func (h *ProviderHandler) LinkProvider(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data linkProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+	provider, err := h.Providers.New(ctx, data.ProviderType)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	p, err := provider.AuthenticateWithCode(r, w, data.Code, data.State)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+	if _, err := provider.FetchAuthUser(p); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+	if p.Subject == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrFetchingOauthUser, http.StatusBadRequest)
+		return
+	}
+
+	providerModel := database.ProviderModel{DB: h.DB}
+	linked, err := providerModel.BySubject(ctx, p.Type, p.Subject)
+	switch {
+	case err == nil && linked.UserID != userSession.UserID:
+		errorcode.WriteJSONError(w, errorcode.ErrProviderLinked, http.StatusConflict)
+		return
+	case err == nil:
+		linked.AccessToken, linked.RefreshToken, linked.ExpiresAt = p.AccessToken, p.RefreshToken, p.ExpiresAt
+		if err := providerModel.UpdateTokens(ctx, &linked); err != nil {
+			errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, linked)
+		return
+	case !errors.Is(err, sql.ErrNoRows):
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions are tied to a provider type, so a user can only have one identity per provider.
+	userProviders, err := providerModel.ByUserID(ctx, userSession.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	for _, existing := range userProviders {
+		if existing.Type == p.Type {
+			errorcode.WriteJSONError(w, errorcode.ErrProviderLinked, http.StatusConflict)
+			return
+		}
+	}
+
+	newProvider := models.OauthProvider{
+		UserID:       userSession.UserID,
+		Type:         p.Type,
+		Subject:      p.Subject,
+		AccessToken:  p.AccessToken,
+		RefreshToken: p.RefreshToken,
+		ExpiresAt:    p.ExpiresAt,
+	}
+	if err := providerModel.Create(ctx, &newProvider); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newProvider)
+}
+
+func (h *ProviderHandler) UnlinkProvider(w http.ResponseWriter, r *http.Request) {
+	providerID := chi.URLParam(r, "id")
+	if providerID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "id"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	providerModel := database.ProviderModel{DB: h.DB}
+	if err := providerModel.Delete(ctx, providerID, userSession.UserID); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/srs"
+	"github.com/go-chi/chi/v5"
+)
+
+type ReviewHandler struct {
+	*Handler
+}
+
+func (h *ReviewHandler) GetDue(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	reviewModel := database.ReviewModel{DB: h.DB}
+	responseData, err := reviewModel.Due(ctx, userSession.UserID, limit)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
+
+type reviewPhraseRequest struct {
+	// Quality is a pointer so a missing grade is refused rather than read as a blackout.
+	Quality *int `json:"quality"`
+}
+
+func (h *ReviewHandler) ReviewPhrase(w http.ResponseWriter, r *http.Request) {
+	phraseID := chi.URLParam(r, "phraseID")
+	if phraseID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "phraseID"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data reviewPhraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+	if data.Quality == nil || !srs.ValidQuality(*data.Quality) {
+		errorcode.WriteJSONError(w, errorcode.ErrInvalidQuality, http.StatusBadRequest)
+		return
+	}
+
+	reviewModel := database.ReviewModel{DB: h.DB}
+	responseData, err := reviewModel.Record(ctx, phraseID, userSession.UserID, *data.Quality)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
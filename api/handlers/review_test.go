@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestReviewPhraseQuality(t *testing.T) {
+	s := newTestServer(t)
+	session := s.signIn("reviewer@example.com")
+
+	w := s.do(http.MethodPost, "/phrase/create/phrase", `{"phrase":"ephemeral","phrase_definition":"lasting a short time"}`, session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to create phrase: %d %s", w.Code, w.Body.String())
+	}
+	var phrase struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&phrase); err != nil {
+		t.Fatalf("Failed to decode phrase: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"Missing", `{}`, http.StatusBadRequest},
+		{"Null", `{"quality":null}`, http.StatusBadRequest},
+		{"Too Low", `{"quality":-1}`, http.StatusBadRequest},
+		{"Too High", `{"quality":6}`, http.StatusBadRequest},
+		{"Blackout", `{"quality":0}`, http.StatusOK},
+		{"Perfect", `{"quality":5}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(http.MethodPost, "/review/"+phrase.ID, tt.body, session)
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/arinji2/vocab-thing/internal/auth"
 	"github.com/arinji2/vocab-thing/internal/database"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
 )
 
 type SyncHandler struct {
@@ -53,3 +56,78 @@ func (s *SyncHandler) ManualSync(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, responseData)
 }
+
+func (s *SyncHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > 1000 {
+		limit = 500
+	}
+
+	syncModel := database.SyncModel{DB: s.DB}
+	responseData, err := syncModel.Changes(ctx, userSession.UserID, query.Get("since"), limit)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
+
+type pushChangesRequest struct {
+	Policy    string                `json:"policy"`
+	Mutations []models.SyncMutation `json:"mutations"`
+}
+
+type pushChangesResponse struct {
+	Results []models.SyncMutationResult `json:"results"`
+}
+
+func (s *SyncHandler) PushChanges(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data pushChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	switch data.Policy {
+	case "":
+		data.Policy = database.SyncPolicyReject
+	case database.SyncPolicyReject, database.SyncPolicyLastWriterWins:
+	default:
+		errorcode.WriteJSONError(w, errorcode.ErrInvalidPolicy, http.StatusBadRequest)
+		return
+	}
+
+	if len(data.Mutations) > 500 {
+		errorcode.WriteJSONError(w, errorcode.ErrTooManyMutations.WithDetails(map[string]int{"max": 500}), http.StatusBadRequest)
+		return
+	}
+
+	syncModel := database.SyncModel{DB: s.DB}
+	results, err := syncModel.Push(ctx, userSession.UserID, data.Policy, data.Mutations)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pushChangesResponse{Results: results})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type TokenHandler struct {
+	*Handler
+}
+
+func (h *TokenHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	tokenModel := database.TokenModel{DB: h.DB}
+	responseData, err := tokenModel.ByUserID(ctx, userSession.UserID)
+	if err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, responseData)
+}
+
+type createTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type createTokenResponse struct {
+	models.APIToken
+	// Token is only ever returned here; afterwards just its hash is kept.
+	Token string `json:"token"`
+}
+
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	var data createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
+		return
+	}
+
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "name"}), http.StatusBadRequest)
+		return
+	}
+	if len(data.Scopes) == 0 || data.ExpiresInDays < 0 {
+		errorcode.WriteJSONError(w, errorcode.ErrInvalidScope, http.StatusBadRequest)
+		return
+	}
+	scopes := []string{}
+	for _, scope := range data.Scopes {
+		if !slices.Contains(auth.ValidScopes, scope) {
+			errorcode.WriteJSONError(w, errorcode.ErrInvalidScope, http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	plain, hash := auth.NewAPIToken()
+	token := models.APIToken{
+		UserID: userSession.UserID,
+		Name:   data.Name,
+		Prefix: plain[:len(auth.APITokenPrefix)+4],
+		Scopes: scopes,
+	}
+	if data.ExpiresInDays > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(data.ExpiresInDays) * 24 * time.Hour).Truncate(time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+
+	tokenModel := database.TokenModel{DB: h.DB}
+	if err := tokenModel.Create(ctx, &token, hash); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, createTokenResponse{APIToken: token, Token: plain})
+}
+
+func (h *TokenHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	tokenID := chi.URLParam(r, "id")
+	if tokenID == "" {
+		errorcode.WriteJSONError(w, errorcode.ErrBadRequest.WithDetails(map[string]string{"missing": "id"}), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userSession, ok := auth.SessionFromContext(ctx)
+	if !ok {
+		errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusInternalServerError)
+		return
+	}
+
+	tokenModel := database.TokenModel{DB: h.DB}
+	if err := tokenModel.Delete(ctx, tokenID, userSession.UserID); err != nil {
+		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"time"
 
@@ -18,56 +17,6 @@ type UserHandler struct {
 	*Handler
 }
 
-func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	userModel := database.UserModel{DB: h.DB}
-	users, err := userModel.GetAll(ctx)
-	if err != nil {
-		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-		return
-	}
-	for _, user := range users {
-		writeJSON(w, http.StatusOK, user)
-	}
-}
-
-type createUserRequest struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-}
-
-func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	var data createUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		errorcode.WriteJSONError(w, errorcode.ErrBadRequest, http.StatusBadRequest)
-		return
-	}
-	userModel := database.UserModel{DB: h.DB}
-	userData := models.User{
-		Email:    data.Email,
-		Username: data.Username,
-	}
-	err := userModel.Create(ctx, &userData)
-	if err != nil {
-		errorcode.WriteJSONError(w, err, http.StatusBadRequest)
-		return
-	}
-	syncModel := database.SyncModel{DB: h.DB}
-	err = syncModel.CreateSync(ctx, userData.ID)
-	if err != nil {
-		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	writeJSON(w, http.StatusOK, userData)
-}
-
 func (h *UserHandler) CreateGuestUser(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
@@ -109,7 +58,7 @@ func (h *UserHandler) CreateGuestUser(w http.ResponseWriter, r *http.Request) {
 		ProviderID:  userProvider.ID,
 		Fingerprint: "",
 		IP:          "",
-		ExpiresAt:   time.Now().Add(365 * 24 * time.Hour), // 1 year
+		ExpiresAt:   time.Now().Add(auth.GuestSessionIdleTimeout),
 	}
 	err = sessionModel.Create(ctx, &userSession)
 	if err != nil {
@@ -123,7 +72,7 @@ func (h *UserHandler) CreateGuestUser(w http.ResponseWriter, r *http.Request) {
 		errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
 		return
 	}
-	auth.CreateUserSessionCookie(w, userSession.ID, userSession.ExpiresAt)
+	h.Cookie.Set(w, userSession.Token, userSession.ExpiresAt)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -2,33 +2,39 @@ package auth
 
 import (
 	"net/http"
-	"os"
 	"time"
 )
 
-func CreateUserSessionCookie(w http.ResponseWriter, sessionID string, expiresAt time.Time) {
+// SessionCookie writes the session cookie. Secure is set in production, so the cookie is only sent over HTTPS.
+type SessionCookie struct {
+	Secure bool
+}
+
+// Set sets the session cookie to the session's token. The cookie lives as long as the session, and is set again
+// whenever the session slides forward or its token is rotated.
+func (c SessionCookie) Set(w http.ResponseWriter, token string, expiresAt time.Time) {
 	if expiresAt.IsZero() {
-		expiresAt = time.Now().Add(time.Hour * 24 * 7)
+		expiresAt = time.Now().Add(SessionIdleTimeout)
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session",
-		Value:    sessionID,
+		Value:    token,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   os.Getenv("ENVIRONMENT") == "production",
+		Secure:   c.Secure,
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   int(time.Until(expiresAt).Seconds()),
 		Expires:  expiresAt.UTC(),
 	})
 }
 
-func DeleteUserSessionCookie(w http.ResponseWriter) {
+func (c SessionCookie) Delete(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session",
 		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   false,
+		Secure:   c.Secure,
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   -1,
 		Expires:  time.Now().UTC(),
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/arinji2/vocab-thing/internal/utils/idgen"
+)
+
+// MFAIssuer names the app in authenticator apps.
+const MFAIssuer = "Vocab Thing"
+
+// RecoveryCodeCount is how many recovery codes a user gets when enabling MFA or regenerating them.
+const RecoveryCodeCount = 10
+
+// NewRecoveryCodes returns fresh recovery codes, formatted for reading as xxxxx-xxxxx, and the hashes stored in their place.
+func NewRecoveryCodes() (codes, hashes []string) {
+	for range RecoveryCodeCount {
+		code := idgen.GenerateRandomID(idgen.RecoveryCodeSize, idgen.RecoveryCodeCharset)
+		code = code[:idgen.RecoveryCodeSize/2] + "-" + code[idgen.RecoveryCodeSize/2:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// recoveryCodeReplacer undoes the usual mistakes when typing a code: dashes, spaces and letters read as digits.
+var recoveryCodeReplacer = strings.NewReplacer("-", "", " ", "", "o", "0", "i", "1", "l", "1")
+
+// HashRecoveryCode hashes a recovery code for storage and lookup, ignoring case and the usual typing mistakes.
+func HashRecoveryCode(code string) string {
+	normalized := recoveryCodeReplacer.Replace(strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
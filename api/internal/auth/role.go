@@ -0,0 +1,6 @@
+package auth
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
@@ -3,8 +3,23 @@ package auth
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/utils/idgen"
+)
+
+const (
+	// SessionIdleTimeout is how long a session lasts without being used. Every use pushes the expiry back again.
+	SessionIdleTimeout = 7 * 24 * time.Hour
+	// GuestSessionIdleTimeout is longer, as a guest whose session lapses has no way back into their account.
+	GuestSessionIdleTimeout = 365 * 24 * time.Hour
+	// SessionRotationInterval is how often the token of an active session is replaced.
+	SessionRotationInterval = 24 * time.Hour
+	// SessionRotationGrace is how long a token replaced by periodic rotation keeps working, for requests already in flight.
+	SessionRotationGrace = time.Minute
+	// sessionExtendStep keeps sliding expiry to one write per session in this period.
+	sessionExtendStep = time.Hour
 )
 
 type sessionCtxKey struct{}
@@ -19,3 +34,34 @@ func SessionFromContext(ctx context.Context) (models.Session, bool) {
 	session, ok := ctx.Value(sessionCtxKey{}).(models.Session)
 	return session, ok
 }
+
+// NewSessionToken returns a new session cookie value and the hash that is stored in its place.
+func NewSessionToken() (token, hash string) {
+	token = idgen.GenerateRandomID(idgen.SessionTokenSize, idgen.URLSafeAlphanumericCharset)
+	return token, HashSessionToken(token)
+}
+
+// HashSessionToken hashes a session cookie value for storage and lookup. Like personal access tokens,
+// session tokens are long and random, so a plain SHA-256 is enough.
+func HashSessionToken(token string) string {
+	return HashAPIToken(token)
+}
+
+// SessionIdleTimeoutFor returns the idle timeout of sessions signed in with the provider type.
+func SessionIdleTimeoutFor(providerType *string) time.Duration {
+	if providerType != nil && *providerType == "guest" {
+		return GuestSessionIdleTimeout
+	}
+	return SessionIdleTimeout
+}
+
+// SessionRefresh decides what using a session at now changes. It returns the session's new expiry, which slides
+// forward at most once per sessionExtendStep, and whether its token is old enough to be rotated.
+func SessionRefresh(session models.Session, now time.Time) (expiresAt time.Time, rotate bool) {
+	idle := SessionIdleTimeoutFor(session.ProviderType)
+	expiresAt = session.ExpiresAt
+	if expiresAt.Before(now.Add(idle - sessionExtendStep)) {
+		expiresAt = now.Add(idle)
+	}
+	return expiresAt, now.Sub(session.RotatedAt) >= SessionRotationInterval
+}
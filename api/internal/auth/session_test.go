@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+func TestSessionRefresh(t *testing.T) {
+	now := time.Date(2025, 4, 11, 12, 0, 0, 0, time.UTC)
+	guest := "guest"
+
+	tests := []struct {
+		name      string
+		session   models.Session
+		expiresAt time.Time
+		rotate    bool
+	}{
+		{
+			name:      "just extended",
+			session:   models.Session{ExpiresAt: now.Add(SessionIdleTimeout - time.Minute), RotatedAt: now.Add(-time.Hour)},
+			expiresAt: now.Add(SessionIdleTimeout - time.Minute),
+		},
+		{
+			name:      "idle for a day",
+			session:   models.Session{ExpiresAt: now.Add(SessionIdleTimeout - 24*time.Hour), RotatedAt: now.Add(-time.Hour)},
+			expiresAt: now.Add(SessionIdleTimeout),
+		},
+		{
+			name:      "token due for rotation",
+			session:   models.Session{ExpiresAt: now.Add(SessionIdleTimeout - time.Minute), RotatedAt: now.Add(-SessionRotationInterval)},
+			expiresAt: now.Add(SessionIdleTimeout - time.Minute),
+			rotate:    true,
+		},
+		{
+			name:      "guest",
+			session:   models.Session{ProviderType: &guest, ExpiresAt: now.Add(SessionIdleTimeout), RotatedAt: now},
+			expiresAt: now.Add(GuestSessionIdleTimeout),
+		},
+	}
+
+	for _, tt := range tests {
+		expiresAt, rotate := SessionRefresh(tt.session, now)
+		if !expiresAt.Equal(tt.expiresAt) {
+			t.Errorf("%s: expected expiry %s, got %s", tt.name, tt.expiresAt, expiresAt)
+		}
+		if rotate != tt.rotate {
+			t.Errorf("%s: expected rotate %v, got %v", tt.name, tt.rotate, rotate)
+		}
+	}
+}
+
+func TestNewSessionToken(t *testing.T) {
+	token, hash := NewSessionToken()
+	if token == hash || HashSessionToken(token) != hash {
+		t.Errorf("Expected the hash of the token, got %s", hash)
+	}
+	if other, _ := NewSessionToken(); other == token {
+		t.Error("Expected a new token every time")
+	}
+}
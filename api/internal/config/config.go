@@ -0,0 +1,300 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/envelope"
+	"github.com/joho/godotenv"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// minProductionSecretSize is the shortest SESSION_SECRET accepted in production, the size of the HMAC key it becomes.
+	minProductionSecretSize = 32
+)
+
+var oidcNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Config is every setting of the server and the commands, read once at startup by Load.
+type Config struct {
+	Environment string
+	Addr        string
+	DBPath      string
+	// AutoMigrate lets serve apply pending migrations. Without it serve refuses to start until they are applied.
+	AutoMigrate bool
+	// FrontendURL is the web app's origin, allowed by CORS and used in email login links.
+	FrontendURL string
+	// SessionSecret signs the cookie that carries an OAuth login between the code URL and the callback.
+	SessionSecret  string
+	TrashRetention time.Duration
+
+	Google  OAuthClient
+	GitHub  OAuthClient
+	Discord OAuthClient
+	OIDC    []OIDCProvider
+
+	// TokenKeys encrypts stored OAuth tokens. It is nil when no keys are set, and tokens are stored in plaintext.
+	TokenKeys *envelope.Keyring
+	Mailer    Mailer
+	Backup    Backup
+}
+
+// OAuthClient is the client registered with a built-in provider. A provider without a client ID is turned off.
+type OAuthClient struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+func (c OAuthClient) Enabled() bool {
+	return c.ClientID != ""
+}
+
+// OIDCProvider is a named OpenID Connect provider, such as a Keycloak realm or an Authentik application.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Mailer picks how emails are sent: "log" writes them to the server log, "file" appends them to File and "smtp"
+// sends them through the SMTP server.
+type Mailer struct {
+	Kind         string
+	File         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
+// Backup sets up the snapshots serve writes to Dir every Interval. Only the Keep newest are kept, and when MaxAge
+// is set those older than it are deleted too. An empty Dir turns scheduled backups off.
+type Backup struct {
+	Dir      string
+	Interval time.Duration
+	Keep     int
+	MaxAge   time.Duration
+}
+
+// Production reports whether the server runs in production, where cookies are only sent over HTTPS.
+func (c *Config) Production() bool {
+	return c.Environment == EnvProduction
+}
+
+// Load reads the configuration. Values come from, lowest precedence first: defaults, the dotenv style file named
+// by --config or CONFIG_FILE, the environment, and the flags at the start of args. It returns the arguments after
+// the flags, and an error for any value that is set but invalid.
+func Load(args []string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("vocab-thing", flag.ContinueOnError)
+	// The caller prints the usage, and reports a bad flag as any other error.
+	flags.SetOutput(io.Discard)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "dotenv style file to read settings from")
+	dbPath := flags.String("db", "", "SQLite database path, overriding DB_PATH")
+	addr := flags.String("addr", "", "address the server listens on, overriding ADDR")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+	if *file != "" {
+		read, err := godotenv.Read(*file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config: reading %s: %w", *file, err)
+		}
+		values = read
+	}
+	l := loader{file: values}
+
+	c := &Config{
+		Environment:   l.get("ENVIRONMENT", EnvDevelopment),
+		Addr:          l.get("ADDR", ":8080"),
+		DBPath:        l.get("DB_PATH", "../db/app.db"),
+		FrontendURL:   strings.TrimSuffix(l.get("FRONTEND_URL", ""), "/"),
+		SessionSecret: l.get("SESSION_SECRET", ""),
+		Google:        l.client("GOOGLE"),
+		GitHub:        l.client("GITHUB"),
+		Discord:       l.client("DISCORD"),
+		Mailer: Mailer{
+			Kind:         l.get("MAILER", "log"),
+			File:         l.get("MAIL_FILE", "mail.log"),
+			SMTPHost:     l.get("SMTP_HOST", ""),
+			SMTPPort:     l.get("SMTP_PORT", "587"),
+			SMTPUsername: l.get("SMTP_USERNAME", ""),
+			SMTPPassword: l.get("SMTP_PASSWORD", ""),
+			From:         l.get("MAIL_FROM", ""),
+		},
+	}
+	if *dbPath != "" {
+		c.DBPath = *dbPath
+	}
+	if *addr != "" {
+		c.Addr = *addr
+	}
+
+	var errs []error
+	var err error
+	if c.AutoMigrate, err = strconv.ParseBool(l.get("AUTO_MIGRATE", "true")); err != nil {
+		errs = append(errs, fmt.Errorf("AUTO_MIGRATE must be true or false"))
+	}
+	days, err := strconv.Atoi(l.get("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || days < 1 {
+		errs = append(errs, fmt.Errorf("TRASH_RETENTION_DAYS must be a whole number of days, at least 1"))
+	}
+	c.TrashRetention = time.Duration(days) * 24 * time.Hour
+
+	c.Backup.Dir = l.get("BACKUP_DIR", "")
+	hours, err := strconv.Atoi(l.get("BACKUP_INTERVAL_HOURS", "24"))
+	if err != nil || hours < 1 {
+		errs = append(errs, fmt.Errorf("BACKUP_INTERVAL_HOURS must be a whole number of hours, at least 1"))
+	}
+	c.Backup.Interval = time.Duration(hours) * time.Hour
+	if c.Backup.Keep, err = strconv.Atoi(l.get("BACKUP_KEEP", "7")); err != nil || c.Backup.Keep < 1 {
+		errs = append(errs, fmt.Errorf("BACKUP_KEEP must be a whole number, at least 1"))
+	}
+	maxAgeDays, err := strconv.Atoi(l.get("BACKUP_MAX_AGE_DAYS", "0"))
+	if err != nil || maxAgeDays < 0 {
+		errs = append(errs, fmt.Errorf("BACKUP_MAX_AGE_DAYS must be a whole number of days, or 0 for no limit"))
+	}
+	c.Backup.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+
+	for _, name := range strings.Split(l.get("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		c.OIDC = append(c.OIDC, OIDCProvider{
+			Name:         name,
+			Issuer:       l.get(prefix+"ISSUER", ""),
+			ClientID:     l.get(prefix+"CLIENT_ID", ""),
+			ClientSecret: l.get(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  l.get(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(l.get(prefix+"SCOPES", "")),
+		})
+	}
+
+	if keys := l.get("TOKEN_ENCRYPTION_KEYS", ""); strings.TrimSpace(keys) != "" {
+		if c.TokenKeys, err = envelope.ParseKeys(keys, l.get("TOKEN_ENCRYPTION_KEY_ID", "")); err != nil {
+			errs = append(errs, fmt.Errorf("TOKEN_ENCRYPTION_KEYS: %w", err))
+		}
+	}
+
+	errs = append(errs, c.validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+	return c, flags.Args(), nil
+}
+
+// validate checks the values every command relies on. Values only the server needs are checked by ValidateServer.
+func (c *Config) validate() error {
+	var errs []error
+	if c.Environment != EnvDevelopment && c.Environment != EnvProduction {
+		errs = append(errs, fmt.Errorf("ENVIRONMENT must be %s or %s, got %q", EnvDevelopment, EnvProduction, c.Environment))
+	}
+	if c.DBPath == "" {
+		errs = append(errs, errors.New("DB_PATH must not be empty"))
+	}
+	if c.FrontendURL != "" {
+		if u, err := url.Parse(c.FrontendURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("FRONTEND_URL must be an absolute URL, got %q", c.FrontendURL))
+		}
+	}
+
+	clients := []struct {
+		prefix string
+		client OAuthClient
+	}{{"GOOGLE", c.Google}, {"GITHUB", c.GitHub}, {"DISCORD", c.Discord}}
+	for _, p := range clients {
+		if p.client.Enabled() && (p.client.ClientSecret == "" || p.client.RedirectURL == "") {
+			errs = append(errs, fmt.Errorf("%s_CLIENT_ID is set, so %s_CLIENT_SECRET and %s_REDIRECT_URL are required", p.prefix, p.prefix, p.prefix))
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, p := range c.OIDC {
+		switch {
+		case !oidcNameRegexp.MatchString(p.Name):
+			errs = append(errs, fmt.Errorf("invalid oidc provider name %q", p.Name))
+		case seen[p.Name]:
+			errs = append(errs, fmt.Errorf("oidc provider %q is listed twice", p.Name))
+		case p.Issuer == "" || p.ClientID == "":
+			errs = append(errs, fmt.Errorf("oidc provider %q needs an issuer and client id", p.Name))
+		}
+		seen[p.Name] = true
+	}
+
+	switch c.Mailer.Kind {
+	case "log", "file":
+	case "smtp":
+		if c.Mailer.SMTPHost == "" || c.Mailer.From == "" {
+			errs = append(errs, errors.New("the smtp mailer needs SMTP_HOST and MAIL_FROM"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown MAILER %q, expected log, file or smtp", c.Mailer.Kind))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateServer checks the values the HTTP server cannot run without, so serve fails at startup rather than on
+// the first login.
+func (c *Config) ValidateServer() error {
+	var errs []error
+	if c.SessionSecret == "" {
+		errs = append(errs, errors.New("SESSION_SECRET is required"))
+	} else if c.Production() && len(c.SessionSecret) < minProductionSecretSize {
+		errs = append(errs, fmt.Errorf("SESSION_SECRET must be at least %d characters in production", minProductionSecretSize))
+	}
+	if c.FrontendURL == "" {
+		errs = append(errs, errors.New("FRONTEND_URL is required"))
+	}
+	if c.Addr == "" {
+		errs = append(errs, errors.New("ADDR must not be empty"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// loader looks values up in the environment first and then in the config file.
+type loader struct {
+	file map[string]string
+}
+
+// get treats an empty value as unset, so "MAILER=" in a .env file means the default.
+func (l loader) get(key, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	if v := strings.TrimSpace(l.file[key]); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (l loader) client(prefix string) OAuthClient {
+	return OAuthClient{
+		ClientID:     l.get(prefix+"_CLIENT_ID", ""),
+		ClientSecret: l.get(prefix+"_CLIENT_SECRET", ""),
+		RedirectURL:  l.get(prefix+"_REDIRECT_URL", ""),
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable the tests rely on, as empty values count as unset.
+func clearEnv(t *testing.T) {
+	for _, key := range []string{"CONFIG_FILE", "ENVIRONMENT", "ADDR", "DB_PATH", "FRONTEND_URL", "SESSION_SECRET",
+		"AUTO_MIGRATE", "TRASH_RETENTION_DAYS", "MAILER", "OIDC_PROVIDERS", "GOOGLE_CLIENT_ID", "TOKEN_ENCRYPTION_KEYS",
+		"BACKUP_DIR", "BACKUP_INTERVAL_HOURS", "BACKUP_KEEP", "BACKUP_MAX_AGE_DAYS"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	file := filepath.Join(t.TempDir(), "vocab.env")
+	content := "DB_PATH=/from/file.db\nADDR=:9000\nFRONTEND_URL=https://file.example.com/\nTRASH_RETENTION_DAYS=7\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("ADDR", ":9001")
+
+	cfg, args, err := Load([]string{"--config", file, "--db", "/from/flag.db", "migrate", "status"})
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if cfg.DBPath != "/from/flag.db" {
+		t.Errorf("Expected the flag to win, got %s", cfg.DBPath)
+	}
+	if cfg.Addr != ":9001" {
+		t.Errorf("Expected the environment to win over the file, got %s", cfg.Addr)
+	}
+	if cfg.FrontendURL != "https://file.example.com" {
+		t.Errorf("Expected the file value without the trailing slash, got %s", cfg.FrontendURL)
+	}
+	if cfg.TrashRetention != 7*24*time.Hour {
+		t.Errorf("Expected 7 days of trash retention, got %s", cfg.TrashRetention)
+	}
+	if !cfg.AutoMigrate || cfg.Environment != EnvDevelopment || cfg.Mailer.Kind != "log" || cfg.Backup.Dir != "" || cfg.Backup.Keep != 7 {
+		t.Errorf("Expected defaults for unset values, got %+v", cfg)
+	}
+	if strings.Join(args, " ") != "migrate status" {
+		t.Errorf("Expected the command arguments back, got %v", args)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"Environment", map[string]string{"ENVIRONMENT": "staging"}, "ENVIRONMENT"},
+		{"Auto Migrate", map[string]string{"AUTO_MIGRATE": "sometimes"}, "AUTO_MIGRATE"},
+		{"Trash Retention", map[string]string{"TRASH_RETENTION_DAYS": "0"}, "TRASH_RETENTION_DAYS"},
+		{"Frontend URL", map[string]string{"FRONTEND_URL": "localhost:3000"}, "FRONTEND_URL"},
+		{"Partial Client", map[string]string{"GOOGLE_CLIENT_ID": "id"}, "GOOGLE_CLIENT_SECRET"},
+		{"OIDC Without Issuer", map[string]string{"OIDC_PROVIDERS": "sso"}, "issuer"},
+		{"SMTP Without Host", map[string]string{"MAILER": "smtp"}, "SMTP_HOST"},
+		{"Token Keys", map[string]string{"TOKEN_ENCRYPTION_KEYS": "one:short"}, "TOKEN_ENCRYPTION_KEYS"},
+		{"Backup Keep", map[string]string{"BACKUP_KEEP": "0"}, "BACKUP_KEEP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, _, err := Load(nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error about %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	clearEnv(t)
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	err = cfg.ValidateServer()
+	if err == nil || !strings.Contains(err.Error(), "SESSION_SECRET") || !strings.Contains(err.Error(), "FRONTEND_URL") {
+		t.Errorf("Expected the missing secret and frontend to be reported together, got %v", err)
+	}
+
+	cfg.SessionSecret = "short"
+	cfg.FrontendURL = "https://example.com"
+	if err := cfg.ValidateServer(); err != nil {
+		t.Errorf("Expected a short secret to be fine in development, got %v", err)
+	}
+	cfg.Environment = EnvProduction
+	if err := cfg.ValidateServer(); err == nil {
+		t.Error("Expected a short secret to be refused in production")
+	}
+	cfg.SessionSecret = strings.Repeat("s", minProductionSecretSize)
+	if err := cfg.ValidateServer(); err != nil {
+		t.Errorf("Expected a long secret to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotPrefix = "vocab-thing-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102T150405Z"
+)
+
+var (
+	// ErrBackupCorrupt means a backup failed SQLite's integrity check.
+	ErrBackupCorrupt = errors.New("backup failed the integrity check")
+	// ErrDatabaseInUse means another process, such as a running server, has the database open.
+	ErrDatabaseInUse = errors.New("database is in use, stop the server first")
+)
+
+// Backup writes a consistent copy of the database to path with VACUUM INTO, while the database stays in use. The
+// copy is compacted and holds no write-ahead log, so it is a single file that can be opened as it is. It is written
+// under a temporary name and only renamed to path once it passes CheckBackup.
+func Backup(ctx context.Context, db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup %s already exists", path)
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backing up to %s: %w", path, err)
+	}
+	if _, err := CheckBackup(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backing up to %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("backing up to %s: %w", path, err)
+	}
+	return nil
+}
+
+// CheckBackup opens a backup read-only, runs SQLite's integrity check on it and returns its schema version. It
+// returns ErrSchemaTooNew for a backup taken by a newer build, which this one cannot run against.
+func CheckBackup(ctx context.Context, path string) (int64, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return 0, fmt.Errorf("opening backup %s: %w", path, err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return 0, fmt.Errorf("checking backup %s: %w", path, err)
+	}
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("checking backup %s: %w", path, err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("checking backup %s: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return 0, fmt.Errorf("%w: %s", ErrBackupCorrupt, strings.Join(problems, "; "))
+	}
+
+	var tables int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, migrationTable).Scan(&tables)
+	if err != nil {
+		return 0, fmt.Errorf("checking backup %s: %w", path, err)
+	}
+	if tables == 0 {
+		return 0, fmt.Errorf("backup %s has no migration table, it is not a vocab-thing database", path)
+	}
+	applied, err := readAppliedMigrations(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	versions := slices.Sorted(maps.Keys(applied))
+	if err := checkKnown(migrations, versions); err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Snapshot backs the database up into dir under a name carrying the time, for PruneSnapshots to sort by.
+func Snapshot(ctx context.Context, db *sql.DB, dir string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating backup directory: %w", err)
+	}
+	path := filepath.Join(dir, snapshotPrefix+now.UTC().Format(snapshotLayout)+snapshotSuffix)
+	if err := Backup(ctx, db, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// SnapshotFile is a backup written by Snapshot.
+type SnapshotFile struct {
+	Path    string
+	TakenAt time.Time
+}
+
+// Snapshots returns the snapshots in dir, newest first. Other files in dir are ignored.
+func Snapshots(dir string) ([]SnapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []SnapshotFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		takenAt, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotFile{Path: filepath.Join(dir, name), TakenAt: takenAt})
+	}
+
+	slices.SortFunc(snapshots, func(a, b SnapshotFile) int {
+		return b.TakenAt.Compare(a.TakenAt)
+	})
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes the snapshots in dir beyond the newest keep, and those older than maxAge when it is set.
+// The newest snapshot is always kept. It returns the deleted paths.
+func PruneSnapshots(dir string, keep int, maxAge time.Duration, now time.Time) ([]string, error) {
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for i, s := range snapshots {
+		if i == 0 {
+			continue
+		}
+		if i < keep && (maxAge <= 0 || now.Sub(s.TakenAt) <= maxAge) {
+			continue
+		}
+		if err := os.Remove(s.Path); err != nil {
+			return deleted, fmt.Errorf("deleting backup: %w", err)
+		}
+		deleted = append(deleted, s.Path)
+	}
+	return deleted, nil
+}
+
+// Restore replaces the database at dbPath with the backup at backupPath, once CheckBackup passes and no other
+// process has the database open. The replaced database is kept next to it, and its path returned.
+func Restore(ctx context.Context, backupPath, dbPath string) (string, error) {
+	if _, err := CheckBackup(ctx, backupPath); err != nil {
+		return "", err
+	}
+
+	// The lock is held until the swap is done, so a server starting in between cannot open the database.
+	release, err := lockDatabase(ctx, dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// The backup is copied next to the database first, so the swap itself is a rename that cannot leave half a file.
+	restoring := dbPath + ".restoring"
+	if err := copyFile(backupPath, restoring); err != nil {
+		os.Remove(restoring)
+		return "", fmt.Errorf("copying backup: %w", err)
+	}
+
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().UTC().Format(snapshotLayout))
+	}
+	if err := swapIn(restoring, dbPath, previous); err != nil {
+		os.Remove(restoring)
+		return "", err
+	}
+	return previous, nil
+}
+
+var databaseSuffixes = []string{"", "-wal", "-shm"}
+
+// swapIn moves the database at dbPath, with its -wal and -shm files, aside to previous and restoring into its
+// place. If any rename fails the database is moved back, so a failed restore leaves it as it was. An empty
+// previous means there is no database to move aside.
+func swapIn(restoring, dbPath, previous string) error {
+	var moved []string
+	moveBack := func(err error) error {
+		for _, suffix := range moved {
+			if backErr := os.Rename(previous+suffix, dbPath+suffix); backErr != nil {
+				return fmt.Errorf("%w, and moving the database back from %s failed: %v", err, previous, backErr)
+			}
+		}
+		return err
+	}
+
+	if previous != "" {
+		for _, suffix := range databaseSuffixes {
+			err := os.Rename(dbPath+suffix, previous+suffix)
+			if suffix != "" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return moveBack(fmt.Errorf("moving the current database aside: %w", err))
+			}
+			moved = append(moved, suffix)
+		}
+	}
+
+	if err := os.Rename(restoring, dbPath); err != nil {
+		return moveBack(fmt.Errorf("moving the backup into place: %w", err))
+	}
+	return nil
+}
+
+// lockDatabase takes an exclusive lock on the database, which SQLite refuses while any other connection has it
+// open in WAL mode, and holds it until release is called. A missing database is not in use.
+func lockDatabase(ctx context.Context, dbPath string) (release func(), err error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return func() {}, nil
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_locking_mode=EXCLUSIVE&_busy_timeout=0", dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	// In exclusive locking mode the lock outlives the transaction, for as long as this connection stays open.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, lockError(err)
+	}
+	release = func() {
+		conn.Close()
+		db.Close()
+	}
+
+	if _, err := conn.ExecContext(ctx, `BEGIN EXCLUSIVE; COMMIT;`); err != nil {
+		release()
+		return nil, lockError(err)
+	}
+	return release, nil
+}
+
+// lockError reports a refused lock as ErrDatabaseInUse. Opening the connection can already be refused, as the
+// locking mode is set as it opens.
+func lockError(err error) error {
+	if strings.Contains(err.Error(), "locked") || strings.Contains(err.Error(), "busy") {
+		return ErrDatabaseInUse
+	}
+	return fmt.Errorf("locking database: %w", err)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
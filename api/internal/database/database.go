@@ -4,12 +4,17 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func SetupDatabase(dbPath string) (*sql.DB, error) {
-	fmt.Println("Setting up database")
+	log.Println("Setting up database")
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
 	connURL := fmt.Sprintf("file:%s?_foreign_keys=1&_journal_mode=WAL", dbPath)
 	db, err := sql.Open("sqlite3", connURL)
 	if err != nil {
@@ -24,3 +29,12 @@ func SetupDatabase(dbPath string) (*sql.DB, error) {
 	log.Println("SQLite database successfully opened")
 	return db, nil
 }
+
+// Close folds the write-ahead log back into the database file and closes it, so a stopped server leaves a single
+// file behind. It is called once nothing uses the database any more.
+func Close(db *sql.DB) error {
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		log.Printf("error checkpointing database: %s", err.Error())
+	}
+	return db.Close()
+}
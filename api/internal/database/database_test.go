@@ -1,11 +1,33 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
+// newTestDB returns a migrated database that is closed when the test ends.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := SetupDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := MigrateUp(context.Background(), db); err != nil {
+		if strings.Contains(err.Error(), "sqlite_fts5") {
+			t.Skip("Needs the sqlite_fts5 build tag")
+		}
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	return db
+}
+
 func TestSetupDatabase(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "test-db")
 	if err != nil {
@@ -42,3 +64,263 @@ func TestSetupDatabase(t *testing.T) {
 		}
 	})
 }
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Failed to read migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("Expected %s to come after %s", migrations[i].Name, migrations[i-1].Name)
+		}
+	}
+
+	db, err := SetupDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	applied, err := MigrateUp(ctx, db)
+	if err != nil {
+		if strings.Contains(err.Error(), "sqlite_fts5") {
+			t.Skip("Needs the sqlite_fts5 build tag")
+		}
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("Expected %d migrations to be applied, got %d", len(migrations), applied)
+	}
+	if applied, err := MigrateUp(ctx, db); err != nil || applied != 0 {
+		t.Errorf("Expected nothing left to apply, got %d, %v", applied, err)
+	}
+	version, _ := SchemaVersion(ctx, db)
+	if latest, _ := LatestVersion(); version != latest {
+		t.Errorf("Expected schema version %d, got %d", latest, version)
+	}
+
+	// Every down migration must undo its up migration cleanly.
+	for range migrations {
+		if _, err := MigrateDown(ctx, db); err != nil {
+			t.Fatalf("Failed to roll back: %v", err)
+		}
+	}
+	if version, _ := SchemaVersion(ctx, db); version != 0 {
+		t.Errorf("Expected every migration to be rolled back, got version %d", version)
+	}
+	if applied, err := MigrateUp(ctx, db); err != nil || applied != len(migrations) {
+		t.Fatalf("Expected every migration to apply again, got %d, %v", applied, err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO goose_db_version (version_id, is_applied) VALUES (99990101000000, 1)`); err != nil {
+		t.Fatalf("Failed to record a future migration: %v", err)
+	}
+	if _, err := MigrateUp(ctx, db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestJobLock(t *testing.T) {
+	db, err := SetupDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	if _, err := MigrateUp(ctx, db); err != nil {
+		if strings.Contains(err.Error(), "sqlite_fts5") {
+			t.Skip("Needs the sqlite_fts5 build tag")
+		}
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	jobModel := JobModel{DB: db}
+	now := time.Now()
+	if locked, err := jobModel.Acquire(ctx, "cleanup", "a", now, now.Add(time.Minute)); err != nil || !locked {
+		t.Fatalf("Expected the first owner to lock the job, got %v, %v", locked, err)
+	}
+	if locked, _ := jobModel.Acquire(ctx, "cleanup", "b", now, now.Add(time.Minute)); locked {
+		t.Error("Expected a second owner to be refused while the lock holds")
+	}
+	if locked, _ := jobModel.Acquire(ctx, "cleanup", "b", now.Add(2*time.Minute), now.Add(3*time.Minute)); !locked {
+		t.Error("Expected an expired lock to be taken over")
+	}
+
+	if err := jobModel.Finish(ctx, "cleanup", "a", now, now.Add(time.Hour), "stale", nil); err != nil {
+		t.Fatalf("Failed to finish: %v", err)
+	}
+	later := now.Add(3 * time.Minute)
+	if err := jobModel.Finish(ctx, "cleanup", "b", later, later.Add(time.Hour), "", errors.New("boom")); err != nil {
+		t.Fatalf("Failed to finish: %v", err)
+	}
+	if locked, _ := jobModel.Acquire(ctx, "cleanup", "a", later.Add(time.Minute), later.Add(2*time.Minute)); locked {
+		t.Error("Expected the job to wait for its next run")
+	}
+
+	jobs, err := jobModel.All(ctx, later)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %v, %v", jobs, err)
+	}
+	job := jobs[0]
+	if job.Running || job.Runs != 1 || job.Failures != 1 || job.LastError != "boom" || job.LastResult != "" {
+		t.Errorf("Expected only the current owner's failed run to be recorded, got %+v", job)
+	}
+	if job.NextRunAt == nil || !job.NextRunAt.Equal(later.Add(time.Hour).Truncate(time.Second)) {
+		t.Errorf("Expected the next run an hour after the last, got %v", job.NextRunAt)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 4, 13, 12, 0, 0, 0, time.UTC)
+	for _, daysAgo := range []int{0, 1, 2, 3, 10} {
+		name := snapshotPrefix + now.AddDate(0, 0, -daysAgo).Format(snapshotLayout) + snapshotSuffix
+		os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o600)
+
+	deleted, err := PruneSnapshots(dir, 4, 5*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if len(deleted) != 1 || !strings.Contains(deleted[0], now.AddDate(0, 0, -10).Format(snapshotLayout)) {
+		t.Errorf("Expected only the snapshot past the max age to go, got %v", deleted)
+	}
+
+	deleted, _ = PruneSnapshots(dir, 2, 0, now)
+	snapshots, _ := Snapshots(dir)
+	if len(deleted) != 2 || len(snapshots) != 2 || !snapshots[0].TakenAt.Equal(now) {
+		t.Errorf("Expected the 2 newest snapshots to be kept, got %v", snapshots)
+	}
+
+	deleted, _ = PruneSnapshots(dir, 1, time.Hour, now.AddDate(1, 0, 0))
+	if len(deleted) != 1 {
+		t.Errorf("Expected the newest snapshot to be kept whatever its age, deleted %v", deleted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("Expected other files to be left alone, got %v", err)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	db, err := SetupDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	if _, err := MigrateUp(ctx, db); err != nil {
+		if strings.Contains(err.Error(), "sqlite_fts5") {
+			t.Skip("Needs the sqlite_fts5 build tag")
+		}
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	db.Exec(`INSERT INTO job_runs (name) VALUES ('before-backup')`)
+
+	backupPath, err := Snapshot(ctx, db, filepath.Join(dir, "backups"), time.Now())
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	version, err := CheckBackup(ctx, backupPath)
+	if latest, _ := LatestVersion(); err != nil || version != latest {
+		t.Errorf("Expected a good backup at version %d, got %d, %v", latest, version, err)
+	}
+	db.Exec(`INSERT INTO job_runs (name) VALUES ('after-backup')`)
+
+	if _, err := Restore(ctx, backupPath, dbPath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("Expected restore to refuse an open database, got %v", err)
+	}
+	db.Close()
+
+	previous, err := Restore(ctx, backupPath, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	replaced, err := SetupDatabase(previous)
+	if err != nil {
+		t.Fatalf("Expected the replaced database to be kept, got %v", err)
+	}
+	defer replaced.Close()
+	var kept int
+	replaced.QueryRow(`SELECT COUNT(*) FROM job_runs`).Scan(&kept)
+	if kept != 2 {
+		t.Errorf("Expected the replaced database to keep every row, got %d", kept)
+	}
+	restored, _ := SetupDatabase(dbPath)
+	defer restored.Close()
+	var names int
+	restored.QueryRow(`SELECT COUNT(*) FROM job_runs`).Scan(&names)
+	if names != 1 {
+		t.Errorf("Expected only the rows from before the backup, got %d", names)
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte(strings.Repeat("not a database", 512)), 0o600)
+	if _, err := Restore(ctx, garbage, dbPath); err == nil {
+		t.Error("Expected a file that is not a database to be refused")
+	}
+
+	restored.Exec(`INSERT INTO ` + migrationTable + ` (version_id, is_applied) VALUES (99999999999999, 1)`)
+	newer := filepath.Join(dir, "newer.db")
+	if err := Backup(ctx, restored, newer); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected a backup with an unknown migration to fail its check, got %v", err)
+	}
+}
+
+func TestLockDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "app.db")
+	db, err := SetupDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	db.Exec(`CREATE TABLE notes (body TEXT)`)
+	db.Close()
+	ctx := context.Background()
+
+	release, err := lockDatabase(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("Failed to lock database: %v", err)
+	}
+	if _, err := lockDatabase(ctx, dbPath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("Expected the lock to be held until released, got %v", err)
+	}
+	release()
+
+	release, err = lockDatabase(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free once released, got %v", err)
+	}
+	release()
+}
+
+func TestSwapInRollback(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	previous := dbPath + ".pre-restore"
+	for _, suffix := range []string{"", "-wal"} {
+		if err := os.WriteFile(dbPath+suffix, []byte("current"+suffix), 0o600); err != nil {
+			t.Fatalf("Failed to write database: %v", err)
+		}
+	}
+
+	// A missing backup makes the final rename fail after the database was moved aside.
+	if err := swapIn(filepath.Join(dir, "missing.restoring"), dbPath, previous); err == nil {
+		t.Fatal("Expected the swap to fail")
+	}
+	for _, suffix := range []string{"", "-wal"} {
+		content, err := os.ReadFile(dbPath + suffix)
+		if err != nil || string(content) != "current"+suffix {
+			t.Errorf("Expected %s to be moved back, got %q, %v", dbPath+suffix, content, err)
+		}
+		if _, err := os.Stat(previous + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected nothing left at %s, got %v", previous+suffix, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+)
+
+type EmailTokenModel struct {
+	DB *sql.DB
+}
+
+// CreateLimited stores an email login token by its hash, unless limit tokens were already sent to the email since
+// the given time, when it returns ErrTooManyEmails. Counting and inserting are one statement, so concurrent requests
+// cannot both slip under the limit. The plain token only ever exists in the email.
+func (m *EmailTokenModel) CreateLimited(ctx context.Context, email, hash string, expiresAt, since time.Time, limit int) error {
+	query := `
+		INSERT INTO email_login_tokens (id, email, tokenHash, expiresAt, createdAt)
+		SELECT lower(hex(randomblob(16))), ?, ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM email_login_tokens WHERE email = ? AND datetime(createdAt) >= datetime(?)) < ?
+	`
+	res, err := m.DB.ExecContext(ctx, query, email, hash, expiresAt.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339),
+		email, since.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		log.Printf("error with email login token creation for %s: %s", email, err.Error())
+		return errorcode.ErrDBCreate
+	}
+
+	created, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBCreate
+	}
+	if created == 0 {
+		return errorcode.ErrTooManyEmails
+	}
+
+	return nil
+}
+
+// Consume marks an unexpired, unused token as used and returns its email. Marking and checking happen in
+// one statement, so two requests racing with the same token cannot both sign in.
+func (m *EmailTokenModel) Consume(ctx context.Context, hash string) (string, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	query := `
+		UPDATE email_login_tokens
+		SET usedAt = ?
+		WHERE tokenHash = ? AND usedAt IS NULL AND datetime(expiresAt) > datetime(?)
+		RETURNING email
+	`
+	var email string
+	if err := m.DB.QueryRowContext(ctx, query, now, hash, now).Scan(&email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errorcode.ErrInvalidLoginToken
+		}
+		log.Printf("error consuming email login token: %s", err.Error())
+		return "", errorcode.ErrDBUpdate
+	}
+
+	return email, nil
+}
+
+// DeleteExpired removes tokens that expired before the given time, used or not.
+func (m *EmailTokenModel) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM email_login_tokens WHERE datetime(expiresAt) < datetime(?)`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("error deleting expired email login tokens: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+
+	return deleted, nil
+}
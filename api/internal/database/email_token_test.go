@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+)
+
+func TestEmailTokenLimit(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	tokenModel := EmailTokenModel{DB: db}
+	now := time.Now()
+	window := now.Add(-time.Hour)
+
+	t.Run("Concurrent Requests", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- tokenModel.CreateLimited(ctx, "race@example.com", fmt.Sprintf("hash-%d", i), now.Add(15*time.Minute), window, 5)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		created := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, errorcode.ErrTooManyEmails):
+				t.Errorf("Expected ErrTooManyEmails, got %v", err)
+			}
+		}
+		if created != 5 {
+			t.Errorf("Expected 5 tokens to be created, got %d", created)
+		}
+	})
+
+	t.Run("Expired Tokens Still Count", func(t *testing.T) {
+		// Sent 40 minutes ago, so it expired 25 minutes ago but is still inside the hour.
+		_, err := db.Exec(`INSERT INTO email_login_tokens (id, email, tokenHash, expiresAt, createdAt) VALUES ('old', ?, 'old-hash', ?, ?)`,
+			"expired@example.com", now.Add(-25*time.Minute).UTC().Format(time.RFC3339), now.Add(-40*time.Minute).UTC().Format(time.RFC3339))
+		if err != nil {
+			t.Fatalf("Failed to insert token: %v", err)
+		}
+		if _, err := tokenModel.DeleteExpired(ctx, window); err != nil {
+			t.Fatalf("Failed to delete expired tokens: %v", err)
+		}
+		if err := tokenModel.CreateLimited(ctx, "expired@example.com", "new-hash", now.Add(15*time.Minute), window, 1); !errors.Is(err, errorcode.ErrTooManyEmails) {
+			t.Errorf("Expected the expired token to count towards the limit, got %v", err)
+		}
+		if deleted, err := tokenModel.DeleteExpired(ctx, now); err != nil || deleted == 0 {
+			t.Errorf("Expected the expired token to be deleted once the window is ignored, got %d, %v", deleted, err)
+		}
+	})
+}
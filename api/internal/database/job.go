@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/utils"
+)
+
+// JobModel keeps the lock and last run of each background job, so servers sharing the database run a job once.
+type JobModel struct {
+	DB *sql.DB
+}
+
+// Acquire locks the job for owner until lockUntil, if it is due and no other owner holds an unexpired lock. A lock
+// that outlives its run, as after a crash, simply expires.
+func (m *JobModel) Acquire(ctx context.Context, name, owner string, now, lockUntil time.Time) (bool, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return false, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO job_runs (name) VALUES (?)`, name); err != nil {
+		log.Printf("error creating job %s: %s", name, err.Error())
+		return false, errorcode.ErrDBCreate
+	}
+
+	nowStr := now.UTC().Format(time.RFC3339)
+	query := `UPDATE job_runs SET lockedBy = ?, lockedUntil = ?, lastStartedAt = ?
+		WHERE name = ?
+		AND (lockedUntil IS NULL OR datetime(lockedUntil) <= datetime(?))
+		AND (nextRunAt IS NULL OR datetime(nextRunAt) <= datetime(?))`
+	res, err := tx.ExecContext(ctx, query, owner, lockUntil.UTC().Format(time.RFC3339), nowStr, name, nowStr, nowStr)
+	if err != nil {
+		log.Printf("error locking job %s: %s", name, err.Error())
+		return false, errorcode.ErrDBUpdate
+	}
+	locked, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return false, errorcode.ErrDBUpdate
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return false, errorcode.ErrTransactionCommit
+	}
+	return locked == 1, nil
+}
+
+// Finish releases owner's lock on the job and records how the run went and when the job is next due.
+func (m *JobModel) Finish(ctx context.Context, name, owner string, finishedAt, nextRunAt time.Time, result string, runErr error) error {
+	var lastError string
+	failed := 0
+	if runErr != nil {
+		lastError = runErr.Error()
+		failed = 1
+	}
+
+	query := `UPDATE job_runs SET lockedBy = NULL, lockedUntil = NULL, lastFinishedAt = ?, lastResult = NULLIF(?, ''),
+		lastError = NULLIF(?, ''), nextRunAt = ?, runs = runs + 1, failures = failures + ?
+		WHERE name = ? AND lockedBy = ?`
+	_, err := m.DB.ExecContext(ctx, query, finishedAt.UTC().Format(time.RFC3339), result, lastError,
+		nextRunAt.UTC().Format(time.RFC3339), failed, name, owner)
+	if err != nil {
+		log.Printf("error finishing job %s: %s", name, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	return nil
+}
+
+// All returns every job that has run or tried to, by name.
+func (m *JobModel) All(ctx context.Context, now time.Time) ([]models.JobRun, error) {
+	query := `SELECT name, lockedBy, lockedUntil IS NOT NULL AND datetime(lockedUntil) > datetime(?),
+		lastStartedAt, lastFinishedAt, lastResult, lastError, nextRunAt, runs, failures
+		FROM job_runs ORDER BY name`
+
+	rows, err := m.DB.QueryContext(ctx, query, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("querying jobs: %s", err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	jobs := []models.JobRun{}
+	for rows.Next() {
+		var job models.JobRun
+		var lockedBy, lastStartedAt, lastFinishedAt, lastResult, lastError, nextRunAt sql.NullString
+		err := rows.Scan(&job.Name, &lockedBy, &job.Running, &lastStartedAt, &lastFinishedAt, &lastResult, &lastError,
+			&nextRunAt, &job.Runs, &job.Failures)
+		if err != nil {
+			log.Printf("scanning job row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		if job.Running {
+			job.LockedBy = lockedBy.String
+		}
+		job.LastResult = lastResult.String
+		job.LastError = lastError.String
+		job.LastStartedAt = parseJobTime(job.Name, "lastStartedAt", lastStartedAt)
+		job.LastFinishedAt = parseJobTime(job.Name, "lastFinishedAt", lastFinishedAt)
+		job.NextRunAt = parseJobTime(job.Name, "nextRunAt", nextRunAt)
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating job rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return jobs, nil
+}
+
+func parseJobTime(name, column string, value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t, err := utils.StringToTime(value.String)
+	if err != nil {
+		log.Printf("Warning: could not parse %s '%s' for job %s", column, value.String, name)
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/utils"
+)
+
+type MFAModel struct {
+	DB *sql.DB
+}
+
+// ByUserID returns the user's TOTP enrollment, confirmed or not, or sql.ErrNoRows if there is none.
+func (m *MFAModel) ByUserID(ctx context.Context, userID string) (models.MFA, error) {
+	query := `SELECT userId, secret, confirmedAt, lastUsedStep, lockedUntil, createdAt FROM user_mfa WHERE userId = ?`
+
+	var mfa models.MFA
+	var confirmedAtStr, lockedUntilStr sql.NullString
+	var lastUsedStep sql.NullInt64
+	var createdAtStr string
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &confirmedAtStr, &lastUsedStep, &lockedUntilStr, &createdAtStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MFA{}, sql.ErrNoRows
+		}
+		log.Printf("scanning mfa row: %s", err.Error())
+		return models.MFA{}, errorcode.ErrScanningRow
+	}
+
+	mfa.CreatedAt, err = utils.StringToTime(createdAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for mfa of user %s", createdAtStr, userID)
+		mfa.CreatedAt = time.Now().UTC()
+	}
+	if confirmedAtStr.Valid {
+		confirmedAt, err := utils.StringToTime(confirmedAtStr.String)
+		if err != nil {
+			log.Printf("Warning: could not parse confirmedAt '%s' for mfa of user %s", confirmedAtStr.String, userID)
+			confirmedAt = time.Now().UTC()
+		}
+		mfa.ConfirmedAt = &confirmedAt
+	}
+	if lastUsedStep.Valid {
+		mfa.LastUsedStep = &lastUsedStep.Int64
+	}
+	if lockedUntilStr.Valid {
+		lockedUntil, err := utils.StringToTime(lockedUntilStr.String)
+		if err != nil {
+			log.Printf("Warning: could not parse lockedUntil '%s' for mfa of user %s", lockedUntilStr.String, userID)
+			lockedUntil = time.Now().UTC()
+		}
+		mfa.LockedUntil = &lockedUntil
+	}
+
+	return mfa, nil
+}
+
+// Enabled reports whether the user has confirmed a TOTP enrollment.
+func (m *MFAModel) Enabled(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_mfa WHERE userId = ? AND confirmedAt IS NOT NULL)`
+	if err := m.DB.QueryRowContext(ctx, query, userID).Scan(&enabled); err != nil {
+		log.Printf("checking mfa of user %s: %s", userID, err.Error())
+		return false, errorcode.ErrDBQuery
+	}
+
+	return enabled, nil
+}
+
+// Enroll stores a new unconfirmed secret, replacing an earlier unconfirmed one. A confirmed enrollment is left alone.
+func (m *MFAModel) Enroll(ctx context.Context, userID, secret string) error {
+	query := `
+		INSERT INTO user_mfa (userId, secret, createdAt) VALUES (?, ?, ?)
+		ON CONFLICT (userId) DO UPDATE SET secret = excluded.secret, lastUsedStep = NULL, createdAt = excluded.createdAt
+		WHERE user_mfa.confirmedAt IS NULL
+	`
+	res, err := m.DB.ExecContext(ctx, query, userID, secret, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("error enrolling mfa of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBCreate
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBCreate
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrMFAEnabled
+	}
+
+	return nil
+}
+
+// Confirm enables an enrollment once the user proved their app has the secret, and stores the hashes of fresh recovery codes.
+func (m *MFAModel) Confirm(ctx context.Context, userID string, step int64, codeHashes []string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE user_mfa SET confirmedAt = ?, lastUsedStep = ? WHERE userId = ? AND confirmedAt IS NULL`
+	res, err := tx.ExecContext(ctx, query, time.Now().UTC().Format(time.RFC3339), step, userID)
+	if err != nil {
+		log.Printf("error confirming mfa of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrMFAEnabled
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+// UseStep records a time step as used, failing if it is not newer than the last one, so each code works once.
+func (m *MFAModel) UseStep(ctx context.Context, userID string, step int64) error {
+	query := `UPDATE user_mfa SET lastUsedStep = ? WHERE userId = ? AND (lastUsedStep IS NULL OR lastUsedStep < ?)`
+	res, err := m.DB.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		log.Printf("error recording mfa step of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// UseRecoveryCode spends one of the user's unused recovery codes.
+func (m *MFAModel) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	query := `UPDATE mfa_recovery_codes SET usedAt = ? WHERE userId = ? AND codeHash = ? AND usedAt IS NULL`
+	res, err := m.DB.ExecContext(ctx, query, time.Now().UTC().Format(time.RFC3339), userID, codeHash)
+	if err != nil {
+		log.Printf("error using recovery code of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// RecordFailure counts a wrong code against the user, whichever session sent it. The maxAttempts-th wrong code in a
+// row locks the second factor until lockedUntil and starts the count again. It reports whether this code locked it.
+func (m *MFAModel) RecordFailure(ctx context.Context, userID string, maxAttempts int, lockedUntil time.Time) (bool, error) {
+	// SQLite evaluates every SET expression against the row as it was, so both see the old count.
+	query := `
+		UPDATE user_mfa SET
+			failedAttempts = CASE WHEN failedAttempts + 1 >= ? THEN 0 ELSE failedAttempts + 1 END,
+			lockedUntil = CASE WHEN failedAttempts + 1 >= ? THEN ? ELSE lockedUntil END
+		WHERE userId = ?
+		RETURNING failedAttempts = 0
+	`
+	var locked bool
+	err := m.DB.QueryRowContext(ctx, query, maxAttempts, maxAttempts, lockedUntil.UTC().Format(time.RFC3339), userID).Scan(&locked)
+	if err != nil {
+		log.Printf("error recording mfa failure of user %s: %s", userID, err.Error())
+		return false, errorcode.ErrDBUpdate
+	}
+
+	return locked, nil
+}
+
+// ResetFailures clears the user's count of wrong codes once a right one is given.
+func (m *MFAModel) ResetFailures(ctx context.Context, userID string) error {
+	if _, err := m.DB.ExecContext(ctx, `UPDATE user_mfa SET failedAttempts = 0 WHERE userId = ?`, userID); err != nil {
+		log.Printf("error resetting mfa failures of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+
+	return nil
+}
+
+// RecoveryCodesLeft counts the user's unused recovery codes.
+func (m *MFAModel) RecoveryCodesLeft(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE userId = ? AND usedAt IS NULL`
+	if err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		log.Printf("counting recovery codes of user %s: %s", userID, err.Error())
+		return 0, errorcode.ErrDBQuery
+	}
+
+	return count, nil
+}
+
+// ReplaceRecoveryCodes swaps every recovery code of the user, used or not, for new ones.
+func (m *MFAModel) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+// Delete turns MFA off for the user, removing the secret and recovery codes.
+func (m *MFAModel) Delete(ctx context.Context, userID string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE userId = ?`, userID); err != nil {
+		log.Printf("error deleting recovery codes of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBDelete
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE userId = ?`, userID); err != nil {
+		log.Printf("error deleting mfa of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBDelete
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE userId = ?`, userID); err != nil {
+		log.Printf("error deleting recovery codes of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBDelete
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, hash := range codeHashes {
+		query := `INSERT INTO mfa_recovery_codes (id, userId, codeHash, createdAt) VALUES (lower(hex(randomblob(16))), ?, ?, ?)`
+		if _, err := tx.ExecContext(ctx, query, userID, hash, now); err != nil {
+			log.Printf("error creating recovery code of user %s: %s", userID, err.Error())
+			return errorcode.ErrDBCreate
+		}
+	}
+
+	return nil
+}
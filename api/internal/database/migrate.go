@@ -0,0 +1,349 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The migrations are written for goose and embedded, so the binary can bring any database up to date on its own.
+// Applied versions are recorded in goose's own table, so databases migrated with the goose CLI carry on as they are.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const migrationTable = "goose_db_version"
+
+// ErrSchemaTooNew means the database was migrated by a newer build, and this one does not know its schema.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Migrations returns the embedded migrations, oldest first.
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		base := path.Base(name)
+		prefix, _, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: name must start with a numeric version", base)
+		}
+		content, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parseMigration(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", base, err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: base, up: up, down: down})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// parseMigration splits a goose SQL file into its up and down parts. The statement markers are plain comments to
+// SQLite, which runs each part as one script.
+func parseMigration(content string) (up, down string, err error) {
+	_, rest, ok := strings.Cut(content, "-- +goose Up")
+	if !ok {
+		return "", "", errors.New("missing -- +goose Up")
+	}
+	up, down, _ = strings.Cut(rest, "-- +goose Down")
+	if strings.TrimSpace(up) == "" {
+		return "", "", errors.New("empty up migration")
+	}
+	return up, down, nil
+}
+
+// LatestVersion returns the version of the newest embedded migration.
+func LatestVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// ensureMigrationTable creates goose's version table, with the zero version goose starts from, if it is missing.
+func ensureMigrationTable(ctx context.Context, db *sql.DB) error {
+	var exists int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, migrationTable).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("checking migration table: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE `+migrationTable+` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	);
+	INSERT INTO `+migrationTable+` (version_id, is_applied) VALUES (0, 1);`)
+	if err != nil {
+		return fmt.Errorf("creating migration table: %w", err)
+	}
+	return nil
+}
+
+// MigrationStatus is a migration and when it was applied, if it was. Name is empty for a version applied by a
+// newer build.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// appliedMigrations returns when each applied version was applied. As in goose, the latest row of each version
+// decides whether it is applied.
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int64]time.Time, error) {
+	if err := ensureMigrationTable(ctx, db); err != nil {
+		return nil, err
+	}
+	return readAppliedMigrations(ctx, db)
+}
+
+// readAppliedMigrations is appliedMigrations for a database that already has the version table, such as a
+// backup opened read-only.
+func readAppliedMigrations(ctx context.Context, db *sql.DB) (map[int64]time.Time, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version_id, is_applied, tstamp FROM `+migrationTable+` ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("querying applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scanning applied migration: %w", err)
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		if isApplied && version != 0 {
+			applied[version] = appliedAt.Time
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// AppliedVersions returns the versions applied to the database, oldest first.
+func AppliedVersions(ctx context.Context, db *sql.DB) ([]int64, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(applied)), nil
+}
+
+// MigrationStatuses returns every embedded migration with when it was applied, followed by any applied versions this
+// build does not know.
+func MigrationStatuses(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, version := range slices.Sorted(maps.Keys(applied)) {
+		appliedAt := applied[version]
+		statuses = append(statuses, MigrationStatus{Version: version, AppliedAt: &appliedAt})
+	}
+	return statuses, nil
+}
+
+// SchemaVersion returns the newest version applied to the database, or 0 for a fresh one.
+func SchemaVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	applied, err := AppliedVersions(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1], nil
+}
+
+// CheckSchema returns ErrSchemaTooNew if the database has a migration applied that this build does not have.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := AppliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	return checkKnown(migrations, applied)
+}
+
+// checkKnown returns ErrSchemaTooNew if a version is applied that is not among the migrations.
+func checkKnown(migrations []Migration, applied []int64) error {
+	for _, version := range applied {
+		known := slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == version })
+		if !known {
+			return fmt.Errorf("%w: version %d is applied but unknown", ErrSchemaTooNew, version)
+		}
+	}
+	return nil
+}
+
+// PendingMigrations returns the embedded migrations not yet applied to the database, oldest first. It returns
+// ErrSchemaTooNew for a database with a schema newer than this build.
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	if err := CheckSchema(ctx, db); err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := AppliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if !slices.Contains(applied, m.Version) {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies every pending migration, each in its own transaction, and returns how many ran. It refuses to
+// touch a database with a schema newer than this build.
+func MigrateUp(ctx context.Context, db *sql.DB) (int, error) {
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range pending {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return i, err
+		}
+		log.Printf("Applied migration %s", m.Name)
+	}
+	return len(pending), nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migration %s: starting transaction: %w", m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.up); err != nil {
+		// The phrase search migration needs FTS5, which go-sqlite3 only has when built with the sqlite_fts5 tag.
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return fmt.Errorf("migration %s: %w (build with -tags sqlite_fts5)", m.Name, err)
+		}
+		return fmt.Errorf("migration %s: %w", m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+migrationTable+` (version_id, is_applied) VALUES (?, 1)`, m.Version); err != nil {
+		return fmt.Errorf("migration %s: recording version: %w", m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %s: committing: %w", m.Name, err)
+	}
+	return nil
+}
+
+// MigrateDown rolls back the newest applied migration and returns it. The version row is deleted, as newer goose
+// releases do.
+func MigrateDown(ctx context.Context, db *sql.DB) (Migration, error) {
+	if err := CheckSchema(ctx, db); err != nil {
+		return Migration{}, err
+	}
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return Migration{}, err
+	}
+	if version == 0 {
+		return Migration{}, errors.New("no migration to roll back")
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return Migration{}, err
+	}
+	i := slices.IndexFunc(migrations, func(m Migration) bool { return m.Version == version })
+	m := migrations[i]
+	if strings.TrimSpace(m.down) == "" {
+		return Migration{}, fmt.Errorf("migration %s has no down migration", m.Name)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Migration{}, fmt.Errorf("migration %s: starting transaction: %w", m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.down); err != nil {
+		return Migration{}, fmt.Errorf("migration %s: %w", m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+migrationTable+` WHERE version_id = ?`, m.Version); err != nil {
+		return Migration{}, fmt.Errorf("migration %s: removing version: %w", m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Migration{}, fmt.Errorf("migration %s: committing: %w", m.Name, err)
+	}
+
+	log.Printf("Rolled back migration %s", m.Name)
+	return m, nil
+}
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE phrase_reviews (
+  id TEXT PRIMARY KEY,
+  phraseId TEXT UNIQUE NOT NULL,
+  userId TEXT NOT NULL,
+  easeFactor REAL NOT NULL DEFAULT 2.5,
+  interval INT NOT NULL DEFAULT 0,
+  repetitions INT NOT NULL DEFAULT 0,
+  lapses INT NOT NULL DEFAULT 0,
+  dueAt DATETIME NOT NULL,
+  lastReviewedAt DATETIME,
+  createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (phraseId) REFERENCES phrases(id) ON DELETE CASCADE,
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_phrase_reviews_user_due ON phrase_reviews (userId, dueAt);
+
+CREATE TRIGGER update_phrase_reviews_timestamp
+AFTER INSERT ON phrase_reviews
+BEGIN
+    UPDATE sync_metadata SET lastUpdatedAt = CURRENT_TIMESTAMP WHERE userId = NEW.userId;
+end
+;
+
+CREATE TRIGGER update_phrase_reviews_timestamp_update
+AFTER UPDATE ON phrase_reviews
+BEGIN
+    UPDATE sync_metadata SET lastUpdatedAt = CURRENT_TIMESTAMP WHERE userId = NEW.userId;
+end
+;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS update_phrase_reviews_timestamp;
+DROP TRIGGER IF EXISTS update_phrase_reviews_timestamp_update;
+DROP INDEX IF EXISTS idx_phrase_reviews_user_due;
+DROP TABLE IF EXISTS phrase_reviews;
+-- +goose StatementEnd
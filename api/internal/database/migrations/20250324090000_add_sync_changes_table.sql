@@ -0,0 +1,86 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE sync_changes (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  userId TEXT NOT NULL,
+  entityType VARCHAR(16) NOT NULL,
+  entityId TEXT NOT NULL,
+  operation VARCHAR(16) NOT NULL,
+  changedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sync_changes_user_seq ON sync_changes (userId, seq);
+
+INSERT INTO sync_changes (userId, entityType, entityId, operation)
+SELECT userId, 'phrase', id, CASE WHEN deletedAt IS NULL THEN 'create' ELSE 'delete' END
+FROM phrases
+ORDER BY createdAt;
+
+INSERT INTO sync_changes (userId, entityType, entityId, operation)
+SELECT p.userId, 'tag', pt.id, 'create'
+FROM phrase_tags pt
+JOIN phrases p ON p.id = pt.phraseId
+ORDER BY pt.createdAt;
+
+CREATE TRIGGER record_phrases_change
+AFTER INSERT ON phrases
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation) VALUES (NEW.userId, 'phrase', NEW.id, 'create');
+end
+;
+
+CREATE TRIGGER record_phrases_change_update
+AFTER UPDATE ON phrases
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation)
+    VALUES (NEW.userId, 'phrase', NEW.id, CASE
+        WHEN NEW.deletedAt IS NOT NULL AND OLD.deletedAt IS NULL THEN 'delete'
+        WHEN NEW.deletedAt IS NULL AND OLD.deletedAt IS NOT NULL THEN 'create'
+        ELSE 'update'
+    END);
+end
+;
+
+CREATE TRIGGER record_phrases_change_delete
+AFTER DELETE ON phrases
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation) VALUES (OLD.userId, 'phrase', OLD.id, 'delete');
+end
+;
+
+CREATE TRIGGER record_phrase_tags_change
+AFTER INSERT ON phrase_tags
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation)
+    SELECT userId, 'tag', NEW.id, 'create' FROM phrases WHERE id = NEW.phraseId;
+end
+;
+
+CREATE TRIGGER record_phrase_tags_change_update
+AFTER UPDATE ON phrase_tags
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation)
+    SELECT userId, 'tag', NEW.id, 'update' FROM phrases WHERE id = NEW.phraseId;
+end
+;
+
+CREATE TRIGGER record_phrase_tags_change_delete
+AFTER DELETE ON phrase_tags
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation)
+    SELECT userId, 'tag', OLD.id, 'delete' FROM phrases WHERE id = OLD.phraseId;
+end
+;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS record_phrases_change;
+DROP TRIGGER IF EXISTS record_phrases_change_update;
+DROP TRIGGER IF EXISTS record_phrases_change_delete;
+DROP TRIGGER IF EXISTS record_phrase_tags_change;
+DROP TRIGGER IF EXISTS record_phrase_tags_change_update;
+DROP TRIGGER IF EXISTS record_phrase_tags_change_delete;
+DROP INDEX IF EXISTS idx_sync_changes_user_seq;
+DROP TABLE IF EXISTS sync_changes;
+-- +goose StatementEnd
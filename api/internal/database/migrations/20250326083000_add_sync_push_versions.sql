@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE phrases ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE phrase_tags ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE sync_mutations (
+  id TEXT PRIMARY KEY,
+  userId TEXT NOT NULL,
+  clientId VARCHAR(255) NOT NULL,
+  entityType VARCHAR(16) NOT NULL,
+  entityId TEXT NOT NULL,
+  version INT NOT NULL,
+  appliedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (userId, clientId),
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sync_mutations;
+ALTER TABLE phrase_tags DROP COLUMN version;
+ALTER TABLE phrases DROP COLUMN version;
+-- +goose StatementEnd
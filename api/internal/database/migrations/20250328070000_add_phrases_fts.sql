@@ -0,0 +1,79 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE VIRTUAL TABLE phrases_fts USING fts5(
+  phraseId UNINDEXED,
+  userId UNINDEXED,
+  phrase,
+  phraseDefinition,
+  foundIn,
+  tags,
+  tokenize = 'unicode61 remove_diacritics 2',
+  prefix = '2 3'
+);
+
+INSERT INTO phrases_fts (phraseId, userId, phrase, phraseDefinition, foundIn, tags)
+SELECT p.id, p.userId, p.phrase, p.phraseDefinition, COALESCE(p.foundIn, ''),
+  COALESCE((SELECT group_concat(tagName, ' ') FROM phrase_tags WHERE phraseId = p.id), '')
+FROM phrases p;
+
+CREATE TRIGGER phrases_fts_insert
+AFTER INSERT ON phrases
+BEGIN
+    INSERT INTO phrases_fts (phraseId, userId, phrase, phraseDefinition, foundIn, tags)
+    VALUES (NEW.id, NEW.userId, NEW.phrase, NEW.phraseDefinition, COALESCE(NEW.foundIn, ''), '');
+end
+;
+
+CREATE TRIGGER phrases_fts_update
+AFTER UPDATE OF phrase, phraseDefinition, foundIn ON phrases
+BEGIN
+    UPDATE phrases_fts
+    SET phrase = NEW.phrase, phraseDefinition = NEW.phraseDefinition, foundIn = COALESCE(NEW.foundIn, '')
+    WHERE phraseId = NEW.id;
+end
+;
+
+CREATE TRIGGER phrases_fts_delete
+AFTER DELETE ON phrases
+BEGIN
+    DELETE FROM phrases_fts WHERE phraseId = OLD.id;
+end
+;
+
+CREATE TRIGGER phrase_tags_fts_insert
+AFTER INSERT ON phrase_tags
+BEGIN
+    UPDATE phrases_fts
+    SET tags = COALESCE((SELECT group_concat(tagName, ' ') FROM phrase_tags WHERE phraseId = NEW.phraseId), '')
+    WHERE phraseId = NEW.phraseId;
+end
+;
+
+CREATE TRIGGER phrase_tags_fts_update
+AFTER UPDATE OF tagName ON phrase_tags
+BEGIN
+    UPDATE phrases_fts
+    SET tags = COALESCE((SELECT group_concat(tagName, ' ') FROM phrase_tags WHERE phraseId = NEW.phraseId), '')
+    WHERE phraseId = NEW.phraseId;
+end
+;
+
+CREATE TRIGGER phrase_tags_fts_delete
+AFTER DELETE ON phrase_tags
+BEGIN
+    UPDATE phrases_fts
+    SET tags = COALESCE((SELECT group_concat(tagName, ' ') FROM phrase_tags WHERE phraseId = OLD.phraseId), '')
+    WHERE phraseId = OLD.phraseId;
+end
+;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS phrases_fts_insert;
+DROP TRIGGER IF EXISTS phrases_fts_update;
+DROP TRIGGER IF EXISTS phrases_fts_delete;
+DROP TRIGGER IF EXISTS phrase_tags_fts_insert;
+DROP TRIGGER IF EXISTS phrase_tags_fts_update;
+DROP TRIGGER IF EXISTS phrase_tags_fts_delete;
+DROP TABLE IF EXISTS phrases_fts;
+-- +goose StatementEnd
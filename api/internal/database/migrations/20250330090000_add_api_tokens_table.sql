@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE api_tokens (
+  id TEXT PRIMARY KEY,
+  userId TEXT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  tokenHash VARCHAR(64) NOT NULL UNIQUE,
+  prefix VARCHAR(16) NOT NULL,
+  scopes VARCHAR(255) NOT NULL,
+  expiresAt DATETIME,
+  lastUsedAt DATETIME,
+  createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens (userId);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_tokens;
+-- +goose StatementEnd
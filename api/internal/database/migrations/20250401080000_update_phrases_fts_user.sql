@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS phrases_fts_update;
+
+CREATE TRIGGER phrases_fts_update
+AFTER UPDATE OF phrase, phraseDefinition, foundIn, userId ON phrases
+BEGIN
+    UPDATE phrases_fts
+    SET userId = NEW.userId, phrase = NEW.phrase, phraseDefinition = NEW.phraseDefinition, foundIn = COALESCE(NEW.foundIn, '')
+    WHERE phraseId = NEW.id;
+end
+;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS phrases_fts_update;
+
+CREATE TRIGGER phrases_fts_update
+AFTER UPDATE OF phrase, phraseDefinition, foundIn ON phrases
+BEGIN
+    UPDATE phrases_fts
+    SET phrase = NEW.phrase, phraseDefinition = NEW.phraseDefinition, foundIn = COALESCE(NEW.foundIn, '')
+    WHERE phraseId = NEW.id;
+end
+;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE providers ADD COLUMN subject VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_providers_type_subject ON providers (type, subject) WHERE subject IS NOT NULL;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_providers_type_subject;
+ALTER TABLE providers DROP COLUMN subject;
+-- +goose StatementEnd
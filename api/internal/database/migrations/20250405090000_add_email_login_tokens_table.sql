@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE email_login_tokens (
+  id TEXT PRIMARY KEY,
+  email VARCHAR(255) NOT NULL,
+  tokenHash VARCHAR(64) NOT NULL UNIQUE,
+  expiresAt DATETIME NOT NULL,
+  usedAt DATETIME,
+  createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_email_login_tokens_email ON email_login_tokens (email, createdAt);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_login_tokens;
+-- +goose StatementEnd
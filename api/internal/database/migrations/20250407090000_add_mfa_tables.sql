@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_mfa (
+  userId TEXT PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  confirmedAt DATETIME,
+  lastUsedStep INTEGER,
+  createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE mfa_recovery_codes (
+  id TEXT PRIMARY KEY,
+  userId TEXT NOT NULL,
+  codeHash VARCHAR(64) NOT NULL UNIQUE,
+  usedAt DATETIME,
+  createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user ON mfa_recovery_codes (userId);
+
+ALTER TABLE sessions ADD COLUMN mfaPending INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN mfaAttempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN mfaVerifiedAt DATETIME;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN mfaVerifiedAt;
+ALTER TABLE sessions DROP COLUMN mfaAttempts;
+ALTER TABLE sessions DROP COLUMN mfaPending;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sessions ADD COLUMN tokenHash VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN previousTokenHash VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN rotatedAt DATETIME;
+
+CREATE UNIQUE INDEX idx_sessions_token_hash ON sessions (tokenHash);
+CREATE INDEX idx_sessions_previous_token_hash ON sessions (previousTokenHash);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_sessions_previous_token_hash;
+DROP INDEX IF EXISTS idx_sessions_token_hash;
+ALTER TABLE sessions DROP COLUMN rotatedAt;
+ALTER TABLE sessions DROP COLUMN previousTokenHash;
+ALTER TABLE sessions DROP COLUMN tokenHash;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE job_runs (
+  name TEXT PRIMARY KEY,
+  lockedBy TEXT,
+  lockedUntil DATETIME,
+  lastStartedAt DATETIME,
+  lastFinishedAt DATETIME,
+  lastResult TEXT,
+  lastError TEXT,
+  nextRunAt DATETIME,
+  runs INTEGER NOT NULL DEFAULT 0,
+  failures INTEGER NOT NULL DEFAULT 0
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS job_runs;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- record_phrase_tags_change_delete finds the user through the tag's phrase, which a cascading phrase delete has
+-- already removed by the time it runs. Tags are logged as deleted before their phrase goes instead.
+CREATE TRIGGER record_phrase_tags_change_cascade
+BEFORE DELETE ON phrases
+BEGIN
+    INSERT INTO sync_changes (userId, entityType, entityId, operation)
+    SELECT OLD.userId, 'tag', id, 'delete' FROM phrase_tags WHERE phraseId = OLD.id;
+end
+;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS record_phrase_tags_change_cascade;
+-- +goose StatementEnd
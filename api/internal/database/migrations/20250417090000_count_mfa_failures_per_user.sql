@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_mfa ADD COLUMN failedAttempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_mfa ADD COLUMN lockedUntil DATETIME;
+ALTER TABLE sessions DROP COLUMN mfaAttempts;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions ADD COLUMN mfaAttempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_mfa DROP COLUMN lockedUntil;
+ALTER TABLE user_mfa DROP COLUMN failedAttempts;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Emails are matched exactly, and every sign in now stores them in lower case. Addresses that would only collide
+-- with another user's once lowercased are left as they are, for an admin to sort out.
+UPDATE users SET email = lower(email)
+WHERE email != lower(email)
+  AND NOT EXISTS (SELECT 1 FROM users other WHERE lower(other.email) = lower(users.email) AND other.id != users.id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+-- The original case is not kept, and lowercased emails work with the older code as they are.
+-- +goose StatementEnd
@@ -3,12 +3,17 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
@@ -19,6 +24,27 @@ type PhraseModel struct {
 	DB *sql.DB
 }
 
+// TrashFilter controls whether phrases in the trash are returned by PhraseModel reads.
+type TrashFilter int
+
+const (
+	ExcludeTrashed TrashFilter = iota
+	IncludeTrashed
+	OnlyTrashed
+)
+
+// condition returns the SQL predicate on the deletedAt column of the given table alias.
+func (f TrashFilter) condition(alias string) string {
+	switch f {
+	case IncludeTrashed:
+		return "1 = 1"
+	case OnlyTrashed:
+		return alias + ".deletedAt IS NOT NULL"
+	default:
+		return alias + ".deletedAt IS NULL"
+	}
+}
+
 func (p *PhraseModel) CreatePhrase(ctx context.Context, phrase *models.Phrase) error {
 	tx, err := p.DB.BeginTx(ctx, nil)
 	if err != nil {
@@ -74,13 +100,13 @@ func (p *PhraseModel) CreateTag(ctx context.Context, phrase *models.PhraseTag) e
 	return nil
 }
 
-func (p *PhraseModel) ByID(ctx context.Context, id string, userID string) (*models.TaggedPhrase, error) {
+func (p *PhraseModel) ByID(ctx context.Context, id string, userID string, trash TrashFilter) (*models.TaggedPhrase, error) {
 	query := `
-        SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.deletedAt,
-        pt.id, pt.phraseId, pt.tagName, pt.tagColor, pt.createdAt
+        SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.deletedAt, p.version,
+        pt.id, pt.phraseId, pt.tagName, pt.tagColor, pt.createdAt, pt.version
         FROM phrases p
         LEFT JOIN phrase_tags pt ON p.id = pt.phraseId
-        WHERE p.id = ? AND p.userId = ?
+        WHERE p.id = ? AND p.userId = ? AND ` + trash.condition("p") + `
     `
 	rows, err := p.DB.QueryContext(ctx, query, id, userID)
 	if err != nil {
@@ -121,100 +147,230 @@ func (p *PhraseModel) ByID(ctx context.Context, id string, userID string) (*mode
 	return &taggedPhrase, nil
 }
 
-func (p *PhraseModel) CountTotalPages(ctx context.Context, pageSize int, userID string) (int, error) {
+// Each streams every phrase of the user matching the trash filter, with its tags, to fn in creation order.
+// Iteration stops at the first error returned by fn.
+func (p *PhraseModel) Each(ctx context.Context, userID string, trash TrashFilter, fn func(models.TaggedPhrase) error) error {
+	query := `
+		SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.deletedAt, p.version,
+		pt.id, pt.phraseId, pt.tagName, pt.tagColor, pt.createdAt, pt.version
+		FROM phrases p
+		LEFT JOIN phrase_tags pt ON p.id = pt.phraseId
+		WHERE p.userId = ? AND ` + trash.condition("p") + `
+		ORDER BY p.createdAt, p.id, pt.createdAt, pt.id
+	`
+	rows, err := p.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Printf("querying phrases to stream for user %s: %s", userID, err.Error())
+		return errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	var current *models.TaggedPhrase
+	for rows.Next() {
+		phrase, tag, err := scanTaggedPhrase(rows)
+		if err != nil {
+			log.Printf("scanning streamed phrase row for user %s: %s", userID, err.Error())
+			return errorcode.ErrScanningRow
+		}
+
+		if current == nil || current.Phrase.ID != phrase.ID {
+			if current != nil {
+				if err := fn(*current); err != nil {
+					return err
+				}
+			}
+			current = &models.TaggedPhrase{Phrase: phrase, Tag: []models.PhraseTag{}}
+		}
+		if tag != nil {
+			current.Tag = append(current.Tag, *tag)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating streamed phrase rows for user %s: %s", userID, err.Error())
+		return errorcode.ErrIteratingRows
+	}
+
+	if current != nil {
+		return fn(*current)
+	}
+	return nil
+}
+
+// Count returns the number of phrases the user has, filtered by whether they are in the trash.
+func (p *PhraseModel) Count(ctx context.Context, userID string, trash TrashFilter) (int, error) {
 	var totalRecords int
-	query := `SELECT COUNT(*) FROM phrases WHERE userId = ?`
+	query := `SELECT COUNT(*) FROM phrases p WHERE p.userId = ? AND ` + trash.condition("p")
 	err := p.DB.QueryRowContext(ctx, query, userID).Scan(&totalRecords)
 	if err != nil {
 		return 0, fmt.Errorf("counting phrases: %w", err)
 	}
-	totalPages := int(math.Ceil(float64(totalRecords) / float64(pageSize)))
-	return totalPages, nil
+	return totalRecords, nil
 }
 
-func (p *PhraseModel) All(ctx context.Context, pageNumber, pageSize int, sortBy, order, groupBy string, userID string) ([]models.TaggedPhrase, error) {
-	if sortBy == "" {
+type pageCursor struct {
+	SortBy    string `json:"s"`
+	Order     string `json:"o"`
+	Value     string `json:"v"`
+	ID        string `json:"id"`
+	Direction string `json:"d"`
+}
+
+const (
+	cursorNext = "next"
+	cursorPrev = "prev"
+)
+
+// All returns one page of the user's phrases with all of their tags.
+// Pages are either addressed by page number or, when a cursor from a previous page is given, by keyset from that cursor.
+// Grouping reorders phrases within the page only, cursors always follow the sort order.
+func (p *PhraseModel) All(ctx context.Context, pageNumber, pageSize int, cursor, sortBy, order, groupBy string, userID string) (*models.PhrasePage, error) {
+	sortBy = strings.ToLower(sortBy)
+	if sortBy == "usagecount" {
+		sortBy = "usageCount"
+	} else {
 		sortBy = "createdAt"
 	}
-	if order == "" || (strings.ToUpper(order) != "ASC" && strings.ToUpper(order) != "DESC") {
+	order = strings.ToUpper(order)
+	if order != "ASC" {
 		order = "DESC"
 	}
 
-	totalPages, err := p.CountTotalPages(ctx, pageSize, userID)
+	totalRecords, err := p.Count(ctx, userID, ExcludeTrashed)
 	if err != nil {
-		log.Printf("Error counting total pages for user %s: %v", userID, err)
+		log.Printf("Error counting phrases for user %s: %v", userID, err)
 		return nil, errorcode.ErrDBQuery
 	}
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(pageSize)))
 
-	if totalPages == 0 {
-		return []models.TaggedPhrase{}, nil
+	page := &models.PhrasePage{
+		Items:      []models.TaggedPhrase{},
+		TotalCount: totalRecords,
+		TotalPages: totalPages,
+		PageSize:   pageSize,
 	}
 
-	if pageNumber > totalPages {
-		return nil, fmt.Errorf("page number %d is greater than total pages %d", pageNumber, totalPages)
+	var after *pageCursor
+	if cursor != "" {
+		after, err = decodePageCursor(cursor)
+		if err != nil || after.SortBy != sortBy || after.Order != order {
+			return nil, errorcode.ErrInvalidCursor
+		}
+	} else {
+		if totalPages > 0 && pageNumber > totalPages {
+			return nil, errorcode.ErrPageOutOfRange.WithDetails(map[string]int{"totalPages": totalPages})
+		}
+		page.Page = pageNumber
+	}
+
+	queryOrder, comparison := order, "<"
+	if order == "ASC" {
+		comparison = ">"
+	}
+	backwards := after != nil && after.Direction == cursorPrev
+	if backwards {
+		if queryOrder == "ASC" {
+			queryOrder, comparison = "DESC", "<"
+		} else {
+			queryOrder, comparison = "ASC", ">"
+		}
 	}
 
+	args := []any{userID}
+	keyset := ""
+	if after != nil {
+		keyset = fmt.Sprintf("AND (p.%s, p.id) %s (?, ?)", sortBy, comparison)
+		if sortBy == "usageCount" {
+			usageCount, err := strconv.Atoi(after.Value)
+			if err != nil {
+				return nil, errorcode.ErrInvalidCursor
+			}
+			args = append(args, usageCount, after.ID)
+		} else {
+			args = append(args, after.Value, after.ID)
+		}
+	}
+
+	offset := 0
+	if after == nil && pageNumber > 1 {
+		offset = (pageNumber - 1) * pageSize
+	}
+	args = append(args, pageSize+1, offset)
+
 	query := fmt.Sprintf(`
-		SELECT
-			p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.deletedAt,
-			pt.id, pt.phraseId, pt.tagName, pt.tagColor, pt.createdAt
+		SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.deletedAt, p.version,
+		CAST(p.%s AS TEXT)
 		FROM phrases p
-		LEFT JOIN phrase_tags pt ON p.id = pt.phraseId
-		WHERE p.userId = ? AND p.deletedAt IS NULL
-		ORDER BY p.%s %s, p.id
+		WHERE p.userId = ? AND p.deletedAt IS NULL %s
+		ORDER BY p.%s %s, p.id %s
 		LIMIT ? OFFSET ?
-	`, sortBy, order)
-
-	offset := (pageNumber - 1) * pageSize
+	`, sortBy, keyset, sortBy, queryOrder, queryOrder)
 
-	rows, err := p.DB.QueryContext(ctx, query, userID, pageSize, offset)
+	rows, err := p.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Printf("Error querying paginated tagged phrases for user %s: %v", userID, err)
+		log.Printf("Error querying paginated phrases for user %s: %v", userID, err)
 		return nil, errorcode.ErrDBQuery
 	}
 	defer rows.Close()
 
-	taggedPhrasesMap := make(map[string]*models.TaggedPhrase)
-	orderedPhraseIDs := []string{}
-
+	var phrases []models.Phrase
+	var sortValues []string
 	for rows.Next() {
-		phrase, tag, err := scanTaggedPhrase(rows)
+		var sortValue string
+		phrase, err := scanPhrase(withExtraColumns(rows, &sortValue))
 		if err != nil {
-			log.Printf("Error scanning tagged phrase row during All() for user %s: %v", userID, err)
-			continue
+			log.Printf("Error scanning phrase row during All() for user %s: %v", userID, err)
+			return nil, errorcode.ErrScanningRow
 		}
+		phrases = append(phrases, phrase)
+		sortValues = append(sortValues, sortValue)
+	}
 
-		if _, exists := taggedPhrasesMap[phrase.ID]; !exists {
-			taggedPhrasesMap[phrase.ID] = &models.TaggedPhrase{
-				Phrase: phrase,
-				Tag:    []models.PhraseTag{},
-			}
-			orderedPhraseIDs = append(orderedPhraseIDs, phrase.ID)
-		}
+	if err = rows.Err(); err != nil {
+		log.Printf("Error iterating phrase rows during All() for user %s: %v", userID, err)
+		return nil, errorcode.ErrIteratingRows
+	}
+	rows.Close()
 
-		if tag != nil {
-			if taggedPhrasesMap[phrase.ID].Tag == nil {
-				taggedPhrasesMap[phrase.ID].Tag = []models.PhraseTag{}
-			}
-			taggedPhrasesMap[phrase.ID].Tag = append(taggedPhrasesMap[phrase.ID].Tag, *tag)
-		}
+	hasMore := len(phrases) > pageSize
+	if hasMore {
+		phrases = phrases[:pageSize]
+		sortValues = sortValues[:pageSize]
+	}
+	if backwards {
+		slices.Reverse(phrases)
+		slices.Reverse(sortValues)
 	}
 
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating tagged phrase rows during All() for user %s: %v", userID, err)
-		return nil, errorcode.ErrDBQuery
+	if len(phrases) > 0 {
+		first, last := 0, len(phrases)-1
+		hasPrev := (after == nil && offset > 0) || (after != nil && (!backwards || hasMore))
+		hasNext := (after == nil && hasMore) || (after != nil && (backwards || hasMore))
+		if hasPrev {
+			page.PrevCursor = encodePageCursor(pageCursor{SortBy: sortBy, Order: order, Value: sortValues[first], ID: phrases[first].ID, Direction: cursorPrev})
+		}
+		if hasNext {
+			page.NextCursor = encodePageCursor(pageCursor{SortBy: sortBy, Order: order, Value: sortValues[last], ID: phrases[last].ID, Direction: cursorNext})
+		}
 	}
 
-	finalPhrases := make([]models.TaggedPhrase, 0, len(orderedPhraseIDs))
-	for _, id := range orderedPhraseIDs {
-		finalPhrases = append(finalPhrases, *taggedPhrasesMap[id])
+	tags, err := p.tagsForPhrases(ctx, phrases)
+	if err != nil {
+		return nil, err
+	}
+	for _, phrase := range phrases {
+		phraseTags := tags[phrase.ID]
+		if phraseTags == nil {
+			phraseTags = []models.PhraseTag{}
+		}
+		page.Items = append(page.Items, models.TaggedPhrase{Phrase: phrase, Tag: phraseTags})
 	}
 
 	if groupBy == "foundIn" || groupBy == "public" {
 		grouped := make(map[string][]models.TaggedPhrase)
 		orderedGroups := []string{}
 
-		for _, taggedPhrase := range finalPhrases {
+		for _, taggedPhrase := range page.Items {
 			var key string
 			switch groupBy {
 			case "foundIn":
@@ -232,69 +388,197 @@ func (p *PhraseModel) All(ctx context.Context, pageNumber, pageSize int, sortBy,
 			grouped[key] = append(grouped[key], taggedPhrase)
 		}
 
-		var groupedPhrases []models.TaggedPhrase
+		groupedPhrases := make([]models.TaggedPhrase, 0, len(page.Items))
 		for _, groupKey := range orderedGroups {
 			groupedPhrases = append(groupedPhrases, grouped[groupKey]...)
 		}
-		return groupedPhrases, nil
+		page.Items = groupedPhrases
 	}
 
-	return finalPhrases, nil
+	return page, nil
 }
 
-func (p *PhraseModel) Search(ctx context.Context, searchTerm, userID string) ([]models.Phrase, error) {
-	searchQuery := "%" + strings.ToLower(searchTerm) + "%"
+// tagsForPhrases loads the tags of all given phrases in a single query, keyed by phrase ID.
+func (p *PhraseModel) tagsForPhrases(ctx context.Context, phrases []models.Phrase) (map[string][]models.PhraseTag, error) {
+	tags := make(map[string][]models.PhraseTag, len(phrases))
+	if len(phrases) == 0 {
+		return tags, nil
+	}
 
+	args := make([]any, 0, len(phrases))
+	for _, phrase := range phrases {
+		args = append(args, phrase.ID)
+	}
 	query := `
-		SELECT id, userId, phrase, phraseDefinition, pinned, foundIn, public, usageCount, createdAt, updatedAt, deletedAt
-		FROM phrases
-		WHERE userId = ? 
-		AND LOWER(phrase || ' ' || phraseDefinition) LIKE ?
+		SELECT id, phraseId, tagName, tagColor, createdAt, version
+		FROM phrase_tags
+		WHERE phraseId IN (` + placeholders(len(args)) + `)
+		ORDER BY createdAt, id
 	`
 
-	rows, err := p.DB.QueryContext(ctx, query, userID, searchQuery)
+	rows, err := p.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("querying search results: %w", err)
+		log.Printf("querying tags for phrases: %s", err.Error())
+		return nil, errorcode.ErrDBQuery
 	}
 	defer rows.Close()
-	var phrases []models.Phrase
 
 	for rows.Next() {
-		var phrase models.Phrase
-		var createdAtStr string
-
-		err = rows.Scan(
-			&phrase.ID,
-			&phrase.UserID,
-			&phrase.Phrase,
-			&phrase.PhraseDefinition,
-			&phrase.Pinned,
-			&phrase.FoundIn,
-			&phrase.Public,
-			&phrase.UsageCount,
-			&createdAtStr,
-		)
+		tag, err := scanTag(rows)
 		if err != nil {
-			return nil, fmt.Errorf("scanning search row: %w", err)
+			log.Printf("scanning tag row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
 		}
+		tags[tag.PhraseID] = append(tags[tag.PhraseID], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating tag rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return tags, nil
+}
+
+func encodePageCursor(c pageCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
 
-		phrase.CreatedAt, err = utils.StringToTime(createdAtStr)
+func decodePageCursor(cursor string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	if c.ID == "" || (c.Direction != cursorNext && c.Direction != cursorPrev) {
+		return nil, errorcode.ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// FTS5 wraps matches in these private use characters, which markHighlights turns into <mark> tags once the
+// phrase text around them has been escaped.
+const (
+	searchHighlightOpen  = "\uE000"
+	searchHighlightClose = "\uE001"
+)
+
+// Search runs a full-text search over the phrase, definition, source and tag names of the user's phrases.
+// Results are ranked by bm25 with matches in the phrase itself weighted highest.
+func (p *PhraseModel) Search(ctx context.Context, searchTerm, userID string, limit int) ([]models.PhraseSearchResult, error) {
+	if strings.TrimSpace(searchTerm) == "" {
+		return nil, errorcode.ErrNoSearchingData
+	}
+	matchQuery := buildMatchQuery(searchTerm)
+	if matchQuery == "" {
+		return []models.PhraseSearchResult{}, nil
+	}
+
+	query := `
+		SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.deletedAt, p.version,
+		highlight(phrases_fts, 2, ?, ?),
+		snippet(phrases_fts, 3, ?, ?, '…', 16),
+		bm25(phrases_fts, 0.0, 0.0, 10.0, 5.0, 2.0, 3.0) AS rank
+		FROM phrases_fts
+		JOIN phrases p ON p.id = phrases_fts.phraseId
+		WHERE phrases_fts MATCH ? AND phrases_fts.userId = ? AND p.deletedAt IS NULL
+		ORDER BY rank
+		LIMIT ?
+	`
+
+	rows, err := p.DB.QueryContext(ctx, query,
+		searchHighlightOpen, searchHighlightClose, searchHighlightOpen, searchHighlightClose,
+		matchQuery, userID, limit,
+	)
+	if err != nil {
+		log.Printf("querying search results for user %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	results := []models.PhraseSearchResult{}
+	for rows.Next() {
+		var result models.PhraseSearchResult
+		result.Phrase, err = scanPhrase(withExtraColumns(rows, &result.PhraseHighlight, &result.DefinitionSnippet, &result.Rank))
 		if err != nil {
-			log.Printf("Warning: could not parse createdAt '%s' for phrase %s", createdAtStr, phrase.Phrase)
-			phrase.CreatedAt = time.Now().UTC()
+			log.Printf("scanning search row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
 		}
-
-		phrases = append(phrases, phrase)
+		result.PhraseHighlight = markHighlights(result.PhraseHighlight)
+		result.DefinitionSnippet = markHighlights(result.DefinitionSnippet)
+		results = append(results, result)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterating search rows: %w", err)
+		log.Printf("iterating search rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
 	}
 
-	if len(phrases) == 0 {
-		return []models.Phrase{}, nil
+	return results, nil
+}
+
+// markHighlights HTML escapes highlighted phrase text and only then turns the FTS5 markers into <mark> tags, so
+// markup in a phrase is returned as text.
+func markHighlights(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, searchHighlightOpen, "<mark>")
+	return strings.ReplaceAll(s, searchHighlightClose, "</mark>")
+}
+
+// buildMatchQuery turns user input into an FTS5 match expression.
+// Quoted sections are matched as exact phrases, every other word is matched as a prefix.
+// Each term is emitted as an FTS5 string so operators and punctuation in the input are never interpreted.
+// Terms without a letter or digit are dropped, as the tokenizer reduces them to an empty prefix that matches
+// everything.
+func buildMatchQuery(term string) string {
+	var terms []string
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+
+	for {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			break
+		}
+
+		if term[0] == '"' {
+			end := strings.IndexByte(term[1:], '"')
+			var exact string
+			if end == -1 {
+				exact, term = term[1:], ""
+			} else {
+				exact, term = term[1:end+1], term[end+2:]
+			}
+			if exact = strings.Join(strings.Fields(exact), " "); hasWordCharacter(exact) {
+				terms = append(terms, quote(exact))
+			}
+			continue
+		}
+
+		end := strings.IndexFunc(term, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '"'
+		})
+		if end == -1 {
+			end = len(term)
+		}
+		if hasWordCharacter(term[:end]) {
+			terms = append(terms, quote(term[:end])+"*")
+		}
+		term = term[end:]
 	}
-	return phrases, nil
+
+	return strings.Join(terms, " ")
+}
+
+func hasWordCharacter(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	}) != -1
 }
 
 func (p *PhraseModel) UpdatePhrase(ctx context.Context, phrase *models.Phrase, userID string) error {
@@ -306,13 +590,13 @@ func (p *PhraseModel) UpdatePhrase(ctx context.Context, phrase *models.Phrase, u
 	defer tx.Rollback()
 	phrase.CreatedAt = time.Now().UTC()
 	query := `
-            UPDATE phrases SET phrase = ?, phraseDefinition = ?, pinned = ?, foundIn = ?, public = ?, usageCount = ?, updatedAt = ?
-            WHERE id = ? AND userId = ?
+            UPDATE phrases SET phrase = ?, phraseDefinition = ?, pinned = ?, foundIn = ?, public = ?, usageCount = ?, updatedAt = ?, version = version + 1
+            WHERE id = ? AND userId = ? AND deletedAt IS NULL
             `
 
 	res, err := tx.ExecContext(ctx, query,
 		phrase.Phrase, phrase.PhraseDefinition, phrase.Pinned,
-		phrase.FoundIn, phrase.Public, phrase.UsageCount, time.Now().UTC(),
+		phrase.FoundIn, phrase.Public, phrase.UsageCount, time.Now().UTC().Format(time.RFC3339),
 		phrase.ID, userID,
 	)
 	if err != nil {
@@ -343,12 +627,13 @@ func (p *PhraseModel) UpdateTag(ctx context.Context, tag *models.PhraseTag, user
 	tag.CreatedAt = time.Now().UTC()
 	query := `
     UPDATE phrase_tags 
-    SET tagName = ?, tagColor = ?
+    SET tagName = ?, tagColor = ?, version = version + 1
     WHERE id = ? AND phraseId = ?
     AND EXISTS (
       SELECT 1 FROM phrases 
       WHERE phrases.id = ? 
       AND phrases.userId = ?
+      AND phrases.deletedAt IS NULL
     );
                 `
 
@@ -383,11 +668,11 @@ func (p *PhraseModel) DeletePhrase(ctx context.Context, phraseID, userID string)
 
 	defer tx.Rollback()
 	query := `
-            UPDATE phrases SET deletedAt =?
-            WHERE id = ? AND userId = ?
+            UPDATE phrases SET deletedAt = ?, version = version + 1
+            WHERE id = ? AND userId = ? AND deletedAt IS NULL
             `
 
-	res, err := tx.ExecContext(ctx, query, time.Now().UTC(), phraseID, userID)
+	res, err := tx.ExecContext(ctx, query, time.Now().UTC().Format(time.RFC3339), phraseID, userID)
 	if err != nil {
 		return fmt.Errorf("error deleting phrase (id: %s, userID: %s): %w", phraseID, userID, err)
 	}
@@ -407,6 +692,176 @@ func (p *PhraseModel) DeletePhrase(ctx context.Context, phraseID, userID string)
 	return nil
 }
 
+// Trash returns one page of the user's trashed phrases, most recently deleted first.
+func (p *PhraseModel) Trash(ctx context.Context, pageNumber, pageSize int, userID string) (*models.PhrasePage, error) {
+	totalRecords, err := p.Count(ctx, userID, OnlyTrashed)
+	if err != nil {
+		log.Printf("Error counting trashed phrases for user %s: %v", userID, err)
+		return nil, errorcode.ErrDBQuery
+	}
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(pageSize)))
+	if totalPages > 0 && pageNumber > totalPages {
+		return nil, errorcode.ErrPageOutOfRange.WithDetails(map[string]int{"totalPages": totalPages})
+	}
+
+	query := `
+		SELECT id, userId, phrase, phraseDefinition, pinned, foundIn, public, usageCount, createdAt, updatedAt, deletedAt, version
+		FROM phrases
+		WHERE userId = ? AND deletedAt IS NOT NULL
+		ORDER BY datetime(deletedAt) DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := p.DB.QueryContext(ctx, query, userID, pageSize, (pageNumber-1)*pageSize)
+	if err != nil {
+		log.Printf("Error querying trashed phrases for user %s: %v", userID, err)
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	var phrases []models.Phrase
+	for rows.Next() {
+		phrase, err := scanPhrase(rows)
+		if err != nil {
+			log.Printf("Error scanning trashed phrase row for user %s: %v", userID, err)
+			return nil, errorcode.ErrScanningRow
+		}
+		phrases = append(phrases, phrase)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating trashed phrase rows for user %s: %v", userID, err)
+		return nil, errorcode.ErrIteratingRows
+	}
+	rows.Close()
+
+	tags, err := p.tagsForPhrases(ctx, phrases)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.PhrasePage{
+		Items:      make([]models.TaggedPhrase, 0, len(phrases)),
+		TotalCount: totalRecords,
+		TotalPages: totalPages,
+		Page:       pageNumber,
+		PageSize:   pageSize,
+	}
+	for _, phrase := range phrases {
+		phraseTags := tags[phrase.ID]
+		if phraseTags == nil {
+			phraseTags = []models.PhraseTag{}
+		}
+		page.Items = append(page.Items, models.TaggedPhrase{Phrase: phrase, Tag: phraseTags})
+	}
+
+	return page, nil
+}
+
+// RestorePhrase moves a phrase out of the trash.
+func (p *PhraseModel) RestorePhrase(ctx context.Context, phraseID, userID string) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE phrases SET deletedAt = NULL, updatedAt = ?, version = version + 1
+		WHERE id = ? AND userId = ? AND deletedAt IS NOT NULL
+	`
+	res, err := tx.ExecContext(ctx, query, time.Now().UTC().Format(time.RFC3339), phraseID, userID)
+	if err != nil {
+		log.Printf("error restoring phrase (id: %s, userID: %s): %s", phraseID, userID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrPhraseNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+// PurgePhrase permanently deletes a trashed phrase and its tags.
+func (p *PhraseModel) PurgePhrase(ctx context.Context, phraseID, userID string) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	purged, err := purgePhrases(ctx, tx, `id = ? AND userId = ?`, phraseID, userID)
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return errorcode.ErrPhraseNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+// PurgeTrashedBefore permanently deletes every phrase that was moved to the trash before the given time, along with its tags.
+func (p *PhraseModel) PurgeTrashedBefore(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return 0, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	purged, err := purgePhrases(ctx, tx, `datetime(deletedAt) < datetime(?)`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return 0, errorcode.ErrTransactionCommit
+	}
+
+	return purged, nil
+}
+
+// purgePhrases hard deletes the trashed phrases matching where, removing their tags first.
+func purgePhrases(ctx context.Context, tx *sql.Tx, where string, args ...any) (int64, error) {
+	tagsQuery := `DELETE FROM phrase_tags WHERE phraseId IN (SELECT id FROM phrases WHERE deletedAt IS NOT NULL AND ` + where + `)`
+	if _, err := tx.ExecContext(ctx, tagsQuery, args...); err != nil {
+		log.Printf("error purging phrase tags: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+
+	phrasesQuery := `DELETE FROM phrases WHERE deletedAt IS NOT NULL AND ` + where
+	res, err := tx.ExecContext(ctx, phrasesQuery, args...)
+	if err != nil {
+		log.Printf("error purging phrases: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+
+	purged, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+	return purged, nil
+}
+
 func (p *PhraseModel) DeleteTag(ctx context.Context, phraseID, tagID, userID string) error {
 	tx, err := p.DB.BeginTx(ctx, nil)
 	if err != nil {
@@ -423,6 +878,7 @@ DELETE FROM phrase_tags
 			WHERE phrases.id = phrase_tags.phraseId 
 			AND phrases.id = ? 
 			AND phrases.userId = ?
+			AND phrases.deletedAt IS NULL
 		);
 	`
 
@@ -446,6 +902,171 @@ DELETE FROM phrase_tags
 	return nil
 }
 
+// importTagColor is given to imported tags the user has not used before.
+const importTagColor = "#9ca3af"
+
+// Import creates phrases and their tags from import records in a single transaction.
+// Records that failed to parse, and phrases the user already has or that repeat an
+// earlier record, are reported without being imported.
+func (p *PhraseModel) Import(ctx context.Context, userID, format string, records []models.ImportRecord) (*models.ImportReport, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return nil, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	existing := map[string]bool{}
+	rows, err := tx.QueryContext(ctx, `SELECT phrase, deletedAt IS NOT NULL FROM phrases WHERE userId = ?`, userID)
+	if err != nil {
+		log.Printf("querying existing phrases for user %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	for rows.Next() {
+		var phrase string
+		var trashed bool
+		if err := rows.Scan(&phrase, &trashed); err != nil {
+			rows.Close()
+			log.Printf("scanning existing phrase row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		existing[importKey(phrase)] = trashed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating existing phrase rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	// Imported tags take the colour the user last gave a tag of the same name.
+	tagColors := map[string]string{}
+	rows, err = tx.QueryContext(ctx, `
+		SELECT pt.tagName, pt.tagColor
+		FROM phrase_tags pt
+		JOIN phrases p ON p.id = pt.phraseId
+		WHERE p.userId = ?
+		ORDER BY pt.createdAt ASC
+	`, userID)
+	if err != nil {
+		log.Printf("querying existing tags for user %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	for rows.Next() {
+		var name, color string
+		if err := rows.Scan(&name, &color); err != nil {
+			rows.Close()
+			log.Printf("scanning existing tag row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		tagColors[strings.ToLower(name)] = color
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating existing tag rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	insertPhrase, err := tx.PrepareContext(ctx, `
+		INSERT INTO phrases (id, userId, phrase, phraseDefinition, pinned, foundIn, public, usageCount, createdAt, updatedAt)
+		VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?, ?, 0, ?, ?)
+		RETURNING id
+	`)
+	if err != nil {
+		log.Printf("preparing phrase import: %s", err.Error())
+		return nil, errorcode.ErrImport
+	}
+	defer insertPhrase.Close()
+
+	insertTag, err := tx.PrepareContext(ctx, `
+		INSERT INTO phrase_tags (id, phraseId, tagName, tagColor, createdAt)
+		VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?)
+	`)
+	if err != nil {
+		log.Printf("preparing tag import: %s", err.Error())
+		return nil, errorcode.ErrImport
+	}
+	defer insertTag.Close()
+
+	report := &models.ImportReport{
+		Format:  format,
+		Created: []models.ImportRow{},
+		Skipped: []models.ImportRow{},
+		Failed:  []models.ImportRow{},
+	}
+	seen := map[string]int{}
+	now := time.Now().UTC()
+
+	for _, rec := range records {
+		row := models.ImportRow{Row: rec.Row, Phrase: rec.Phrase.Phrase}
+		if rec.Err != "" {
+			row.Reason = rec.Err
+			report.Failed = append(report.Failed, row)
+			continue
+		}
+
+		key := importKey(rec.Phrase.Phrase)
+		if trashed, ok := existing[key]; ok {
+			row.Reason = "phrase already exists"
+			if trashed {
+				row.Reason = "phrase is in the trash"
+			}
+			report.Skipped = append(report.Skipped, row)
+			continue
+		}
+		if first, ok := seen[key]; ok {
+			row.Reason = fmt.Sprintf("duplicate of row %d", first)
+			report.Skipped = append(report.Skipped, row)
+			continue
+		}
+
+		createdAt := rec.Phrase.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		err := insertPhrase.QueryRowContext(ctx,
+			userID, rec.Phrase.Phrase, rec.Phrase.PhraseDefinition, rec.Phrase.Pinned, rec.Phrase.FoundIn, rec.Phrase.Public,
+			createdAt.UTC().Format(time.RFC3339), now.Format(time.RFC3339),
+		).Scan(&row.PhraseID)
+		if err != nil {
+			log.Printf("error importing phrase from row %d for user %s: %s", rec.Row, userID, err.Error())
+			return nil, errorcode.ErrImport
+		}
+
+		tagged := map[string]bool{}
+		for _, tag := range rec.Tags {
+			name := strings.ToLower(tag)
+			if tagged[name] {
+				continue
+			}
+			tagged[name] = true
+
+			color, ok := tagColors[name]
+			if !ok {
+				color = importTagColor
+			}
+			if _, err := insertTag.ExecContext(ctx, row.PhraseID, tag, color, now.Format(time.RFC3339)); err != nil {
+				log.Printf("error importing tag %q from row %d for user %s: %s", tag, rec.Row, userID, err.Error())
+				return nil, errorcode.ErrImport
+			}
+		}
+
+		seen[key] = rec.Row
+		report.Created = append(report.Created, row)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return nil, errorcode.ErrTransactionCommit
+	}
+
+	return report, nil
+}
+
+// importKey normalises a phrase for duplicate detection during imports.
+func importKey(phrase string) string {
+	return strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+}
+
 type scanner interface {
 	Scan(dest ...any) error
 }
@@ -454,6 +1075,7 @@ func scanTaggedPhrase(scanner scanner) (models.Phrase, *models.PhraseTag, error)
 	var phrase models.Phrase
 	var phraseCreatedAtStr, phraseUpdatedAtStr string
 	var phraseDeletedAtStr, tagID, tagPhraseID, tagName, tagColor, tagCreatedAtStr sql.NullString
+	var tagVersion sql.NullInt64
 
 	err := scanner.Scan(
 		&phrase.ID,
@@ -467,11 +1089,13 @@ func scanTaggedPhrase(scanner scanner) (models.Phrase, *models.PhraseTag, error)
 		&phraseCreatedAtStr,
 		&phraseUpdatedAtStr,
 		&phraseDeletedAtStr,
+		&phrase.Version,
 		&tagID,
 		&tagPhraseID,
 		&tagName,
 		&tagColor,
 		&tagCreatedAtStr,
+		&tagVersion,
 	)
 	if err != nil {
 		return phrase, nil, err
@@ -504,6 +1128,7 @@ func scanTaggedPhrase(scanner scanner) (models.Phrase, *models.PhraseTag, error)
 			PhraseID: tagPhraseID.String,
 			TagName:  tagName.String,
 			TagColor: tagColor.String,
+			Version:  int(tagVersion.Int64),
 		}
 		if tagCreatedAtStr.Valid {
 			tag.CreatedAt, err = utils.StringToTime(tagCreatedAtStr.String)
@@ -517,3 +1142,97 @@ func scanTaggedPhrase(scanner scanner) (models.Phrase, *models.PhraseTag, error)
 	}
 	return phrase, nil, nil
 }
+
+func scanPhrase(scanner scanner) (models.Phrase, error) {
+	var phrase models.Phrase
+	var phraseCreatedAtStr, phraseUpdatedAtStr string
+	var phraseDeletedAtStr sql.NullString
+
+	err := scanner.Scan(
+		&phrase.ID,
+		&phrase.UserID,
+		&phrase.Phrase,
+		&phrase.PhraseDefinition,
+		&phrase.Pinned,
+		&phrase.FoundIn,
+		&phrase.Public,
+		&phrase.UsageCount,
+		&phraseCreatedAtStr,
+		&phraseUpdatedAtStr,
+		&phraseDeletedAtStr,
+		&phrase.Version,
+	)
+	if err != nil {
+		return phrase, err
+	}
+
+	phrase.CreatedAt, err = utils.StringToTime(phraseCreatedAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for phrase %s", phraseCreatedAtStr, phrase.Phrase)
+		phrase.CreatedAt = time.Now().UTC()
+	}
+
+	phrase.UpdatedAt, err = utils.StringToTime(phraseUpdatedAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse updatedAt '%s' for phrase %s", phraseUpdatedAtStr, phrase.Phrase)
+		phrase.UpdatedAt = time.Now().UTC()
+	}
+
+	if phraseDeletedAtStr.Valid {
+		deletedAtTime, err := utils.StringToTime(phraseDeletedAtStr.String)
+		if err != nil {
+			log.Printf("Warning: could not parse deletedAt '%s' for phrase %s", phraseDeletedAtStr.String, phrase.Phrase)
+		} else {
+			phrase.DeletedAt = &deletedAtTime
+		}
+	}
+
+	return phrase, nil
+}
+
+func scanTag(scanner scanner) (models.PhraseTag, error) {
+	var tag models.PhraseTag
+	var tagCreatedAtStr string
+
+	err := scanner.Scan(
+		&tag.ID,
+		&tag.PhraseID,
+		&tag.TagName,
+		&tag.TagColor,
+		&tagCreatedAtStr,
+		&tag.Version,
+	)
+	if err != nil {
+		return tag, err
+	}
+
+	tag.CreatedAt, err = utils.StringToTime(tagCreatedAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for phrase tag %s", tagCreatedAtStr, tag.TagName)
+		tag.CreatedAt = time.Now().UTC()
+	}
+
+	return tag, nil
+}
+
+type extraColumnsScanner struct {
+	scanner scanner
+	extra   []any
+}
+
+func (s extraColumnsScanner) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// withExtraColumns lets the shared row scanners read queries that select additional trailing columns.
+func withExtraColumns(scanner scanner, extra ...any) scanner {
+	return extraColumnsScanner{scanner: scanner, extra: extra}
+}
+
+// placeholders returns n comma separated bind parameters for use in an IN clause.
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
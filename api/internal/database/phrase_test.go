@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMatchQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		term     string
+		expected string
+	}{
+		{"Single Word", "serendip", `"serendip"*`},
+		{"Multiple Words", "  quick   brown ", `"quick"* "brown"*`},
+		{"Quoted Phrase", `"kind of blue" jazz`, `"kind of blue" "jazz"*`},
+		{"Unterminated Quote", `word "open ended`, `"word"* "open ended"`},
+		{"Operators Are Literal", `NOT a OR b*`, `"NOT"* "a"* "OR"* "b*"*`},
+		{"Empty Quotes", `""`, ``},
+		{"Punctuation Only", `- ... "!?" *`, ``},
+		{"Punctuation Dropped", `well - known`, `"well"* "known"*`},
+		{"Non Latin", `café 日本`, `"café"* "日本"*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildMatchQuery(tt.term)
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	phraseModel := PhraseModel{DB: db}
+	user := newTestUser(t, db, "alice")
+	newTestPhrase(t, db, user.ID, `<script>alert("x")</script>`)
+	newTestPhrase(t, db, user.ID, "unrelated")
+
+	results, err := phraseModel.Search(ctx, "script", user.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	want := `&lt;<mark>script</mark>&gt;alert(&#34;x&#34;)&lt;/<mark>script</mark>&gt;`
+	if results[0].PhraseHighlight != want {
+		t.Errorf("Expected %q, got %q", want, results[0].PhraseHighlight)
+	}
+	if want := `&lt;<mark>script</mark>&gt;alert(&#34;x&#34;)&lt;/<mark>script</mark>&gt; definition`; results[0].DefinitionSnippet != want {
+		t.Errorf("Expected %q, got %q", want, results[0].DefinitionSnippet)
+	}
+
+	for _, term := range []string{"-", `"..."`} {
+		results, err := phraseModel.Search(ctx, term, user.ID, 10)
+		if err != nil {
+			t.Fatalf("Failed to search for %q: %v", term, err)
+		}
+		if len(results) != 0 {
+			t.Errorf("Expected no results for %q, got %d", term, len(results))
+		}
+	}
+}
+
+func TestTrashTimes(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	phraseModel := PhraseModel{DB: db}
+	user := newTestUser(t, db, "alice")
+
+	trashed, _ := newTestPhrase(t, db, user.ID, "trashed")
+	if err := phraseModel.DeletePhrase(ctx, trashed.ID, user.ID); err != nil {
+		t.Fatalf("Failed to delete phrase: %v", err)
+	}
+	var deletedAt string
+	if err := db.QueryRow(`SELECT deletedAt FROM phrases WHERE id = ?`, trashed.ID).Scan(&deletedAt); err != nil {
+		t.Fatalf("Failed to read phrase: %v", err)
+	}
+	if _, err := time.Parse(time.RFC3339, deletedAt); err != nil {
+		t.Errorf("Expected deletedAt in RFC3339, got %s", deletedAt)
+	}
+
+	// Rows written before deletedAt was always RFC3339 use the driver's format, which sorts wrongly as a plain string.
+	morning, _ := newTestPhrase(t, db, user.ID, "morning")
+	evening, _ := newTestPhrase(t, db, user.ID, "evening")
+	db.Exec(`UPDATE phrases SET deletedAt = '2025-04-01T10:00:00Z' WHERE id = ?`, morning.ID)
+	db.Exec(`UPDATE phrases SET deletedAt = '2025-04-01 23:00:00+00:00' WHERE id = ?`, evening.ID)
+
+	page, err := phraseModel.Trash(ctx, 1, 10, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list trash: %v", err)
+	}
+	var order []string
+	for _, p := range page.Items {
+		order = append(order, p.Phrase.Phrase)
+	}
+	if strings.Join(order, ",") != "trashed,evening,morning" {
+		t.Errorf("Expected the most recently deleted first, got %v", order)
+	}
+
+	purged, err := phraseModel.PurgeTrashedBefore(ctx, time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected only the morning's phrase to be purged, got %d", purged)
+	}
+}
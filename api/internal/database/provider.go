@@ -3,9 +3,12 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/arinji2/vocab-thing/internal/envelope"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
 	"github.com/arinji2/vocab-thing/internal/utils"
@@ -15,17 +18,30 @@ type ProviderModel struct {
 	DB *sql.DB
 }
 
+// tokenKeys encrypts OAuth tokens before they are written to the providers table. Without it tokens are stored in plaintext.
+var tokenKeys *envelope.Keyring
+
+// SetTokenKeys sets the keyring for OAuth tokens. Tokens sealed earlier can only be read while their key is still in it.
+func SetTokenKeys(k *envelope.Keyring) {
+	tokenKeys = k
+}
+
 func (p *ProviderModel) Create(ctx context.Context, provider *models.OauthProvider) error {
+	accessToken, refreshToken, err := sealProviderTokens(*provider)
+	if err != nil {
+		return err
+	}
+
 	tx, err := p.DB.BeginTx(ctx, nil)
 	if err != nil {
 		log.Printf("starting transaction: %s", err.Error())
 		return errorcode.ErrTransactionStart
 	}
 	defer tx.Rollback()
-	query := `INSERT INTO providers (id, userId, type, refreshToken, accessToken, expiresAt)
-          VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?) RETURNING id`
+	query := `INSERT INTO providers (id, userId, type, subject, refreshToken, accessToken, expiresAt)
+          VALUES (lower(hex(randomblob(16))), ?, ?, NULLIF(?, ''), ?, ?, ?) RETURNING id`
 
-	err = tx.QueryRowContext(ctx, query, provider.UserID, provider.Type, provider.RefreshToken, provider.AccessToken, provider.ExpiresAt.Format(time.RFC3339)).Scan(&provider.ID)
+	err = tx.QueryRowContext(ctx, query, provider.UserID, provider.Type, provider.Subject, refreshToken, accessToken, provider.ExpiresAt.Format(time.RFC3339)).Scan(&provider.ID)
 	if err != nil {
 		log.Printf("error with provider creation of userID %s and provider type %s: %s", provider.UserID, provider.Type, err.Error())
 		return errorcode.ErrDBCreate
@@ -40,7 +56,7 @@ func (p *ProviderModel) Create(ctx context.Context, provider *models.OauthProvid
 }
 
 func (p *ProviderModel) ByUserID(ctx context.Context, id string) ([]models.OauthProvider, error) {
-	query := `SELECT id, userID, type, accessToken, expiresAt, refreshToken, createdAt FROM providers WHERE userID = ?`
+	query := `SELECT id, userID, type, subject, accessToken, expiresAt, refreshToken, createdAt FROM providers WHERE userID = ?`
 
 	rows, err := p.DB.QueryContext(ctx, query, id)
 	if err != nil {
@@ -52,35 +68,12 @@ func (p *ProviderModel) ByUserID(ctx context.Context, id string) ([]models.Oauth
 	var providers []models.OauthProvider
 
 	for rows.Next() {
-		var provider models.OauthProvider
-		var createdAtStr, expiresAtStr string
-
-		err := rows.Scan(
-			&provider.ID,
-			&provider.UserID,
-			&provider.Type,
-			&provider.AccessToken,
-			&expiresAtStr,
-			&provider.RefreshToken,
-			&createdAtStr,
-		)
+		provider, err := scanProvider(rows)
 		if err != nil {
 			log.Printf("scanning provider row: %s", err.Error())
 			return nil, errorcode.ErrScanningRow
 		}
 
-		provider.CreatedAt, err = utils.StringToTime(createdAtStr)
-		if err != nil {
-			log.Printf("Warning: could not parse createdAt '%s' for provider %s", createdAtStr, provider.ID)
-			provider.CreatedAt = time.Now().UTC()
-		}
-
-		provider.ExpiresAt, err = utils.StringToTime(expiresAtStr)
-		if err != nil {
-			log.Printf("Warning: could not parse expiresAt '%s' for provider %s", expiresAtStr, provider.ID)
-			provider.ExpiresAt = time.Now().UTC()
-		}
-
 		providers = append(providers, provider)
 	}
 
@@ -96,3 +89,260 @@ func (p *ProviderModel) ByUserID(ctx context.Context, id string) ([]models.Oauth
 
 	return providers, nil
 }
+
+// BySubject finds the provider row of an identity by the provider's stable user ID.
+func (p *ProviderModel) BySubject(ctx context.Context, providerType, subject string) (models.OauthProvider, error) {
+	query := `SELECT id, userID, type, subject, accessToken, expiresAt, refreshToken, createdAt FROM providers WHERE type = ? AND subject = ?`
+
+	provider, err := scanProvider(p.DB.QueryRowContext(ctx, query, providerType, subject))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OauthProvider{}, sql.ErrNoRows
+		}
+		log.Printf("scanning provider row: %s", err.Error())
+		return models.OauthProvider{}, errorcode.ErrScanningRow
+	}
+
+	return provider, nil
+}
+
+// UpdateTokens stores fresh tokens for a provider row, along with its subject when the row predates subjects. A
+// subject already stored is never replaced.
+func (p *ProviderModel) UpdateTokens(ctx context.Context, provider *models.OauthProvider) error {
+	accessToken, refreshToken, err := sealProviderTokens(*provider)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE providers SET subject = COALESCE(NULLIF(subject, ''), NULLIF(?, '')), refreshToken = ?, accessToken = ?, expiresAt = ? WHERE id = ?`
+
+	_, err = p.DB.ExecContext(ctx, query, provider.Subject, refreshToken, accessToken, provider.ExpiresAt.Format(time.RFC3339), provider.ID)
+	if err != nil {
+		log.Printf("error updating tokens of provider %s: %s", provider.ID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+
+	return nil
+}
+
+// ExpiringBetween returns the providers with a refresh token whose access token expires between after and before.
+func (p *ProviderModel) ExpiringBetween(ctx context.Context, after, before time.Time) ([]models.OauthProvider, error) {
+	query := `SELECT id, userID, type, subject, accessToken, expiresAt, refreshToken, createdAt FROM providers
+		WHERE refreshToken != '' AND datetime(expiresAt) > datetime(?) AND datetime(expiresAt) < datetime(?)`
+
+	rows, err := p.DB.QueryContext(ctx, query, after.UTC().Format(time.RFC3339), before.UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("querying expiring providers: %s", err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	var providers []models.OauthProvider
+	for rows.Next() {
+		provider, err := scanProvider(rows)
+		if err != nil {
+			log.Printf("scanning provider row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		providers = append(providers, provider)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating provider rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return providers, nil
+}
+
+// ReencryptTokens seals every stored token that is still plaintext or sealed with an old key with the active key,
+// returning how many provider rows changed. Run it after enabling encryption or rotating the active key.
+func (p *ProviderModel) ReencryptTokens(ctx context.Context) (int, error) {
+	if tokenKeys == nil {
+		log.Printf("cannot re-encrypt provider tokens without token encryption keys")
+		return 0, errorcode.ErrTokenEncryption
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return 0, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, accessToken, refreshToken FROM providers`)
+	if err != nil {
+		log.Printf("querying provider tokens: %s", err.Error())
+		return 0, errorcode.ErrDBQuery
+	}
+	type storedTokens struct{ id, accessToken, refreshToken string }
+	var stale []storedTokens
+	for rows.Next() {
+		var t storedTokens
+		if err := rows.Scan(&t.id, &t.accessToken, &t.refreshToken); err != nil {
+			rows.Close()
+			log.Printf("scanning provider row: %s", err.Error())
+			return 0, errorcode.ErrScanningRow
+		}
+		if needsResealing(t.accessToken) || needsResealing(t.refreshToken) {
+			stale = append(stale, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		log.Printf("iterating provider rows: %s", err.Error())
+		return 0, errorcode.ErrIteratingRows
+	}
+	rows.Close()
+
+	for _, t := range stale {
+		accessToken, err := resealToken(t.accessToken)
+		if err != nil {
+			log.Printf("error re-encrypting access token of provider %s: %s", t.id, err.Error())
+			return 0, errorcode.ErrTokenEncryption
+		}
+		refreshToken, err := resealToken(t.refreshToken)
+		if err != nil {
+			log.Printf("error re-encrypting refresh token of provider %s: %s", t.id, err.Error())
+			return 0, errorcode.ErrTokenEncryption
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE providers SET accessToken = ?, refreshToken = ? WHERE id = ?`, accessToken, refreshToken, t.id); err != nil {
+			log.Printf("error updating tokens of provider %s: %s", t.id, err.Error())
+			return 0, errorcode.ErrDBUpdate
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return 0, errorcode.ErrTransactionCommit
+	}
+
+	return len(stale), nil
+}
+
+// Delete unlinks a provider from the user, ending every session started with it. The
+// user's last provider cannot be removed, as they would have no way left to sign in.
+func (p *ProviderModel) Delete(ctx context.Context, id, userID string) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	var remaining int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM providers WHERE userId = ? AND id != ?`, userID, id).Scan(&remaining)
+	if err != nil {
+		log.Printf("counting providers of user %s: %s", userID, err.Error())
+		return errorcode.ErrDBQuery
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM providers WHERE id = ? AND userId = ?`, id, userID)
+	if err != nil {
+		log.Printf("error deleting provider %s for user %s: %s", id, userID, err.Error())
+		return errorcode.ErrDBDelete
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBDelete
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrProviderNotFound
+	}
+	if remaining == 0 {
+		return errorcode.ErrLastProvider
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+func scanProvider(scanner scanner) (models.OauthProvider, error) {
+	var provider models.OauthProvider
+	var subject sql.NullString
+	var createdAtStr, expiresAtStr string
+
+	err := scanner.Scan(
+		&provider.ID,
+		&provider.UserID,
+		&provider.Type,
+		&subject,
+		&provider.AccessToken,
+		&expiresAtStr,
+		&provider.RefreshToken,
+		&createdAtStr,
+	)
+	if err != nil {
+		return provider, err
+	}
+	provider.Subject = subject.String
+
+	if provider.AccessToken, err = openToken(provider.AccessToken); err != nil {
+		return provider, fmt.Errorf("decrypting access token of provider %s: %w", provider.ID, err)
+	}
+	if provider.RefreshToken, err = openToken(provider.RefreshToken); err != nil {
+		return provider, fmt.Errorf("decrypting refresh token of provider %s: %w", provider.ID, err)
+	}
+
+	provider.CreatedAt, err = utils.StringToTime(createdAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for provider %s", createdAtStr, provider.ID)
+		provider.CreatedAt = time.Now().UTC()
+	}
+
+	provider.ExpiresAt, err = utils.StringToTime(expiresAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse expiresAt '%s' for provider %s", expiresAtStr, provider.ID)
+		provider.ExpiresAt = time.Now().UTC()
+	}
+
+	return provider, nil
+}
+
+// sealProviderTokens returns the provider's tokens as they are stored. Empty tokens, as guest and email providers
+// have, hold no secret and stay empty.
+func sealProviderTokens(provider models.OauthProvider) (accessToken, refreshToken string, err error) {
+	if accessToken, err = sealToken(provider.AccessToken); err != nil {
+		log.Printf("error encrypting access token of %s provider for user %s: %s", provider.Type, provider.UserID, err.Error())
+		return "", "", errorcode.ErrTokenEncryption
+	}
+	if refreshToken, err = sealToken(provider.RefreshToken); err != nil {
+		log.Printf("error encrypting refresh token of %s provider for user %s: %s", provider.Type, provider.UserID, err.Error())
+		return "", "", errorcode.ErrTokenEncryption
+	}
+	return accessToken, refreshToken, nil
+}
+
+func sealToken(token string) (string, error) {
+	if token == "" || tokenKeys == nil {
+		return token, nil
+	}
+	return tokenKeys.Seal(token)
+}
+
+// openToken decrypts a stored token. Plaintext tokens from before encryption was enabled are returned as they are.
+func openToken(stored string) (string, error) {
+	if !envelope.IsSealed(stored) {
+		return stored, nil
+	}
+	if tokenKeys == nil {
+		return "", envelope.ErrUnknownKey
+	}
+	return tokenKeys.Open(stored)
+}
+
+func needsResealing(stored string) bool {
+	return stored != "" && tokenKeys.NeedsRotation(stored)
+}
+
+func resealToken(stored string) (string, error) {
+	token, err := openToken(stored)
+	if err != nil {
+		return "", err
+	}
+	return sealToken(token)
+}
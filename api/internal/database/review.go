@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/srs"
+	"github.com/arinji2/vocab-thing/internal/utils"
+)
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// Due returns phrases that are due for review, overdue ones first followed by phrases that were never reviewed.
+func (m *ReviewModel) Due(ctx context.Context, userID string, limit int) ([]models.ReviewItem, error) {
+	now := time.Now().UTC()
+	query := `
+		SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.version,
+		r.id, r.easeFactor, r.interval, r.repetitions, r.lapses, r.dueAt, r.lastReviewedAt
+		FROM phrases p
+		LEFT JOIN phrase_reviews r ON r.phraseId = p.id
+		WHERE p.userId = ? AND p.deletedAt IS NULL
+		AND (r.id IS NULL OR r.dueAt <= ?)
+		ORDER BY r.id IS NULL, r.dueAt ASC, p.createdAt ASC
+		LIMIT ?
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, now.Format(time.RFC3339), limit)
+	if err != nil {
+		log.Printf("querying due reviews for user %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	items := []models.ReviewItem{}
+	for rows.Next() {
+		item, err := scanReviewItem(rows, now)
+		if err != nil {
+			log.Printf("scanning due review row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating due review rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return items, nil
+}
+
+// Record grades a review of the phrase and stores the next scheduling state.
+func (m *ReviewModel) Record(ctx context.Context, phraseID, userID string, quality int) (*models.PhraseReview, error) {
+	if !srs.ValidQuality(quality) {
+		return nil, errorcode.ErrInvalidQuality
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return nil, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	query := `
+		SELECT p.id, p.userId, p.phrase, p.phraseDefinition, p.pinned, p.foundIn, p.public, p.usageCount, p.createdAt, p.updatedAt, p.version,
+		r.id, r.easeFactor, r.interval, r.repetitions, r.lapses, r.dueAt, r.lastReviewedAt
+		FROM phrases p
+		LEFT JOIN phrase_reviews r ON r.phraseId = p.id
+		WHERE p.id = ? AND p.userId = ? AND p.deletedAt IS NULL
+	`
+	item, err := scanReviewItem(tx.QueryRowContext(ctx, query, phraseID, userID), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errorcode.ErrPhraseNotFound
+		}
+		log.Printf("scanning review row for phrase %s: %s", phraseID, err.Error())
+		return nil, errorcode.ErrScanningRow
+	}
+
+	next := srs.Schedule(srs.State{
+		EaseFactor:  item.Review.EaseFactor,
+		Interval:    item.Review.Interval,
+		Repetitions: item.Review.Repetitions,
+		Lapses:      item.Review.Lapses,
+		DueAt:       item.Review.DueAt,
+	}, quality, now)
+
+	review := item.Review
+	review.EaseFactor = next.EaseFactor
+	review.Interval = next.Interval
+	review.Repetitions = next.Repetitions
+	review.Lapses = next.Lapses
+	review.DueAt = next.DueAt
+	review.LastReviewedAt = &now
+
+	upsert := `
+		INSERT INTO phrase_reviews (id, phraseId, userId, easeFactor, interval, repetitions, lapses, dueAt, lastReviewedAt, updatedAt)
+		VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (phraseId) DO UPDATE SET
+			easeFactor = excluded.easeFactor,
+			interval = excluded.interval,
+			repetitions = excluded.repetitions,
+			lapses = excluded.lapses,
+			dueAt = excluded.dueAt,
+			lastReviewedAt = excluded.lastReviewedAt,
+			updatedAt = excluded.updatedAt
+		RETURNING id
+	`
+	err = tx.QueryRowContext(ctx, upsert,
+		review.PhraseID, review.UserID, review.EaseFactor, review.Interval, review.Repetitions, review.Lapses,
+		review.DueAt.Format(time.RFC3339), now.Format(time.RFC3339), now.Format(time.RFC3339),
+	).Scan(&review.ID)
+	if err != nil {
+		log.Printf("error recording review of phrase %s for user %s: %s", phraseID, userID, err.Error())
+		return nil, errorcode.ErrReviewRecord
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return nil, errorcode.ErrTransactionCommit
+	}
+
+	return &review, nil
+}
+
+// scanReviewItem scans a phrase joined with its optional review state. Phrases without a review row get a fresh state due at now.
+func scanReviewItem(scanner scanner, now time.Time) (models.ReviewItem, error) {
+	var item models.ReviewItem
+	var phraseCreatedAtStr, phraseUpdatedAtStr string
+	var reviewID, dueAtStr, lastReviewedAtStr sql.NullString
+	var easeFactor sql.NullFloat64
+	var interval, repetitions, lapses sql.NullInt64
+
+	err := scanner.Scan(
+		&item.Phrase.ID,
+		&item.Phrase.UserID,
+		&item.Phrase.Phrase,
+		&item.Phrase.PhraseDefinition,
+		&item.Phrase.Pinned,
+		&item.Phrase.FoundIn,
+		&item.Phrase.Public,
+		&item.Phrase.UsageCount,
+		&phraseCreatedAtStr,
+		&phraseUpdatedAtStr,
+		&item.Phrase.Version,
+		&reviewID,
+		&easeFactor,
+		&interval,
+		&repetitions,
+		&lapses,
+		&dueAtStr,
+		&lastReviewedAtStr,
+	)
+	if err != nil {
+		return item, err
+	}
+
+	item.Phrase.CreatedAt, err = utils.StringToTime(phraseCreatedAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for phrase %s", phraseCreatedAtStr, item.Phrase.Phrase)
+		item.Phrase.CreatedAt = time.Now().UTC()
+	}
+	item.Phrase.UpdatedAt, err = utils.StringToTime(phraseUpdatedAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse updatedAt '%s' for phrase %s", phraseUpdatedAtStr, item.Phrase.Phrase)
+		item.Phrase.UpdatedAt = time.Now().UTC()
+	}
+
+	fresh := srs.NewState(now)
+	item.Review = models.PhraseReview{
+		PhraseID:   item.Phrase.ID,
+		UserID:     item.Phrase.UserID,
+		EaseFactor: fresh.EaseFactor,
+		DueAt:      fresh.DueAt,
+	}
+	if !reviewID.Valid {
+		return item, nil
+	}
+
+	item.Review.ID = reviewID.String
+	item.Review.EaseFactor = easeFactor.Float64
+	item.Review.Interval = int(interval.Int64)
+	item.Review.Repetitions = int(repetitions.Int64)
+	item.Review.Lapses = int(lapses.Int64)
+	item.Review.DueAt, err = utils.StringToTime(dueAtStr.String)
+	if err != nil {
+		log.Printf("Warning: could not parse dueAt '%s' for review %s", dueAtStr.String, reviewID.String)
+		item.Review.DueAt = now
+	}
+	if lastReviewedAtStr.Valid {
+		lastReviewedAt, err := utils.StringToTime(lastReviewedAtStr.String)
+		if err != nil {
+			log.Printf("Warning: could not parse lastReviewedAt '%s' for review %s", lastReviewedAtStr.String, reviewID.String)
+		} else {
+			item.Review.LastReviewedAt = &lastReviewedAt
+		}
+	}
+
+	return item, nil
+}
@@ -16,6 +16,7 @@ type SessionModel struct {
 	DB *sql.DB
 }
 
+// Create stores a new session and sets its Token. Only the token's hash is stored, so this is the one chance to read it.
 func (m *SessionModel) Create(ctx context.Context, session *models.Session) error {
 	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
@@ -25,18 +26,25 @@ func (m *SessionModel) Create(ctx context.Context, session *models.Session) erro
 	defer tx.Rollback()
 
 	session.CreatedAt = time.Now().UTC()
-	query := `INSERT INTO sessions (id, userId, providerId, fingerprint, ip, expiresAt)
-          VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?) RETURNING id`
+	session.RotatedAt = session.CreatedAt
+	token, hash := auth.NewSessionToken()
+	var mfaVerifiedAt any
+	if session.MFAVerifiedAt != nil {
+		mfaVerifiedAt = session.MFAVerifiedAt.UTC().Format(time.RFC3339)
+	}
+	query := `INSERT INTO sessions (id, tokenHash, rotatedAt, userId, providerId, fingerprint, ip, expiresAt, mfaPending, mfaVerifiedAt)
+          VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
 
-	err = tx.QueryRowContext(ctx, query, session.UserID, session.ProviderID, session.Fingerprint, session.IP, session.ExpiresAt.Format(time.RFC3339)).Scan(&session.ID)
+	err = tx.QueryRowContext(ctx, query, hash, session.RotatedAt.Format(time.RFC3339), session.UserID, session.ProviderID, session.Fingerprint, session.IP, session.ExpiresAt.UTC().Format(time.RFC3339), session.MFAPending, mfaVerifiedAt).Scan(&session.ID)
 	if err != nil {
-		log.Printf("error with session creation of userID %s: %s", session.ID, err.Error())
+		log.Printf("error with session creation of userID %s: %s", session.UserID, err.Error())
 		return errorcode.ErrDBCreate
 	}
 	if err := tx.Commit(); err != nil {
 		log.Printf("committing transaction: %s", err.Error())
 		return errorcode.ErrTransactionCommit
 	}
+	session.Token = token
 
 	return nil
 }
@@ -64,7 +72,7 @@ func (m *SessionModel) ByUserID(ctx context.Context, id string) ([]models.Sessio
 			&session.Fingerprint,
 			&session.IP,
 			&expiresAtStr,
-			&session.CreatedAt,
+			&createdAtStr,
 		)
 		if err != nil {
 			log.Printf("scanning session row: %s", err.Error())
@@ -99,7 +107,7 @@ func (m *SessionModel) ByUserID(ctx context.Context, id string) ([]models.Sessio
 }
 
 func (m *SessionModel) ByUserIDWithProvider(ctx context.Context, id string) ([]models.Session, error) {
-	query := `SELECT s.id, s.userId, s.providerId, p.type, s.fingerprint, s.ip, s.expiresAt, s.createdAt
+	query := `SELECT s.id, s.userId, s.providerId, p.type, s.fingerprint, s.ip, s.expiresAt, s.createdAt, s.mfaPending, s.mfaVerifiedAt
 	          FROM sessions s
 	          JOIN providers p ON s.providerId = p.id
 	          WHERE s.userId = ?`
@@ -115,6 +123,7 @@ func (m *SessionModel) ByUserIDWithProvider(ctx context.Context, id string) ([]m
 	for rows.Next() {
 		var session models.Session
 		var createdAtStr, expiresAtStr string
+		var mfaVerifiedAtStr sql.NullString
 
 		err := rows.Scan(
 			&session.ID,
@@ -124,7 +133,9 @@ func (m *SessionModel) ByUserIDWithProvider(ctx context.Context, id string) ([]m
 			&session.Fingerprint,
 			&session.IP,
 			&expiresAtStr,
-			&session.CreatedAt,
+			&createdAtStr,
+			&session.MFAPending,
+			&mfaVerifiedAtStr,
 		)
 		if err != nil {
 			log.Printf("scanning session row: %s", err.Error())
@@ -141,6 +152,11 @@ func (m *SessionModel) ByUserIDWithProvider(ctx context.Context, id string) ([]m
 			log.Printf("Warning: could not parse expiresAt '%s' for session %s", expiresAtStr, session.ID)
 			session.ExpiresAt = time.Now().UTC()
 		}
+		if mfaVerifiedAtStr.Valid {
+			if verifiedAt, err := utils.StringToTime(mfaVerifiedAtStr.String); err == nil {
+				session.MFAVerifiedAt = &verifiedAt
+			}
+		}
 
 		sessions = append(sessions, session)
 	}
@@ -157,15 +173,25 @@ func (m *SessionModel) ByUserIDWithProvider(ctx context.Context, id string) ([]m
 	return sessions, nil
 }
 
-func (m *SessionModel) Validate(ctx context.Context, sessionID string) (models.Session, error) {
-	query := `SELECT id, userId, expiresAt FROM sessions WHERE id = ?`
+// Validate looks a session up by the hash of its cookie token. A token replaced by periodic rotation is still
+// accepted for auth.SessionRotationGrace, so requests sent before the new cookie arrived do not fail.
+func (m *SessionModel) Validate(ctx context.Context, token string) (models.Session, error) {
+	query := `SELECT s.id, s.userId, s.providerId, p.type, s.expiresAt, s.createdAt, COALESCE(s.rotatedAt, s.createdAt), s.mfaPending, s.mfaVerifiedAt, u.disabledAt IS NOT NULL
+	          FROM sessions s
+	          JOIN providers p ON s.providerId = p.id
+	          JOIN users u ON s.userId = u.id
+	          WHERE s.tokenHash = ? OR (s.previousTokenHash = ? AND datetime(s.rotatedAt) > datetime(?))`
 
-	row := m.DB.QueryRowContext(ctx, query, sessionID)
+	hash := auth.HashSessionToken(token)
+	graceStart := time.Now().UTC().Add(-auth.SessionRotationGrace).Format(time.RFC3339)
+	row := m.DB.QueryRowContext(ctx, query, hash, hash, graceStart)
 
 	var session models.Session
-	var expiresAtStr string
+	var expiresAtStr, createdAtStr, rotatedAtStr string
+	var mfaVerifiedAtStr sql.NullString
+	var userDisabled bool
 
-	err := row.Scan(&session.ID, &session.UserID, &expiresAtStr)
+	err := row.Scan(&session.ID, &session.UserID, &session.ProviderID, &session.ProviderType, &expiresAtStr, &createdAtStr, &rotatedAtStr, &session.MFAPending, &mfaVerifiedAtStr, &userDisabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Session{}, errorcode.ErrNoSession
@@ -173,10 +199,13 @@ func (m *SessionModel) Validate(ctx context.Context, sessionID string) (models.S
 		log.Printf("scanning session row: %s", err.Error())
 		return models.Session{}, errorcode.ErrScanningRow
 	}
+	if userDisabled {
+		return models.Session{}, errorcode.ErrUserDisabled
+	}
 
 	parsedTime, err := utils.StringToTime(expiresAtStr)
 	if err != nil {
-		log.Printf("could not parse expiresAt '%s' for session %s: %s", expiresAtStr, sessionID, err.Error())
+		log.Printf("could not parse expiresAt '%s' for session %s: %s", expiresAtStr, session.ID, err.Error())
 		parsedTime = time.Now().UTC()
 	}
 	session.ExpiresAt = parsedTime
@@ -184,7 +213,291 @@ func (m *SessionModel) Validate(ctx context.Context, sessionID string) (models.S
 	if session.ExpiresAt.Before(time.Now()) {
 		return models.Session{}, auth.ErrSessionExpired
 	}
-	session.ExpiresAt = parsedTime
+	// An unreadable createdAt is left zero, so the session never counts as a recent sign in.
+	if session.CreatedAt, err = utils.StringToTime(createdAtStr); err != nil {
+		log.Printf("could not parse createdAt '%s' for session %s: %s", createdAtStr, session.ID, err.Error())
+		session.CreatedAt = time.Time{}
+	}
+	// Likewise an unreadable rotatedAt is left zero, so the token is rotated on the next request.
+	if session.RotatedAt, err = utils.StringToTime(rotatedAtStr); err != nil {
+		log.Printf("could not parse rotatedAt '%s' for session %s: %s", rotatedAtStr, session.ID, err.Error())
+		session.RotatedAt = time.Time{}
+	}
+	if mfaVerifiedAtStr.Valid {
+		if verifiedAt, err := utils.StringToTime(mfaVerifiedAtStr.String); err == nil {
+			session.MFAVerifiedAt = &verifiedAt
+		}
+	}
+	session.Token = token
 
 	return session, nil
 }
+
+// Refresh slides the expiry of a session in use forward and rotates its token once it is older than
+// auth.SessionRotationInterval. It reports whether the session changed, in which case the cookie must be set
+// again. A session used with its previous token is left alone, as the newer cookie is already on its way.
+func (m *SessionModel) Refresh(ctx context.Context, session *models.Session) (bool, error) {
+	now := time.Now().UTC()
+	expiresAt, rotate := auth.SessionRefresh(*session, now)
+	if !rotate && expiresAt.Equal(session.ExpiresAt) {
+		return false, nil
+	}
+
+	currentHash := auth.HashSessionToken(session.Token)
+	token, hash := session.Token, currentHash
+	query := `UPDATE sessions SET expiresAt = ? WHERE id = ? AND tokenHash = ?`
+	args := []any{expiresAt.Format(time.RFC3339), session.ID, currentHash}
+	if rotate {
+		token, hash = auth.NewSessionToken()
+		query = `UPDATE sessions SET expiresAt = ?, tokenHash = ?, previousTokenHash = tokenHash, rotatedAt = ? WHERE id = ? AND tokenHash = ?`
+		args = []any{expiresAt.Format(time.RFC3339), hash, now.Format(time.RFC3339), session.ID, currentHash}
+	}
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("error refreshing session %s: %s", session.ID, err.Error())
+		return false, errorcode.ErrDBUpdate
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return false, errorcode.ErrDBUpdate
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	session.ExpiresAt = expiresAt
+	session.Token = token
+	if rotate {
+		session.RotatedAt = now
+	}
+	return true, nil
+}
+
+func (m *SessionModel) rotate(ctx context.Context, session *models.Session, query string, args ...any) error {
+	now := time.Now().UTC()
+	token, hash := auth.NewSessionToken()
+	args = append([]any{hash, now.Format(time.RFC3339)}, args...)
+	if _, err := m.DB.ExecContext(ctx, query, append(args, session.ID)...); err != nil {
+		log.Printf("error rotating token of session %s: %s", session.ID, err.Error())
+		return errorcode.ErrDBUpdate
+	}
+
+	session.Token = token
+	session.RotatedAt = now
+	return nil
+}
+
+// HashLegacyTokens moves sessions from before token hashing over: the old ID, which was the cookie value, is
+// hashed into tokenHash and replaced with a new ID, so existing cookies keep working but no longer appear in the
+// database. It returns how many sessions were moved.
+func (m *SessionModel) HashLegacyTokens(ctx context.Context) (int, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT id FROM sessions WHERE tokenHash IS NULL`)
+	if err != nil {
+		log.Printf("querying legacy sessions: %s", err.Error())
+		return 0, errorcode.ErrDBQuery
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Printf("scanning session row: %s", err.Error())
+			return 0, errorcode.ErrScanningRow
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating session rows: %s", err.Error())
+		return 0, errorcode.ErrIteratingRows
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return 0, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE sessions SET id = lower(hex(randomblob(16))), tokenHash = ?, rotatedAt = createdAt WHERE id = ? AND tokenHash IS NULL`
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, query, auth.HashSessionToken(id), id); err != nil {
+			log.Printf("error hashing token of legacy session: %s", err.Error())
+			return 0, errorcode.ErrDBUpdate
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return 0, errorcode.ErrTransactionCommit
+	}
+
+	return len(ids), nil
+}
+
+// Active returns the user's unexpired sessions with their provider type, newest first.
+func (m *SessionModel) Active(ctx context.Context, userID string) ([]models.Session, error) {
+	query := `SELECT s.id, s.userId, s.providerId, p.type, s.fingerprint, s.ip, s.expiresAt, s.createdAt, s.mfaPending, s.mfaVerifiedAt
+	          FROM sessions s
+	          JOIN providers p ON s.providerId = p.id
+	          WHERE s.userId = ? AND datetime(s.expiresAt) > datetime('now')
+	          ORDER BY s.createdAt DESC, s.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Printf("querying active sessions: %s", err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var createdAtStr, expiresAtStr string
+		var mfaVerifiedAtStr sql.NullString
+
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.ProviderID,
+			&session.ProviderType,
+			&session.Fingerprint,
+			&session.IP,
+			&expiresAtStr,
+			&createdAtStr,
+			&session.MFAPending,
+			&mfaVerifiedAtStr,
+		)
+		if err != nil {
+			log.Printf("scanning session row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+
+		session.CreatedAt, err = utils.StringToTime(createdAtStr)
+		if err != nil {
+			log.Printf("Warning: could not parse createdAt '%s' for session %s", createdAtStr, session.ID)
+			session.CreatedAt = time.Now().UTC()
+		}
+		session.ExpiresAt, err = utils.StringToTime(expiresAtStr)
+		if err != nil {
+			log.Printf("Warning: could not parse expiresAt '%s' for session %s", expiresAtStr, session.ID)
+			session.ExpiresAt = time.Now().UTC()
+		}
+		if mfaVerifiedAtStr.Valid {
+			if verifiedAt, err := utils.StringToTime(mfaVerifiedAtStr.String); err == nil {
+				session.MFAVerifiedAt = &verifiedAt
+			}
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating session rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return sessions, nil
+}
+
+// CompleteMFA turns a pending session into a full one once the second factor is checked. The token is rotated,
+// as the session now grants full access.
+func (m *SessionModel) CompleteMFA(ctx context.Context, session *models.Session, expiresAt time.Time) error {
+	query := `UPDATE sessions SET tokenHash = ?, previousTokenHash = NULL, rotatedAt = ?, mfaPending = 0, mfaVerifiedAt = ?, expiresAt = ? WHERE id = ?`
+	now := time.Now().UTC()
+	if err := m.rotate(ctx, session, query, now.Format(time.RFC3339), expiresAt.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	session.MFAPending = false
+	session.MFAVerifiedAt = &now
+	session.ExpiresAt = expiresAt
+	return nil
+}
+
+// MarkMFAVerified records that the second factor was checked in an existing full session, such as the one MFA was
+// enrolled from, and rotates its token.
+func (m *SessionModel) MarkMFAVerified(ctx context.Context, session *models.Session) error {
+	query := `UPDATE sessions SET tokenHash = ?, previousTokenHash = NULL, rotatedAt = ?, mfaVerifiedAt = ? WHERE id = ? AND mfaPending = 0`
+	now := time.Now().UTC()
+	if err := m.rotate(ctx, session, query, now.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	session.MFAVerifiedAt = &now
+	return nil
+}
+
+// Delete revokes one of the user's sessions.
+func (m *SessionModel) Delete(ctx context.Context, sessionID, userID string) error {
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE id = ? AND userId = ?`, sessionID, userID)
+	if err != nil {
+		log.Printf("error deleting session %s for user %s: %s", sessionID, userID, err.Error())
+		return errorcode.ErrDBDelete
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBDelete
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteByUserID revokes every session of the user and returns how many there were.
+func (m *SessionModel) DeleteByUserID(ctx context.Context, userID string) (int64, error) {
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE userId = ?`, userID)
+	if err != nil {
+		log.Printf("error deleting sessions for user %s: %s", userID, err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+	return deleted, nil
+}
+
+// ExpireByUserID ends every unexpired session of the user now, so each device has to sign in again. The rows are
+// left for DeleteExpired to clean up.
+func (m *SessionModel) ExpireByUserID(ctx context.Context, userID string) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := m.DB.ExecContext(ctx, `UPDATE sessions SET expiresAt = ? WHERE userId = ? AND datetime(expiresAt) > datetime(?)`, now, userID, now)
+	if err != nil {
+		log.Printf("error expiring sessions for user %s: %s", userID, err.Error())
+		return 0, errorcode.ErrDBUpdate
+	}
+
+	expired, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return 0, errorcode.ErrDBUpdate
+	}
+	return expired, nil
+}
+
+// DeleteExpired removes every session that expired before the given time.
+func (m *SessionModel) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE datetime(expiresAt) < datetime(?)`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("error deleting expired sessions: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return 0, errorcode.ErrDBDelete
+	}
+	return deleted, nil
+}
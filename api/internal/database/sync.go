@@ -3,11 +3,15 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/utils/idgen"
 )
 
 type SyncModel struct {
@@ -104,3 +108,491 @@ func (s *SyncModel) ManualSync(ctx context.Context, userID string) (*models.Sync
 	}
 	return &syncData, nil
 }
+
+type syncChange struct {
+	created bool
+	deleted bool
+}
+
+// Changes returns the phrases and tags that changed after the given cursor, collapsed to their latest state.
+// An empty cursor starts from the beginning of the change log.
+func (s *SyncModel) Changes(ctx context.Context, userID, cursor string, limit int) (*models.SyncChanges, error) {
+	since, err := decodeSyncCursor(cursor)
+	if err != nil {
+		return nil, errorcode.ErrInvalidCursor
+	}
+
+	query := `
+		SELECT seq, entityType, entityId, operation
+		FROM sync_changes
+		WHERE userId = ? AND seq > ?
+		ORDER BY seq ASC
+		LIMIT ?
+	`
+	rows, err := s.DB.QueryContext(ctx, query, userID, since, limit+1)
+	if err != nil {
+		log.Printf("querying sync changes for userID %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	phraseChanges := make(map[string]*syncChange)
+	tagChanges := make(map[string]*syncChange)
+	var phraseOrder, tagOrder []string
+	lastSeq := since
+	count := 0
+	hasMore := false
+
+	for rows.Next() {
+		if count == limit {
+			hasMore = true
+			break
+		}
+		count++
+
+		var seq int64
+		var entityType, entityID, operation string
+		if err := rows.Scan(&seq, &entityType, &entityID, &operation); err != nil {
+			log.Printf("scanning sync change row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		lastSeq = seq
+
+		changes, order := phraseChanges, &phraseOrder
+		if entityType == "tag" {
+			changes, order = tagChanges, &tagOrder
+		}
+		change, exists := changes[entityID]
+		if !exists {
+			change = &syncChange{}
+			changes[entityID] = change
+			*order = append(*order, entityID)
+		}
+		switch operation {
+		case "create":
+			change.created = true
+			change.deleted = false
+		case "delete":
+			change.deleted = true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating sync change rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+	rows.Close()
+
+	result := &models.SyncChanges{
+		Phrases: models.PhraseChanges{Created: []models.Phrase{}, Updated: []models.Phrase{}, Deleted: []string{}},
+		Tags:    models.TagChanges{Created: []models.PhraseTag{}, Updated: []models.PhraseTag{}, Deleted: []string{}},
+		Cursor:  encodeSyncCursor(lastSeq),
+		HasMore: hasMore,
+	}
+
+	livePhrases, err := s.phrasesByIDs(ctx, userID, liveIDs(phraseChanges, phraseOrder))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range phraseOrder {
+		change := phraseChanges[id]
+		phrase, exists := livePhrases[id]
+		switch {
+		case change.deleted || !exists || phrase.DeletedAt != nil:
+			result.Phrases.Deleted = append(result.Phrases.Deleted, id)
+		case change.created:
+			result.Phrases.Created = append(result.Phrases.Created, phrase)
+		default:
+			result.Phrases.Updated = append(result.Phrases.Updated, phrase)
+		}
+	}
+
+	liveTags, err := s.tagsByIDs(ctx, userID, liveIDs(tagChanges, tagOrder))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range tagOrder {
+		change := tagChanges[id]
+		tag, exists := liveTags[id]
+		switch {
+		case change.deleted || !exists:
+			result.Tags.Deleted = append(result.Tags.Deleted, id)
+		case change.created:
+			result.Tags.Created = append(result.Tags.Created, tag)
+		default:
+			result.Tags.Updated = append(result.Tags.Updated, tag)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *SyncModel) phrasesByIDs(ctx context.Context, userID string, ids []string) (map[string]models.Phrase, error) {
+	phrases := make(map[string]models.Phrase, len(ids))
+	if len(ids) == 0 {
+		return phrases, nil
+	}
+
+	query := `
+		SELECT id, userId, phrase, phraseDefinition, pinned, foundIn, public, usageCount, createdAt, updatedAt, deletedAt, version
+		FROM phrases
+		WHERE userId = ? AND id IN (` + placeholders(len(ids)) + `)
+	`
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, userID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("querying changed phrases for userID %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		phrase, err := scanPhrase(rows)
+		if err != nil {
+			log.Printf("scanning changed phrase row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		phrases[phrase.ID] = phrase
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating changed phrase rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return phrases, nil
+}
+
+func (s *SyncModel) tagsByIDs(ctx context.Context, userID string, ids []string) (map[string]models.PhraseTag, error) {
+	tags := make(map[string]models.PhraseTag, len(ids))
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	query := `
+		SELECT pt.id, pt.phraseId, pt.tagName, pt.tagColor, pt.createdAt, pt.version
+		FROM phrase_tags pt
+		JOIN phrases p ON p.id = pt.phraseId
+		WHERE p.userId = ? AND pt.id IN (` + placeholders(len(ids)) + `)
+	`
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, userID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("querying changed tags for userID %s: %s", userID, err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			log.Printf("scanning changed tag row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		tags[tag.ID] = tag
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating changed tag rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return tags, nil
+}
+
+func liveIDs(changes map[string]*syncChange, order []string) []string {
+	ids := make([]string, 0, len(order))
+	for _, id := range order {
+		if !changes[id].deleted {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+const syncCursorPrefix = "v1:"
+
+func encodeSyncCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncCursorPrefix + strconv.FormatInt(seq, 10)))
+}
+
+func decodeSyncCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncCursorPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(string(raw), syncCursorPrefix) || seq < 0 {
+		return 0, errorcode.ErrInvalidCursor
+	}
+	return seq, nil
+}
+
+const (
+	SyncPolicyReject         = "reject"
+	SyncPolicyLastWriterWins = "last-writer-wins"
+)
+
+const (
+	MutationApplied   = "applied"
+	MutationConflict  = "conflict"
+	MutationRejected  = "rejected"
+	MutationDuplicate = "duplicate"
+)
+
+// Push applies an ordered batch of client mutations in a single transaction.
+// Version conflicts and invalid mutations are reported per mutation, database failures roll back the whole batch.
+func (s *SyncModel) Push(ctx context.Context, userID, policy string, mutations []models.SyncMutation) ([]models.SyncMutationResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return nil, errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	results := make([]models.SyncMutationResult, 0, len(mutations))
+	for _, mutation := range mutations {
+		if mutation.ClientID == "" {
+			results = append(results, rejectedMutation(mutation, "missing client_id"))
+			continue
+		}
+
+		result, found, err := appliedMutation(ctx, tx, userID, mutation.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			switch mutation.Entity {
+			case "phrase":
+				result, err = pushPhrase(ctx, tx, userID, policy, mutation, now)
+			case "tag":
+				result, err = pushTag(ctx, tx, userID, policy, mutation)
+			default:
+				result = rejectedMutation(mutation, "unknown entity")
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.ClientID = mutation.ClientID
+
+		if !found && result.Status == MutationApplied {
+			query := `
+				INSERT INTO sync_mutations (id, userId, clientId, entityType, entityId, version)
+				VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?)
+			`
+			_, err = tx.ExecContext(ctx, query, userID, mutation.ClientID, mutation.Entity, result.EntityID, result.Version)
+			if err != nil {
+				log.Printf("error recording mutation %s for userID %s: %s", mutation.ClientID, userID, err.Error())
+				return nil, errorcode.ErrDBCreate
+			}
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return nil, errorcode.ErrTransactionCommit
+	}
+
+	return results, nil
+}
+
+func appliedMutation(ctx context.Context, tx *sql.Tx, userID, clientID string) (models.SyncMutationResult, bool, error) {
+	result := models.SyncMutationResult{Status: MutationDuplicate}
+	query := `SELECT entityId, version FROM sync_mutations WHERE userId = ? AND clientId = ?`
+	err := tx.QueryRowContext(ctx, query, userID, clientID).Scan(&result.EntityID, &result.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return result, false, nil
+		}
+		log.Printf("querying mutation %s for userID %s: %s", clientID, userID, err.Error())
+		return result, false, errorcode.ErrDBQuery
+	}
+	return result, true, nil
+}
+
+func rejectedMutation(mutation models.SyncMutation, reason string) models.SyncMutationResult {
+	return models.SyncMutationResult{
+		ClientID: mutation.ClientID,
+		Status:   MutationRejected,
+		EntityID: mutation.EntityID,
+		Error:    reason,
+	}
+}
+
+func pushPhrase(ctx context.Context, tx *sql.Tx, userID, policy string, mutation models.SyncMutation, now time.Time) (models.SyncMutationResult, error) {
+	if mutation.Operation != "delete" && mutation.Phrase == nil {
+		return rejectedMutation(mutation, "missing phrase"), nil
+	}
+
+	if mutation.Operation == "create" {
+		if !validEntityID(mutation.EntityID) {
+			return rejectedMutation(mutation, "invalid entity_id"), nil
+		}
+		query := `
+			INSERT INTO phrases (id, userId, phrase, phraseDefinition, pinned, foundIn, public, usageCount, createdAt, updatedAt)
+			VALUES (COALESCE(NULLIF(?, ''), lower(hex(randomblob(16)))), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id, version
+		`
+		p := mutation.Phrase
+		result := models.SyncMutationResult{Status: MutationApplied}
+		err := tx.QueryRowContext(ctx, query,
+			mutation.EntityID, userID, p.Phrase, p.PhraseDefinition, p.Pinned, p.FoundIn, p.Public, p.UsageCount,
+			now.Format(time.RFC3339), now.Format(time.RFC3339),
+		).Scan(&result.EntityID, &result.Version)
+		if err != nil {
+			log.Printf("error with pushed phrase creation of userID %s: %s", userID, err.Error())
+			return rejectedMutation(mutation, "phrase could not be created"), nil
+		}
+		return result, nil
+	}
+
+	current, err := scanPhrase(tx.QueryRowContext(ctx, `
+		SELECT id, userId, phrase, phraseDefinition, pinned, foundIn, public, usageCount, createdAt, updatedAt, deletedAt, version
+		FROM phrases
+		WHERE id = ? AND userId = ?
+	`, mutation.EntityID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return rejectedMutation(mutation, "phrase not found"), nil
+		}
+		log.Printf("scanning pushed phrase %s: %s", mutation.EntityID, err.Error())
+		return models.SyncMutationResult{}, errorcode.ErrScanningRow
+	}
+	if mutation.Operation == "update" && current.DeletedAt != nil {
+		return rejectedMutation(mutation, "phrase is in the trash"), nil
+	}
+
+	conflict := current.Version != mutation.BaseVersion
+	if conflict && policy != SyncPolicyLastWriterWins {
+		return models.SyncMutationResult{
+			Status:   MutationConflict,
+			EntityID: current.ID,
+			Version:  current.Version,
+			Conflict: true,
+			Phrase:   &current,
+		}, nil
+	}
+
+	var query string
+	var args []any
+	switch mutation.Operation {
+	case "update":
+		p := mutation.Phrase
+		query = `
+			UPDATE phrases SET phrase = ?, phraseDefinition = ?, pinned = ?, foundIn = ?, public = ?, usageCount = ?, updatedAt = ?, version = version + 1
+			WHERE id = ? AND userId = ? AND deletedAt IS NULL
+			RETURNING version
+		`
+		args = []any{p.Phrase, p.PhraseDefinition, p.Pinned, p.FoundIn, p.Public, p.UsageCount, now.Format(time.RFC3339), current.ID, userID}
+	case "delete":
+		query = `
+			UPDATE phrases SET deletedAt = COALESCE(deletedAt, ?), version = version + 1
+			WHERE id = ? AND userId = ?
+			RETURNING version
+		`
+		args = []any{now.Format(time.RFC3339), current.ID, userID}
+	default:
+		return rejectedMutation(mutation, "unknown operation"), nil
+	}
+
+	result := models.SyncMutationResult{Status: MutationApplied, EntityID: current.ID, Conflict: conflict}
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&result.Version); err != nil {
+		log.Printf("error applying pushed %s of phrase %s: %s", mutation.Operation, current.ID, err.Error())
+		return models.SyncMutationResult{}, errorcode.ErrDBUpdate
+	}
+	return result, nil
+}
+
+func pushTag(ctx context.Context, tx *sql.Tx, userID, policy string, mutation models.SyncMutation) (models.SyncMutationResult, error) {
+	if mutation.Operation != "delete" && mutation.Tag == nil {
+		return rejectedMutation(mutation, "missing tag"), nil
+	}
+
+	if mutation.Operation == "create" {
+		if !validEntityID(mutation.EntityID) {
+			return rejectedMutation(mutation, "invalid entity_id"), nil
+		}
+		query := `
+			INSERT INTO phrase_tags (id, phraseId, tagName, tagColor, createdAt)
+			SELECT COALESCE(NULLIF(?, ''), lower(hex(randomblob(16)))), id, ?, ?, ?
+			FROM phrases
+			WHERE id = ? AND userId = ? AND deletedAt IS NULL
+			RETURNING id, version
+		`
+		t := mutation.Tag
+		result := models.SyncMutationResult{Status: MutationApplied}
+		err := tx.QueryRowContext(ctx, query,
+			mutation.EntityID, t.TagName, t.TagColor, time.Now().UTC().Format(time.RFC3339), t.PhraseID, userID,
+		).Scan(&result.EntityID, &result.Version)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return rejectedMutation(mutation, "phrase not found"), nil
+			}
+			log.Printf("error with pushed tag creation of phraseID %s: %s", t.PhraseID, err.Error())
+			return rejectedMutation(mutation, "tag could not be created"), nil
+		}
+		return result, nil
+	}
+
+	current, err := scanTag(tx.QueryRowContext(ctx, `
+		SELECT pt.id, pt.phraseId, pt.tagName, pt.tagColor, pt.createdAt, pt.version
+		FROM phrase_tags pt
+		JOIN phrases p ON p.id = pt.phraseId
+		WHERE pt.id = ? AND p.userId = ? AND p.deletedAt IS NULL
+	`, mutation.EntityID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return rejectedMutation(mutation, "tag not found"), nil
+		}
+		log.Printf("scanning pushed tag %s: %s", mutation.EntityID, err.Error())
+		return models.SyncMutationResult{}, errorcode.ErrScanningRow
+	}
+
+	conflict := current.Version != mutation.BaseVersion
+	if conflict && policy != SyncPolicyLastWriterWins {
+		return models.SyncMutationResult{
+			Status:   MutationConflict,
+			EntityID: current.ID,
+			Version:  current.Version,
+			Conflict: true,
+			Tag:      &current,
+		}, nil
+	}
+
+	result := models.SyncMutationResult{Status: MutationApplied, EntityID: current.ID, Conflict: conflict}
+	switch mutation.Operation {
+	case "update":
+		query := `UPDATE phrase_tags SET tagName = ?, tagColor = ?, version = version + 1 WHERE id = ? RETURNING version`
+		err = tx.QueryRowContext(ctx, query, mutation.Tag.TagName, mutation.Tag.TagColor, current.ID).Scan(&result.Version)
+	case "delete":
+		_, err = tx.ExecContext(ctx, `DELETE FROM phrase_tags WHERE id = ?`, current.ID)
+		result.Version = current.Version + 1
+	default:
+		return rejectedMutation(mutation, "unknown operation"), nil
+	}
+	if err != nil {
+		log.Printf("error applying pushed %s of tag %s: %s", mutation.Operation, current.ID, err.Error())
+		return models.SyncMutationResult{}, errorcode.ErrDBUpdate
+	}
+	return result, nil
+}
+
+// validEntityID reports whether a client chosen ID for a new phrase or tag looks like one the database generates.
+// An empty ID is valid, as the database then generates one.
+func validEntityID(id string) bool {
+	return id == "" || idgen.IsValid(id, idgen.EntityIDSize, idgen.EntityIDCharset)
+}
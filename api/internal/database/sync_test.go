@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+func newTestUser(t *testing.T, db *sql.DB, username string) models.User {
+	t.Helper()
+	user := models.User{Username: username, Email: username + "@example.com"}
+	userModel := UserModel{DB: db}
+	if err := userModel.Create(context.Background(), &user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return user
+}
+
+// newTestPhrase creates a phrase for the user with a tag for each name.
+func newTestPhrase(t *testing.T, db *sql.DB, userID, phrase string, tagNames ...string) (models.Phrase, []models.PhraseTag) {
+	t.Helper()
+	ctx := context.Background()
+	phraseModel := PhraseModel{DB: db}
+	p := models.Phrase{UserID: userID, Phrase: phrase, PhraseDefinition: phrase + " definition"}
+	if err := phraseModel.CreatePhrase(ctx, &p); err != nil {
+		t.Fatalf("Failed to create phrase: %v", err)
+	}
+	var tags []models.PhraseTag
+	for _, name := range tagNames {
+		tag := models.PhraseTag{PhraseID: p.ID, TagName: name, TagColor: "blue"}
+		if err := phraseModel.CreateTag(ctx, &tag); err != nil {
+			t.Fatalf("Failed to create tag: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	return p, tags
+}
+
+func TestChanges(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	syncModel := SyncModel{DB: db}
+	user := newTestUser(t, db, "alice")
+	other := newTestUser(t, db, "bob")
+
+	kept, keptTags := newTestPhrase(t, db, user.ID, "kept", "noun", "verb")
+	purged, purgedTags := newTestPhrase(t, db, user.ID, "purged", "adjective")
+	newTestPhrase(t, db, other.ID, "not mine", "noun")
+
+	changes, err := syncModel.Changes(ctx, user.ID, "", 100)
+	if err != nil {
+		t.Fatalf("Failed to get changes: %v", err)
+	}
+	if len(changes.Phrases.Created) != 2 || len(changes.Tags.Created) != 3 {
+		t.Fatalf("Expected 2 phrases and 3 tags created, got %d and %d", len(changes.Phrases.Created), len(changes.Tags.Created))
+	}
+	cursor := changes.Cursor
+
+	t.Run("Updates And Deletes", func(t *testing.T) {
+		phraseModel := PhraseModel{DB: db}
+		if err := phraseModel.DeleteTag(ctx, kept.ID, keptTags[1].ID, user.ID); err != nil {
+			t.Fatalf("Failed to delete tag: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE phrase_tags SET tagColor = 'red' WHERE id = ?`, keptTags[0].ID); err != nil {
+			t.Fatalf("Failed to update tag: %v", err)
+		}
+		// A hard delete takes the tags with it through ON DELETE CASCADE.
+		if _, err := db.Exec(`DELETE FROM phrases WHERE id = ?`, purged.ID); err != nil {
+			t.Fatalf("Failed to delete phrase: %v", err)
+		}
+
+		changes, err := syncModel.Changes(ctx, user.ID, cursor, 100)
+		if err != nil {
+			t.Fatalf("Failed to get changes: %v", err)
+		}
+		if len(changes.Tags.Updated) != 1 || changes.Tags.Updated[0].TagColor != "red" {
+			t.Errorf("Expected the recoloured tag to be updated, got %+v", changes.Tags.Updated)
+		}
+		for _, id := range []string{keptTags[1].ID, purgedTags[0].ID} {
+			if !slices.Contains(changes.Tags.Deleted, id) {
+				t.Errorf("Expected tag %s to be deleted, got %v", id, changes.Tags.Deleted)
+			}
+		}
+		if len(changes.Phrases.Deleted) != 1 || changes.Phrases.Deleted[0] != purged.ID {
+			t.Errorf("Expected the purged phrase to be deleted, got %v", changes.Phrases.Deleted)
+		}
+	})
+
+	t.Run("Other Users", func(t *testing.T) {
+		changes, err := syncModel.Changes(ctx, other.ID, "", 100)
+		if err != nil {
+			t.Fatalf("Failed to get changes: %v", err)
+		}
+		if len(changes.Phrases.Created) != 1 || len(changes.Tags.Created) != 1 || len(changes.Tags.Deleted) != 0 {
+			t.Errorf("Expected only the other user's phrase and tag, got %+v", changes)
+		}
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		changes, err := syncModel.Changes(ctx, user.ID, "", 2)
+		if err != nil {
+			t.Fatalf("Failed to get changes: %v", err)
+		}
+		if !changes.HasMore {
+			t.Error("Expected more changes after the first page")
+		}
+		if _, err := syncModel.Changes(ctx, user.ID, "not a cursor", 2); err == nil {
+			t.Error("Expected an invalid cursor to be refused")
+		}
+	})
+}
+
+func TestPush(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	syncModel := SyncModel{DB: db}
+	user := newTestUser(t, db, "alice")
+	other := newTestUser(t, db, "bob")
+
+	live, liveTags := newTestPhrase(t, db, user.ID, "live", "noun")
+	trashed, trashedTags := newTestPhrase(t, db, user.ID, "trashed", "verb")
+	theirs, theirTags := newTestPhrase(t, db, other.ID, "theirs", "noun")
+	phraseModel := PhraseModel{DB: db}
+	if err := phraseModel.DeletePhrase(ctx, trashed.ID, user.ID); err != nil {
+		t.Fatalf("Failed to trash phrase: %v", err)
+	}
+	trashedVersion := 2
+
+	newPhrase := &models.Phrase{Phrase: "new", PhraseDefinition: "changed"}
+	newTag := func(phraseID string) *models.PhraseTag {
+		return &models.PhraseTag{PhraseID: phraseID, TagName: "tag", TagColor: "red"}
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		mutation models.SyncMutation
+		status   string
+		error    string
+	}{
+		{"Update", SyncPolicyReject, models.SyncMutation{Entity: "phrase", Operation: "update", EntityID: live.ID, BaseVersion: 1, Phrase: newPhrase}, MutationApplied, ""},
+		{"Stale Update", SyncPolicyReject, models.SyncMutation{Entity: "phrase", Operation: "update", EntityID: live.ID, BaseVersion: 1, Phrase: newPhrase}, MutationConflict, ""},
+		{"Stale Update Last Writer Wins", SyncPolicyLastWriterWins, models.SyncMutation{Entity: "phrase", Operation: "update", EntityID: live.ID, BaseVersion: 1, Phrase: newPhrase}, MutationApplied, ""},
+		{"Update Trashed Phrase", SyncPolicyReject, models.SyncMutation{Entity: "phrase", Operation: "update", EntityID: trashed.ID, BaseVersion: trashedVersion, Phrase: newPhrase}, MutationRejected, "phrase is in the trash"},
+		{"Delete Trashed Phrase", SyncPolicyReject, models.SyncMutation{Entity: "phrase", Operation: "delete", EntityID: trashed.ID, BaseVersion: trashedVersion}, MutationApplied, ""},
+		{"Tag On Trashed Phrase", SyncPolicyReject, models.SyncMutation{Entity: "tag", Operation: "create", Tag: newTag(trashed.ID)}, MutationRejected, "phrase not found"},
+		{"Update Tag On Trashed Phrase", SyncPolicyReject, models.SyncMutation{Entity: "tag", Operation: "update", EntityID: trashedTags[0].ID, BaseVersion: 1, Tag: newTag(trashed.ID)}, MutationRejected, "tag not found"},
+		{"Update Their Phrase", SyncPolicyLastWriterWins, models.SyncMutation{Entity: "phrase", Operation: "update", EntityID: theirs.ID, BaseVersion: 1, Phrase: newPhrase}, MutationRejected, "phrase not found"},
+		{"Delete Their Tag", SyncPolicyLastWriterWins, models.SyncMutation{Entity: "tag", Operation: "delete", EntityID: theirTags[0].ID, BaseVersion: 1}, MutationRejected, "tag not found"},
+		{"Tag On Their Phrase", SyncPolicyReject, models.SyncMutation{Entity: "tag", Operation: "create", Tag: newTag(theirs.ID)}, MutationRejected, "phrase not found"},
+		{"Create With Their ID", SyncPolicyReject, models.SyncMutation{Entity: "phrase", Operation: "create", EntityID: theirs.ID, Phrase: newPhrase}, MutationRejected, "phrase could not be created"},
+		{"Create With Invalid ID", SyncPolicyReject, models.SyncMutation{Entity: "phrase", Operation: "create", EntityID: "../../admin", Phrase: newPhrase}, MutationRejected, "invalid entity_id"},
+		{"Tag With Invalid ID", SyncPolicyReject, models.SyncMutation{Entity: "tag", Operation: "create", EntityID: "TAG", Tag: newTag(live.ID)}, MutationRejected, "invalid entity_id"},
+		{"Delete Tag", SyncPolicyReject, models.SyncMutation{Entity: "tag", Operation: "delete", EntityID: liveTags[0].ID, BaseVersion: 1}, MutationApplied, ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mutation.ClientID = fmt.Sprintf("mutation-%d", i)
+			results, err := syncModel.Push(ctx, user.ID, tt.policy, []models.SyncMutation{tt.mutation})
+			if err != nil {
+				t.Fatalf("Failed to push: %v", err)
+			}
+			if results[0].Status != tt.status || results[0].Error != tt.error {
+				t.Errorf("Expected %s %q, got %s %q", tt.status, tt.error, results[0].Status, results[0].Error)
+			}
+		})
+	}
+
+	t.Run("Stored Values", func(t *testing.T) {
+		var phrase, updatedAt string
+		if err := db.QueryRow(`SELECT phrase FROM phrases WHERE id = ?`, theirs.ID).Scan(&phrase); err != nil {
+			t.Fatalf("Failed to read phrase: %v", err)
+		}
+		if phrase != "theirs" {
+			t.Errorf("Expected another user's phrase to be untouched, got %s", phrase)
+		}
+		if err := db.QueryRow(`SELECT updatedAt FROM phrases WHERE id = ?`, live.ID).Scan(&updatedAt); err != nil {
+			t.Fatalf("Failed to read phrase: %v", err)
+		}
+		if _, err := time.Parse(time.RFC3339, updatedAt); err != nil {
+			t.Errorf("Expected updatedAt in RFC3339, got %s", updatedAt)
+		}
+	})
+
+	t.Run("Client Chosen IDs", func(t *testing.T) {
+		phraseID := strings.Repeat("a", 32)
+		results, err := syncModel.Push(ctx, user.ID, SyncPolicyReject, []models.SyncMutation{
+			{ClientID: "create-phrase", Entity: "phrase", Operation: "create", EntityID: phraseID, Phrase: newPhrase},
+			{ClientID: "create-tag", Entity: "tag", Operation: "create", Tag: newTag(phraseID)},
+		})
+		if err != nil {
+			t.Fatalf("Failed to push: %v", err)
+		}
+		if results[0].EntityID != phraseID || results[1].Status != MutationApplied {
+			t.Errorf("Expected the new phrase to keep its ID and take a tag, got %+v", results)
+		}
+		results, err = syncModel.Push(ctx, user.ID, SyncPolicyReject, []models.SyncMutation{
+			{ClientID: "create-phrase", Entity: "phrase", Operation: "create", EntityID: phraseID, Phrase: newPhrase},
+		})
+		if err != nil || results[0].Status != MutationDuplicate {
+			t.Errorf("Expected a retried mutation to be a duplicate, got %+v, %v", results, err)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/utils"
+)
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// lastUsedResolution limits how often a token's lastUsedAt is written, so busy clients do not write on every request.
+const lastUsedResolution = time.Minute
+
+// Create stores a personal access token by its hash. The plain token is never persisted.
+func (m *TokenModel) Create(ctx context.Context, token *models.APIToken, hash string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	token.CreatedAt = time.Now().UTC()
+	var expiresAt any
+	if token.ExpiresAt != nil {
+		expiresAt = token.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	query := `
+		INSERT INTO api_tokens (id, userId, name, tokenHash, prefix, scopes, expiresAt, createdAt)
+		VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		token.UserID, token.Name, hash, token.Prefix, strings.Join(token.Scopes, ","), expiresAt, token.CreatedAt.Format(time.RFC3339),
+	).Scan(&token.ID)
+	if err != nil {
+		log.Printf("error with token creation of userID %s: %s", token.UserID, err.Error())
+		return errorcode.ErrDBCreate
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
+
+func (m *TokenModel) ByUserID(ctx context.Context, userID string) ([]models.APIToken, error) {
+	query := `
+		SELECT id, userId, name, prefix, scopes, expiresAt, lastUsedAt, createdAt
+		FROM api_tokens
+		WHERE userId = ?
+		ORDER BY createdAt DESC, id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		log.Printf("querying tokens: %s", err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			log.Printf("scanning token row: %s", err.Error())
+			return nil, errorcode.ErrScanningRow
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating token rows: %s", err.Error())
+		return nil, errorcode.ErrIteratingRows
+	}
+
+	return tokens, nil
+}
+
+// Validate looks up an unexpired token of an enabled user by its hash and records that it was used.
+func (m *TokenModel) Validate(ctx context.Context, hash string) (models.APIToken, error) {
+	query := `
+		SELECT t.id, t.userId, t.name, t.prefix, t.scopes, t.expiresAt, t.lastUsedAt, t.createdAt, u.disabledAt IS NOT NULL
+		FROM api_tokens t
+		JOIN users u ON t.userId = u.id
+		WHERE t.tokenHash = ?
+	`
+	var userDisabled bool
+	token, err := scanToken(withExtraColumns(m.DB.QueryRowContext(ctx, query, hash), &userDisabled))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIToken{}, errorcode.ErrInvalidToken
+		}
+		log.Printf("scanning token row: %s", err.Error())
+		return models.APIToken{}, errorcode.ErrScanningRow
+	}
+	if userDisabled {
+		return models.APIToken{}, errorcode.ErrUserDisabled
+	}
+
+	now := time.Now().UTC()
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(now) {
+		return models.APIToken{}, errorcode.ErrInvalidToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		_, err := m.DB.ExecContext(ctx, `UPDATE api_tokens SET lastUsedAt = ? WHERE id = ?`, now.Format(time.RFC3339), token.ID)
+		if err != nil {
+			// A stale last used time is not worth failing the request over.
+			log.Printf("error updating last use of token %s: %s", token.ID, err.Error())
+		} else {
+			token.LastUsedAt = &now
+		}
+	}
+
+	return token, nil
+}
+
+// Delete revokes a token. Tokens are checked against the table on every request, so this takes effect immediately.
+func (m *TokenModel) Delete(ctx context.Context, id, userID string) error {
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND userId = ?`, id, userID)
+	if err != nil {
+		log.Printf("error deleting token %s for user %s: %s", id, userID, err.Error())
+		return errorcode.ErrDBDelete
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBDelete
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+func scanToken(scanner scanner) (models.APIToken, error) {
+	var token models.APIToken
+	var scopes, createdAtStr string
+	var expiresAtStr, lastUsedAtStr sql.NullString
+
+	err := scanner.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &scopes, &expiresAtStr, &lastUsedAtStr, &createdAtStr)
+	if err != nil {
+		return token, err
+	}
+
+	token.Scopes = strings.Split(scopes, ",")
+	token.CreatedAt, err = utils.StringToTime(createdAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for token %s", createdAtStr, token.ID)
+		token.CreatedAt = time.Now().UTC()
+	}
+	if expiresAtStr.Valid {
+		expiresAt, err := utils.StringToTime(expiresAtStr.String)
+		if err != nil {
+			// Treat an unreadable expiry as already expired rather than as never expiring.
+			log.Printf("Warning: could not parse expiresAt '%s' for token %s", expiresAtStr.String, token.ID)
+			expiresAt = time.Time{}
+		}
+		token.ExpiresAt = &expiresAt
+	}
+	if lastUsedAtStr.Valid {
+		lastUsedAt, err := utils.StringToTime(lastUsedAtStr.String)
+		if err != nil {
+			log.Printf("Warning: could not parse lastUsedAt '%s' for token %s", lastUsedAtStr.String, token.ID)
+		} else {
+			token.LastUsedAt = &lastUsedAt
+		}
+	}
+
+	return token, nil
+}
@@ -3,9 +3,13 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/arinji2/vocab-thing/internal/auth"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
 	"github.com/arinji2/vocab-thing/internal/utils"
@@ -15,36 +19,99 @@ type UserModel struct {
 	DB *sql.DB
 }
 
-func (m *UserModel) GetAll(ctx context.Context) ([]models.User, error) {
-	query := `SELECT id, username, email, createdAt FROM users;`
+// userColumns are the columns read by scanUser, in order.
+const userColumns = `id, username, email, role, disabledAt, createdAt`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+func (m *UserModel) ByID(ctx context.Context, id string) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+
+	user, err := scanUser(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("user not found with id %s: %s", id, err.Error())
+			return models.User{}, errorcode.ErrDBQuery
+		}
+		log.Printf("scanning user row: %s", err.Error())
+		return models.User{}, errorcode.ErrScanningRow
+	}
+
+	return user, nil
+}
+
+func (m *UserModel) ByUsername(ctx context.Context, username string) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+
+	user, err := scanUser(m.DB.QueryRowContext(ctx, query, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("user not found with username %s: %s", username, err.Error())
+			return models.User{}, sql.ErrNoRows
+		}
+		log.Printf("scanning user row: %s", err.Error())
+		return models.User{}, errorcode.ErrScanningRow
+	}
+
+	return user, nil
+}
+
+func (m *UserModel) ByEmail(ctx context.Context, email string) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ?`
+
+	user, err := scanUser(m.DB.QueryRowContext(ctx, query, email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("user not found with email %s: %s", email, err.Error())
+			return models.User{}, sql.ErrNoRows
+		}
+		log.Printf("scanning user row: %s", err.Error())
+		return models.User{}, errorcode.ErrScanningRow
+	}
+
+	return user, nil
+}
+
+// List returns one page of users, newest first. A non-empty search keeps users whose username or email contains it.
+func (m *UserModel) List(ctx context.Context, pageNumber, pageSize int, search string) (*models.UserPage, error) {
+	where := `1 = 1`
+	var args []any
+	if search != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search) + "%"
+		where = `(username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern)
+	}
+
+	var totalRecords int
+	if err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&totalRecords); err != nil {
+		log.Printf("counting users: %s", err.Error())
+		return nil, errorcode.ErrDBQuery
+	}
+	totalPages := int(math.Ceil(float64(totalRecords) / float64(pageSize)))
+	if totalPages > 0 && pageNumber > totalPages {
+		return nil, errorcode.ErrPageOutOfRange.WithDetails(map[string]int{"totalPages": totalPages})
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where + ` ORDER BY createdAt DESC, id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.QueryContext(ctx, query, append(args, pageSize, (pageNumber-1)*pageSize)...)
 	if err != nil {
 		log.Printf("querying users: %s", err.Error())
 		return nil, errorcode.ErrDBQuery
 	}
 	defer rows.Close()
 
-	var users []models.User
-
+	page := &models.UserPage{
+		Items:      []models.User{},
+		TotalCount: totalRecords,
+		TotalPages: totalPages,
+		Page:       pageNumber,
+		PageSize:   pageSize,
+	}
 	for rows.Next() {
-		var user models.User
-		var createdAtStr string
-
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &createdAtStr)
+		user, err := scanUser(rows)
 		if err != nil {
 			log.Printf("scanning user row: %s", err.Error())
 			return nil, errorcode.ErrScanningRow
 		}
-
-		parsedTime, err := utils.StringToTime(createdAtStr)
-		if err != nil {
-			log.Printf("Warning: could not parse createdAt '%s' for user %s", createdAtStr, user.ID)
-			parsedTime = time.Now().UTC()
-		}
-		user.CreatedAt = parsedTime
-
-		users = append(users, user)
+		page.Items = append(page.Items, user)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -52,116 +119,287 @@ func (m *UserModel) GetAll(ctx context.Context) ([]models.User, error) {
 		return nil, errorcode.ErrIteratingRows
 	}
 
-	return users, nil
+	return page, nil
 }
 
-func (m *UserModel) ByID(ctx context.Context, id string) (models.User, error) {
-	query := `SELECT id, username, email, createdAt FROM users WHERE id = ?`
-
-	row := m.DB.QueryRowContext(ctx, query, id)
-
-	var user models.User
-	var createdAtStr string
+// Detail returns the user with the types of their providers and counts of their active sessions and phrases outside the trash.
+func (m *UserModel) Detail(ctx context.Context, id string) (models.UserDetail, error) {
+	query := `SELECT ` + userColumns + `,
+		(SELECT COUNT(*) FROM sessions WHERE userId = users.id AND datetime(expiresAt) > datetime('now')),
+		(SELECT COUNT(*) FROM phrases WHERE userId = users.id AND deletedAt IS NULL)
+		FROM users WHERE id = ?`
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &createdAtStr)
+	var detail models.UserDetail
+	user, err := scanUser(withExtraColumns(m.DB.QueryRowContext(ctx, query, id), &detail.SessionCount, &detail.PhraseCount))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("user not found with id %s: %s", id, err.Error())
-			return models.User{}, errorcode.ErrDBQuery
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserDetail{}, errorcode.ErrUserNotFound
 		}
 		log.Printf("scanning user row: %s", err.Error())
-		return models.User{}, errorcode.ErrScanningRow
+		return models.UserDetail{}, errorcode.ErrScanningRow
 	}
+	detail.User = user
 
-	parsedTime, err := utils.StringToTime(createdAtStr)
+	rows, err := m.DB.QueryContext(ctx, `SELECT type FROM providers WHERE userId = ? ORDER BY createdAt, id`, id)
 	if err != nil {
-		log.Printf("Warning: could not parse createdAt '%s' for user %s", createdAtStr, user.ID)
-		parsedTime = time.Now().UTC()
+		log.Printf("querying providers of user %s: %s", id, err.Error())
+		return models.UserDetail{}, errorcode.ErrDBQuery
 	}
+	defer rows.Close()
 
-	user.CreatedAt = parsedTime
-
-	return user, nil
-}
+	detail.ProviderTypes = []string{}
+	for rows.Next() {
+		var providerType string
+		if err := rows.Scan(&providerType); err != nil {
+			log.Printf("scanning provider row: %s", err.Error())
+			return models.UserDetail{}, errorcode.ErrScanningRow
+		}
+		detail.ProviderTypes = append(detail.ProviderTypes, providerType)
+	}
 
-func (m *UserModel) ByUsername(ctx context.Context, username string) (models.User, error) {
-	query := `SELECT id, username, email, createdAt FROM users WHERE username = ?`
+	if err := rows.Err(); err != nil {
+		log.Printf("iterating provider rows: %s", err.Error())
+		return models.UserDetail{}, errorcode.ErrIteratingRows
+	}
 
-	row := m.DB.QueryRowContext(ctx, query, username)
+	return detail, nil
+}
 
-	var user models.User
-	var createdAtStr string
+// SetDisabled disables or re-enables a user. A disabled user cannot sign in and their sessions and tokens stop
+// working at once; disabling an already disabled user keeps the original time.
+func (m *UserModel) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	query := `UPDATE users SET disabledAt = NULL WHERE id = ?`
+	args := []any{id}
+	if disabled {
+		query = `UPDATE users SET disabledAt = COALESCE(disabledAt, ?) WHERE id = ?`
+		args = []any{time.Now().UTC().Format(time.RFC3339), id}
+	}
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &createdAtStr)
+	res, err := m.DB.ExecContext(ctx, query, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("user not found with username %s: %s", username, err.Error())
-			return models.User{}, sql.ErrNoRows
-		}
-		log.Printf("scanning user row: %s", err.Error())
-		return models.User{}, errorcode.ErrScanningRow
+		log.Printf("error updating disabled state of user %s: %s", id, err.Error())
+		return errorcode.ErrDBUpdate
 	}
 
-	parsedTime, err := utils.StringToTime(createdAtStr)
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		log.Printf("could not parse createdAt '%s' for user %s: %s", createdAtStr, user.ID, err.Error())
-		parsedTime = time.Now().UTC()
+		log.Printf("error checking affected rows: %s", err.Error())
+		return errorcode.ErrDBUpdate
+	}
+	if rowsAffected == 0 {
+		return errorcode.ErrUserNotFound
 	}
-	user.CreatedAt = parsedTime
 
-	return user, nil
+	return nil
 }
 
-func (m *UserModel) ByEmail(ctx context.Context, email string) (models.User, error) {
-	query := `SELECT id, username, email, createdAt FROM users WHERE email = ?`
+// Create stores a new user, with the user role unless another is set.
+func (m *UserModel) Create(ctx context.Context, user *models.User) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
 
-	row := m.DB.QueryRowContext(ctx, query, email)
+	user.CreatedAt = time.Now().UTC()
+	if user.Role == "" {
+		user.Role = auth.RoleUser
+	}
+	query := `INSERT INTO users (id, username, email, role, createdAt) 
+          VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?) RETURNING id, role`
 
-	var user models.User
-	var createdAtStr string
+	err = tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Role, user.CreatedAt.Format(time.RFC3339)).Scan(&user.ID, &user.Role)
+	if err != nil {
+		log.Printf("error with user creation of username %s: %s", user.Username, err.Error())
+		return errorcode.ErrDBCreate
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
+	}
+
+	return nil
+}
 
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &createdAtStr)
+// Delete removes the user for good. Sessions are revoked first and pending login links for the address are
+// dropped; everything else the user owns goes with the user row through ON DELETE CASCADE. Phrases are deleted
+// before the user, as their delete triggers write to the user's sync change log.
+func (m *UserModel) Delete(ctx context.Context, id string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("user not found with email %s: %s", email, err.Error())
-			return models.User{}, sql.ErrNoRows
+		log.Printf("starting transaction: %s", err.Error())
+		return errorcode.ErrTransactionStart
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM sessions WHERE userId = ?`,
+		`DELETE FROM email_login_tokens WHERE email = (SELECT email FROM users WHERE id = ?)`,
+		`DELETE FROM phrases WHERE userId = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	}
+	for _, query := range statements {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			log.Printf("error deleting user %s: %s", id, err.Error())
+			return errorcode.ErrDBDelete
 		}
-		log.Printf("scanning user row: %s", err.Error())
-		return models.User{}, errorcode.ErrScanningRow
 	}
 
-	parsedTime, err := utils.StringToTime(createdAtStr)
-	if err != nil {
-		log.Printf("Warning: could not parse createdAt '%s' for user %s", createdAtStr, user.ID)
-		parsedTime = time.Now().UTC()
+	if err := tx.Commit(); err != nil {
+		log.Printf("committing transaction: %s", err.Error())
+		return errorcode.ErrTransactionCommit
 	}
-	user.CreatedAt = parsedTime
 
-	return user, nil
+	return nil
 }
 
-func (m *UserModel) Create(ctx context.Context, user *models.User) error {
+// UpgradeGuest moves a guest account onto an OAuth identity in a single transaction. When no
+// user has the OAuth email yet the guest user is converted in place; otherwise its phrases,
+// tags and reviews are merged into that user and the guest user is deleted. Either way the
+// guest's access tokens and provider row, and with it every guest session, are removed.
+func (m *UserModel) UpgradeGuest(ctx context.Context, guestID string, oauthUser models.User, oauthProvider models.OauthProvider) (models.User, models.OauthProvider, error) {
 	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		log.Printf("starting transaction: %s", err.Error())
-		return errorcode.ErrTransactionStart
+		return models.User{}, models.OauthProvider{}, errorcode.ErrTransactionStart
 	}
 	defer tx.Rollback()
 
-	user.CreatedAt = time.Now().UTC()
-	query := `INSERT INTO users (id, username, email, createdAt) 
-          VALUES (lower(hex(randomblob(16))), ?, ?, ?) RETURNING id`
+	// The identity's owner is found by provider subject first, falling back to email for accounts linked before subjects were stored.
+	target, err := scanUser(tx.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE id = (SELECT userId FROM providers WHERE type = ? AND subject = NULLIF(?, ''))
+	`, oauthProvider.Type, oauthProvider.Subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		target, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`, oauthUser.Email))
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("scanning user row: %s", err.Error())
+		return models.User{}, models.OauthProvider{}, errorcode.ErrScanningRow
+	}
+
+	// Whoever held the guest cookie could have created these, so they must not carry over to the signed in account.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM api_tokens WHERE userId = ?`, guestID); err != nil {
+		log.Printf("error deleting access tokens of guest user %s: %s", guestID, err.Error())
+		return models.User{}, models.OauthProvider{}, errorcode.ErrGuestUpgrade
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		target, err = scanUser(tx.QueryRowContext(ctx, `UPDATE users SET username = ?, email = ? WHERE id = ? RETURNING `+userColumns,
+			oauthUser.Username, oauthUser.Email, guestID,
+		))
+		if err != nil {
+			log.Printf("error converting guest user %s: %s", guestID, err.Error())
+			return models.User{}, models.OauthProvider{}, errorcode.ErrGuestUpgrade
+		}
+	case target.DisabledAt != nil:
+		// The guest's data must not end up in an account nobody can sign in to.
+		return models.User{}, models.OauthProvider{}, errorcode.ErrUserDisabled
+	case target.ID == guestID:
+		// The guest somehow already owns the email; there is nothing to merge.
+	default:
+		if err := mergeGuest(ctx, tx, guestID, target.ID); err != nil {
+			return models.User{}, models.OauthProvider{}, err
+		}
+	}
 
-	err = tx.QueryRowContext(ctx, query, user.Username, user.Email, user.CreatedAt.Format(time.RFC3339)).Scan(&user.ID)
+	oauthProvider.UserID = target.ID
+	accessToken, refreshToken, err := sealProviderTokens(oauthProvider)
 	if err != nil {
-		log.Printf("error with user creation of username %s: %s", user.Username, err.Error())
-		return errorcode.ErrDBCreate
+		return models.User{}, models.OauthProvider{}, err
+	}
+	var subject string
+	err = tx.QueryRowContext(ctx, `SELECT id, COALESCE(subject, '') FROM providers WHERE userId = ? AND type = ?`,
+		target.ID, oauthProvider.Type).Scan(&oauthProvider.ID, &subject)
+	switch {
+	case err == nil && subject != "" && subject != oauthProvider.Subject:
+		// The email matched an account linked to another identity at the provider, which must not be taken over.
+		return models.User{}, models.OauthProvider{}, errorcode.ErrIdentityMismatch
+	case errors.Is(err, sql.ErrNoRows):
+		err = tx.QueryRowContext(ctx, `INSERT INTO providers (id, userId, type, subject, refreshToken, accessToken, expiresAt)
+			VALUES (lower(hex(randomblob(16))), ?, ?, NULLIF(?, ''), ?, ?, ?) RETURNING id`,
+			oauthProvider.UserID, oauthProvider.Type, oauthProvider.Subject, refreshToken, accessToken, oauthProvider.ExpiresAt.Format(time.RFC3339),
+		).Scan(&oauthProvider.ID)
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `UPDATE providers SET subject = COALESCE(NULLIF(subject, ''), NULLIF(?, '')), refreshToken = ?, accessToken = ?, expiresAt = ? WHERE id = ?`,
+			oauthProvider.Subject, refreshToken, accessToken, oauthProvider.ExpiresAt.Format(time.RFC3339), oauthProvider.ID)
+	}
+	if err != nil {
+		log.Printf("error attaching %s provider to user %s: %s", oauthProvider.Type, target.ID, err.Error())
+		return models.User{}, models.OauthProvider{}, errorcode.ErrGuestUpgrade
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM providers WHERE userId = ? AND type = 'guest'`, target.ID); err != nil {
+		log.Printf("error retiring guest provider of user %s: %s", target.ID, err.Error())
+		return models.User{}, models.OauthProvider{}, errorcode.ErrGuestUpgrade
 	}
 
 	if err := tx.Commit(); err != nil {
 		log.Printf("committing transaction: %s", err.Error())
-		return errorcode.ErrTransactionCommit
+		return models.User{}, models.OauthProvider{}, errorcode.ErrTransactionCommit
+	}
+
+	return target, oauthProvider, nil
+}
+
+// mergeGuest moves everything a guest owns onto the target user and deletes the guest.
+// The moved phrases and tags are recorded as created in the target's sync change log so
+// the target's devices pick them up.
+func mergeGuest(ctx context.Context, tx *sql.Tx, guestID, targetID string) error {
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO sync_changes (userId, entityType, entityId, operation)
+			SELECT ?, 'phrase', id, 'create' FROM phrases WHERE userId = ? AND deletedAt IS NULL ORDER BY createdAt`, []any{targetID, guestID}},
+		{`INSERT INTO sync_changes (userId, entityType, entityId, operation)
+			SELECT ?, 'tag', pt.id, 'create' FROM phrase_tags pt JOIN phrases p ON p.id = pt.phraseId
+			WHERE p.userId = ? ORDER BY pt.createdAt`, []any{targetID, guestID}},
+		{`UPDATE phrases SET userId = ? WHERE userId = ?`, []any{targetID, guestID}},
+		{`UPDATE phrase_reviews SET userId = ? WHERE userId = ?`, []any{targetID, guestID}},
+		{`UPDATE OR IGNORE sync_mutations SET userId = ? WHERE userId = ?`, []any{targetID, guestID}},
+		{`UPDATE sync_metadata SET lastUpdatedAt = ? WHERE userId = ?`, []any{time.Now().UTC(), targetID}},
+		// Cascades to the guest's providers, sessions, sync metadata and change log.
+		{`DELETE FROM users WHERE id = ?`, []any{guestID}},
+	}
+
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			log.Printf("error merging guest user %s into %s: %s", guestID, targetID, err.Error())
+			return errorcode.ErrGuestUpgrade
+		}
 	}
 
 	return nil
 }
+
+func scanUser(scanner scanner) (models.User, error) {
+	var user models.User
+	var createdAtStr string
+	var disabledAtStr sql.NullString
+
+	if err := scanner.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &disabledAtStr, &createdAtStr); err != nil {
+		return models.User{}, err
+	}
+
+	parsedTime, err := utils.StringToTime(createdAtStr)
+	if err != nil {
+		log.Printf("Warning: could not parse createdAt '%s' for user %s", createdAtStr, user.ID)
+		parsedTime = time.Now().UTC()
+	}
+	user.CreatedAt = parsedTime
+
+	if disabledAtStr.Valid {
+		disabledAt, err := utils.StringToTime(disabledAtStr.String)
+		if err != nil {
+			log.Printf("Warning: could not parse disabledAt '%s' for user %s", disabledAtStr.String, user.ID)
+			disabledAt = time.Now().UTC()
+		}
+		user.DisabledAt = &disabledAt
+	}
+
+	return user, nil
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+func newTestProvider(t *testing.T, db *sql.DB, userID, providerType, subject string) models.OauthProvider {
+	t.Helper()
+	provider := models.OauthProvider{UserID: userID, Type: providerType, Subject: subject}
+	providerModel := ProviderModel{DB: db}
+	if err := providerModel.Create(context.Background(), &provider); err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider
+}
+
+func providerSubject(t *testing.T, db *sql.DB, id string) string {
+	t.Helper()
+	var subject sql.NullString
+	if err := db.QueryRow(`SELECT subject FROM providers WHERE id = ?`, id).Scan(&subject); err != nil {
+		t.Fatalf("Failed to read provider: %v", err)
+	}
+	return subject.String
+}
+
+func TestUpgradeGuest(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	userModel := UserModel{DB: db}
+
+	owner := newTestUser(t, db, "owner")
+	ownerGitHub := newTestProvider(t, db, owner.ID, "github", "111")
+	other := newTestUser(t, db, "other")
+	legacy := newTestUser(t, db, "legacy")
+	legacyGitHub := newTestProvider(t, db, legacy.ID, "github", "")
+
+	newGuest := func(name string) models.User {
+		guest := newTestUser(t, db, name)
+		newTestProvider(t, db, guest.ID, "guest", "")
+		return guest
+	}
+	upgrade := func(guestID, email, subject string) (models.User, models.OauthProvider, error) {
+		return userModel.UpgradeGuest(ctx, guestID, models.User{Username: "upgraded", Email: email},
+			models.OauthProvider{Type: "github", Subject: subject})
+	}
+
+	t.Run("Email Of Another Identity", func(t *testing.T) {
+		guest := newGuest("guest-a")
+		_, _, err := upgrade(guest.ID, owner.Email, "222")
+		if !errors.Is(err, errorcode.ErrIdentityMismatch) {
+			t.Fatalf("Expected ErrIdentityMismatch, got %v", err)
+		}
+		if subject := providerSubject(t, db, ownerGitHub.ID); subject != "111" {
+			t.Errorf("Expected the owner's subject to be kept, got %s", subject)
+		}
+		if _, err := userModel.ByID(ctx, guest.ID); err != nil {
+			t.Errorf("Expected the guest to be left as it was, got %v", err)
+		}
+	})
+
+	t.Run("Subject Wins Over Email", func(t *testing.T) {
+		guest := newGuest("guest-b")
+		target, provider, err := upgrade(guest.ID, other.Email, "111")
+		if err != nil {
+			t.Fatalf("Failed to upgrade: %v", err)
+		}
+		if target.ID != owner.ID || provider.ID != ownerGitHub.ID {
+			t.Errorf("Expected the subject's owner %s, got %s", owner.ID, target.ID)
+		}
+	})
+
+	t.Run("Guest Tokens Are Revoked", func(t *testing.T) {
+		tokenModel := TokenModel{DB: db}
+		// Merged into the owner, and converted in place for an identity nobody has yet.
+		for email, subject := range map[string]string{owner.Email: "111", "new@example.com": "444"} {
+			guest := newGuest("guest-" + email)
+			token := models.APIToken{UserID: guest.ID, Name: "planted", Prefix: "vt_planted", Scopes: []string{"read"}}
+			if err := tokenModel.Create(ctx, &token, "hash-"+email); err != nil {
+				t.Fatalf("Failed to create token: %v", err)
+			}
+			if _, _, err := upgrade(guest.ID, email, subject); err != nil {
+				t.Fatalf("Failed to upgrade: %v", err)
+			}
+			if _, err := tokenModel.Validate(ctx, "hash-"+email); err == nil {
+				t.Errorf("Expected the guest's token to stop working after upgrading to %s", email)
+			}
+		}
+	})
+
+	t.Run("Adopts Provider Without Subject", func(t *testing.T) {
+		guest := newGuest("guest-c")
+		target, _, err := upgrade(guest.ID, legacy.Email, "333")
+		if err != nil {
+			t.Fatalf("Failed to upgrade: %v", err)
+		}
+		if target.ID != legacy.ID {
+			t.Errorf("Expected the legacy user %s, got %s", legacy.ID, target.ID)
+		}
+		if subject := providerSubject(t, db, legacyGitHub.ID); subject != "333" {
+			t.Errorf("Expected the subject to be stored, got %q", subject)
+		}
+	})
+}
+
+func TestUpdateTokensKeepsSubject(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	providerModel := ProviderModel{DB: db}
+	user := newTestUser(t, db, "alice")
+
+	provider := newTestProvider(t, db, user.ID, "github", "111")
+	provider.Subject = "222"
+	provider.AccessToken = "fresh"
+	if err := providerModel.UpdateTokens(ctx, &provider); err != nil {
+		t.Fatalf("Failed to update tokens: %v", err)
+	}
+	if subject := providerSubject(t, db, provider.ID); subject != "111" {
+		t.Errorf("Expected the stored subject to be kept, got %s", subject)
+	}
+
+	legacy := newTestProvider(t, db, user.ID, "discord", "")
+	legacy.Subject = "333"
+	if err := providerModel.UpdateTokens(ctx, &legacy); err != nil {
+		t.Fatalf("Failed to update tokens: %v", err)
+	}
+	if subject := providerSubject(t, db, legacy.ID); subject != "333" {
+		t.Errorf("Expected a missing subject to be filled in, got %q", subject)
+	}
+}
+
+func TestLowercaseEmailsMigration(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	const version = 20250419090000
+	for {
+		current, err := SchemaVersion(ctx, db)
+		if err != nil {
+			t.Fatalf("Failed to read schema version: %v", err)
+		}
+		if current < version {
+			break
+		}
+		if _, err := MigrateDown(ctx, db); err != nil {
+			t.Fatalf("Failed to roll back: %v", err)
+		}
+	}
+
+	mixed := newTestUser(t, db, "mixed")
+	clashA := newTestUser(t, db, "clash-a")
+	clashB := newTestUser(t, db, "clash-b")
+	for id, email := range map[string]string{mixed.ID: "Mixed@Example.com", clashA.ID: "Clash@Example.com", clashB.ID: "CLASH@example.com"} {
+		if _, err := db.Exec(`UPDATE users SET email = ? WHERE id = ?`, email, id); err != nil {
+			t.Fatalf("Failed to set email: %v", err)
+		}
+	}
+	if _, err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	userModel := UserModel{DB: db}
+	if user, err := userModel.ByEmail(ctx, "mixed@example.com"); err != nil || user.ID != mixed.ID {
+		t.Errorf("Expected the email to be lowercased, got %+v, %v", user, err)
+	}
+	if user, err := userModel.ByEmail(ctx, "Clash@Example.com"); err != nil || user.ID != clashA.ID {
+		t.Errorf("Expected clashing emails to be left alone, got %+v, %v", user, err)
+	}
+}
@@ -0,0 +1,183 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks an encrypted value. Anything without it is treated as plaintext written before encryption was enabled.
+const prefix = "enc:v1:"
+
+// KeySize is the size of every key, for AES-256.
+const KeySize = 32
+
+var (
+	ErrUnknownKey = errors.New("envelope: value is encrypted with an unknown key")
+	ErrMalformed  = errors.New("envelope: malformed encrypted value")
+)
+
+// Keyring holds the key encryption keys by ID. New values are sealed with the active key, while any key in the
+// ring can open values, so keys can be rotated by adding a new active key and re-encrypting.
+type Keyring struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+func NewKeyring(keys map[string][]byte, active string) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("envelope: active key %q is not in the keyring", active)
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(keys)), active: active}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("envelope: invalid key ID %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("envelope: key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+
+	return k, nil
+}
+
+// ParseKeys reads keys written as comma separated "id:base64key" pairs. With no active ID the first key is active.
+func ParseKeys(spec, active string) (*Keyring, error) {
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("envelope: key %q must be written as id:base64key", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("envelope: key %q is not valid base64: %w", id, err)
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("envelope: key %q is listed twice", id)
+		}
+		keys[id] = key
+		if active == "" {
+			active = id
+		}
+	}
+
+	return NewKeyring(keys, active)
+}
+
+// ActiveKeyID returns the ID of the key new values are sealed with.
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// Seal encrypts the plaintext with a fresh data key, and the data key with the active key. The result is
+// "enc:v1:<key id>:<sealed data key>:<sealed plaintext>", each sealed part base64 encoded with its nonce in front.
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	// The key ID is authenticated with the data key, so a value cannot be relabelled to another key.
+	sealedKey, err := seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return "", err
+	}
+	sealedText, err := seal(dataAEAD, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + k.active + ":" + sealedKey + ":" + sealedText, nil
+}
+
+// Open decrypts a value from Seal. Values without the envelope prefix are returned as they are.
+func (k *Keyring) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	keyAEAD, ok := k.keys[parts[0]]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	dataKey, err := open(keyAEAD, parts[1], []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	plaintext, err := open(dataAEAD, parts[2], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether the value is plaintext or sealed with a key other than the active one.
+func (k *Keyring) NeedsRotation(value string) bool {
+	if !IsSealed(value) {
+		return true
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id != k.active
+}
+
+// IsSealed reports whether the value was written by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, additionalData)), nil
+}
+
+func open(aead cipher.AEAD, sealed string, additionalData []byte) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,118 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, KeySize))
+}
+
+func TestSealOpen(t *testing.T) {
+	k, err := ParseKeys("one:"+testKey(1), "")
+	if err != nil {
+		t.Fatalf("Failed to parse keys: %v", err)
+	}
+
+	sealed, err := k.Seal("ya29.access-token")
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "access-token") {
+		t.Fatalf("Expected a sealed value, got %s", sealed)
+	}
+
+	again, _ := k.Seal("ya29.access-token")
+	if again == sealed {
+		t.Error("Expected sealing twice to give different values")
+	}
+
+	opened, err := k.Open(sealed)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if opened != "ya29.access-token" {
+		t.Errorf("Expected the plaintext back, got %s", opened)
+	}
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	k, _ := ParseKeys("one:"+testKey(1), "")
+
+	opened, err := k.Open("legacy-token")
+	if err != nil || opened != "legacy-token" {
+		t.Errorf("Expected plaintext to be returned as is, got %q, %v", opened, err)
+	}
+	if !k.NeedsRotation("legacy-token") {
+		t.Error("Expected plaintext to need rotation")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, _ := ParseKeys("old:"+testKey(1), "")
+	sealed, _ := old.Seal("secret")
+
+	k, err := ParseKeys("old:"+testKey(1)+", new:"+testKey(2), "new")
+	if err != nil {
+		t.Fatalf("Failed to parse keys: %v", err)
+	}
+	if !k.NeedsRotation(sealed) {
+		t.Error("Expected a value sealed with an old key to need rotation")
+	}
+	opened, err := k.Open(sealed)
+	if err != nil || opened != "secret" {
+		t.Fatalf("Expected an old key to still open, got %q, %v", opened, err)
+	}
+
+	resealed, _ := k.Seal(opened)
+	if k.NeedsRotation(resealed) {
+		t.Error("Expected a value sealed with the active key not to need rotation")
+	}
+
+	newOnly, _ := ParseKeys("new:"+testKey(2), "")
+	if _, err := newOnly.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey once the old key is gone, got %v", err)
+	}
+}
+
+func TestTampering(t *testing.T) {
+	k, _ := ParseKeys("one:"+testKey(1)+",two:"+testKey(2), "one")
+	sealed, _ := k.Seal("secret")
+
+	// Pointing the value at another key must fail, even though both keys are in the ring.
+	relabelled := strings.Replace(sealed, prefix+"one:", prefix+"two:", 1)
+	if _, err := k.Open(relabelled); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected a relabelled value to fail, got %v", err)
+	}
+
+	flipped := []byte(sealed)
+	flipped[len(flipped)-2] ^= 1
+	if _, err := k.Open(string(flipped)); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected a modified value to fail, got %v", err)
+	}
+}
+
+func TestParseKeysErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   string
+		active string
+	}{
+		{"missing id", testKey(1), ""},
+		{"short key", "one:" + base64.StdEncoding.EncodeToString([]byte("short")), ""},
+		{"bad base64", "one:not base64!", ""},
+		{"duplicate id", "one:" + testKey(1) + ",one:" + testKey(2), ""},
+		{"unknown active", "one:" + testKey(1), "two"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseKeys(tt.spec, tt.active); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
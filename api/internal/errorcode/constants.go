@@ -33,6 +33,18 @@ var (
 	ErrExchangeToken       = &AppError{Code: 107, Message: "Error exchanging token", Readable: "Authentication failed"}
 	ErrRefreshToken        = &AppError{Code: 108, Message: "Error refreshing token", Readable: "Authentication failed"}
 	ErrFetchingOauthUser   = &AppError{Code: 109, Message: "Error fetching oauth user", Readable: "Authentication failed"}
+	ErrInsufficientScope   = &AppError{Code: 110, Message: "Token does not have the required scope", Readable: "Not allowed"}
+	ErrSessionRequired     = &AppError{Code: 111, Message: "This action requires a session login", Readable: "Not allowed"}
+	ErrOIDCDiscovery       = &AppError{Code: 112, Message: "Error loading OpenID provider configuration", Readable: "Authentication failed"}
+	ErrInvalidIDToken      = &AppError{Code: 113, Message: "Invalid ID token", Readable: "Authentication failed"}
+	ErrInvalidLoginToken   = &AppError{Code: 114, Message: "Invalid or expired login link", Readable: "Authentication failed"}
+	ErrMFARequired         = &AppError{Code: 115, Message: "Two-factor authentication required", Readable: "Not allowed"}
+	ErrInvalidMFACode      = &AppError{Code: 116, Message: "Invalid two-factor code", Readable: "Authentication failed"}
+	ErrReauthRequired      = &AppError{Code: 117, Message: "This action requires a recent sign in", Readable: "Not allowed"}
+	ErrAdminRequired       = &AppError{Code: 118, Message: "This action requires an admin", Readable: "Not allowed"}
+	ErrUserDisabled        = &AppError{Code: 119, Message: "User is disabled", Readable: "Not allowed"}
+	ErrIdentityMismatch    = &AppError{Code: 120, Message: "Account is linked to a different identity at this provider", Readable: "Authentication failed"}
+	ErrMFALocked           = &AppError{Code: 121, Message: "Too many wrong two-factor codes, try again later", Readable: "Authentication failed"}
 )
 
 // 🔹 Database Errors (2xx)
@@ -45,6 +57,7 @@ var (
 	ErrDBCreate          = &AppError{Code: 206, Message: "Error creating data", Readable: "Database operation failed"}
 	ErrDBUpdate          = &AppError{Code: 207, Message: "Error updating data", Readable: "Database operation failed"}
 	ErrDBDelete          = &AppError{Code: 208, Message: "Error deleting data", Readable: "Database operation failed"}
+	ErrTokenEncryption   = &AppError{Code: 209, Message: "Error encrypting or decrypting stored tokens", Readable: "Database operation failed"}
 )
 
 // Functionality Errors (3xx)
@@ -53,13 +66,36 @@ var (
 	ErrPhraseTagCreation = &AppError{Code: 302, Message: "Phrase tag creation failed", Readable: "Operation failed"}
 	ErrManualSyncLimit   = &AppError{Code: 303, Message: "Manual sync limit reached", Readable: "Limit reached"}
 	ErrGuestIDCreation   = &AppError{Code: 304, Message: "Error creating guest ID", Readable: "Operation failed"}
+	ErrPhraseNotFound    = &AppError{Code: 305, Message: "Phrase not found", Readable: "Not found"}
+	ErrReviewRecord      = &AppError{Code: 306, Message: "Recording review failed", Readable: "Operation failed"}
+	ErrImport            = &AppError{Code: 307, Message: "Importing phrases failed", Readable: "Operation failed"}
+	ErrTokenNotFound     = &AppError{Code: 308, Message: "Token not found", Readable: "Not found"}
+	ErrSessionNotFound   = &AppError{Code: 309, Message: "Session not found", Readable: "Not found"}
+	ErrGuestUpgrade      = &AppError{Code: 310, Message: "Upgrading guest account failed", Readable: "Operation failed"}
+	ErrProviderNotFound  = &AppError{Code: 311, Message: "Provider not found", Readable: "Not found"}
+	ErrLastProvider      = &AppError{Code: 312, Message: "Cannot unlink the last sign in method", Readable: "Operation failed"}
+	ErrProviderLinked    = &AppError{Code: 313, Message: "Provider is already linked to an account", Readable: "Operation failed"}
+	ErrSendingEmail      = &AppError{Code: 314, Message: "Sending email failed", Readable: "Operation failed"}
+	ErrMFAEnabled        = &AppError{Code: 315, Message: "Two-factor authentication is already enabled", Readable: "Operation failed"}
+	ErrMFANotEnabled     = &AppError{Code: 316, Message: "Two-factor authentication is not enabled", Readable: "Operation failed"}
+	ErrUserNotFound      = &AppError{Code: 317, Message: "User not found", Readable: "Not found"}
 )
 
 // User Errors (4xx)
 var (
-	ErrBadRequest       = &AppError{Code: 400, Message: "Bad request", Readable: "Invalid input"}
-	ErrNoPaginationData = &AppError{Code: 401, Message: "No pagination data given", Readable: "Invalid input"}
-	ErrNoSearchingData  = &AppError{Code: 402, Message: "No searching data given", Readable: "Invalid input"}
+	ErrBadRequest        = &AppError{Code: 400, Message: "Bad request", Readable: "Invalid input"}
+	ErrNoPaginationData  = &AppError{Code: 401, Message: "No pagination data given", Readable: "Invalid input"}
+	ErrNoSearchingData   = &AppError{Code: 402, Message: "No searching data given", Readable: "Invalid input"}
+	ErrInvalidQuality    = &AppError{Code: 403, Message: "Review quality must be between 0 and 5", Readable: "Invalid input"}
+	ErrInvalidCursor     = &AppError{Code: 404, Message: "Invalid cursor", Readable: "Invalid input"}
+	ErrInvalidPolicy     = &AppError{Code: 405, Message: "Invalid conflict policy", Readable: "Invalid input"}
+	ErrTooManyMutations  = &AppError{Code: 406, Message: "Too many mutations in batch", Readable: "Invalid input"}
+	ErrPageOutOfRange    = &AppError{Code: 407, Message: "Page number is greater than total pages", Readable: "Invalid input"}
+	ErrUnsupportedFormat = &AppError{Code: 408, Message: "Unsupported format", Readable: "Invalid input"}
+	ErrInvalidImportFile = &AppError{Code: 409, Message: "Import file could not be read", Readable: "Invalid input"}
+	ErrInvalidScope      = &AppError{Code: 410, Message: "Invalid token scope", Readable: "Invalid input"}
+	ErrInvalidEmail      = &AppError{Code: 411, Message: "Invalid email address", Readable: "Invalid input"}
+	ErrTooManyEmails     = &AppError{Code: 412, Message: "Too many login emails requested", Readable: "Limit reached"}
 )
 
 // Other Errors (5xx)
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatAnki = "anki"
+)
+
+var ValidFormats = []string{FormatCSV, FormatJSON, FormatAnki}
+
+// Writer streams tagged phrases to an underlying writer in a single export format.
+type Writer interface {
+	Write(phrase models.TaggedPhrase) error
+	// Close writes any trailing data. It does not close the underlying writer.
+	Close() error
+}
+
+// ContentType returns the MIME type of an export in the given format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatAnki:
+		return "text/tab-separated-values; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Extension returns the file extension of an export in the given format.
+func Extension(format string) string {
+	if format == FormatAnki {
+		return "txt"
+	}
+	return format
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatAnki:
+		return newAnkiWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+var csvHeader = []string{"id", "phrase", "phrase_definition", "found_in", "tags", "pinned", "public", "usage_count", "created_at", "updated_at"}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	if err := c.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(phrase models.TaggedPhrase) error {
+	tagNames := make([]string, 0, len(phrase.Tag))
+	for _, tag := range phrase.Tag {
+		tagNames = append(tagNames, tag.TagName)
+	}
+
+	p := phrase.Phrase
+	err := c.w.Write([]string{
+		p.ID,
+		p.Phrase,
+		p.PhraseDefinition,
+		p.FoundIn,
+		strings.Join(tagNames, ";"),
+		strconv.FormatBool(p.Pinned),
+		strconv.FormatBool(p.Public),
+		strconv.Itoa(p.UsageCount),
+		p.CreatedAt.UTC().Format(time.RFC3339),
+		p.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonWriter writes a JSON array one element at a time so the whole library never has to be held in memory.
+type jsonWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (j *jsonWriter) Write(phrase models.TaggedPhrase) error {
+	prefix := ","
+	if !j.written {
+		prefix = "["
+		j.written = true
+	}
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(phrase)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(raw)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.written {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
+
+// ankiWriter writes a tab separated Anki text import file with front, back and tags columns.
+type ankiWriter struct {
+	w io.Writer
+}
+
+func newAnkiWriter(w io.Writer) (*ankiWriter, error) {
+	_, err := io.WriteString(w, "#separator:tab\n#html:false\n#columns:Front\tBack\tTags\n#tags column:3\n")
+	if err != nil {
+		return nil, err
+	}
+	return &ankiWriter{w: w}, nil
+}
+
+func (a *ankiWriter) Write(phrase models.TaggedPhrase) error {
+	p := phrase.Phrase
+	back := p.PhraseDefinition
+	if p.FoundIn != "" {
+		back = fmt.Sprintf("%s (Found in: %s)", back, p.FoundIn)
+	}
+
+	tags := make([]string, 0, len(phrase.Tag)+1)
+	for _, tag := range phrase.Tag {
+		if name := ankiTag(tag.TagName); name != "" {
+			tags = append(tags, name)
+		}
+	}
+	if p.Pinned {
+		tags = append(tags, "pinned")
+	}
+
+	_, err := fmt.Fprintf(a.w, "%s\t%s\t%s\n", ankiField(p.Phrase), ankiField(back), strings.Join(tags, " "))
+	return err
+}
+
+func (a *ankiWriter) Close() error { return nil }
+
+// ankiField flattens a value onto a single line so it cannot break the tab separated layout.
+func ankiField(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ankiTag converts a tag name to an Anki tag, which cannot contain spaces.
+func ankiTag(s string) string {
+	return strings.Join(strings.Fields(s), "_")
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+func samplePhrases() []models.TaggedPhrase {
+	return []models.TaggedPhrase{
+		{
+			Phrase: models.Phrase{ID: "1", Phrase: "serendipity", PhraseDefinition: "a happy\taccident", FoundIn: "Some Book", Pinned: true, UsageCount: 2},
+			Tag:    []models.PhraseTag{{TagName: "nice words"}, {TagName: "noun"}},
+		},
+		{
+			Phrase: models.Phrase{ID: "2", Phrase: "ephemeral", PhraseDefinition: "short lived"},
+			Tag:    []models.PhraseTag{},
+		},
+	}
+}
+
+func writeAll(t *testing.T, format string, phrases []models.TaggedPhrase) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatalf("Failed to create %s writer: %v", format, err)
+	}
+	for _, phrase := range phrases {
+		if err := w.Write(phrase); err != nil {
+			t.Fatalf("Failed to write phrase: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	return buf.String()
+}
+
+func TestWriters(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		var decoded []models.TaggedPhrase
+		if err := json.Unmarshal([]byte(writeAll(t, FormatJSON, samplePhrases())), &decoded); err != nil {
+			t.Fatalf("Export is not valid JSON: %v", err)
+		}
+		if len(decoded) != 2 || len(decoded[0].Tag) != 2 {
+			t.Errorf("Expected 2 phrases with 2 tags on the first, got %+v", decoded)
+		}
+		if err := json.Unmarshal([]byte(writeAll(t, FormatJSON, nil)), &decoded); err != nil || len(decoded) != 0 {
+			t.Errorf("Expected an empty JSON array, got %v %v", decoded, err)
+		}
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(writeAll(t, FormatCSV, samplePhrases())), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("Expected header and 2 rows, got %d lines", len(lines))
+		}
+		if !strings.Contains(lines[1], "nice words;noun") {
+			t.Errorf("Expected joined tags in row, got %q", lines[1])
+		}
+	})
+
+	t.Run("Anki", func(t *testing.T) {
+		out := writeAll(t, FormatAnki, samplePhrases())
+		expected := "serendipity\ta happy accident (Found in: Some Book)\tnice_words noun pinned\n"
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected anki row %q, got %q", expected, out)
+		}
+		if !strings.HasPrefix(out, "#separator:tab\n") {
+			t.Errorf("Expected anki header, got %q", out)
+		}
+	})
+
+	t.Run("Unknown Format", func(t *testing.T) {
+		if _, err := NewWriter("xml", &bytes.Buffer{}); err == nil {
+			t.Error("Expected error for unknown format")
+		}
+	})
+}
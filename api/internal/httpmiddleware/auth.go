@@ -3,36 +3,202 @@ package httpmiddleware
 import (
 	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/arinji2/vocab-thing/internal/auth"
 	"github.com/arinji2/vocab-thing/internal/database"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
 )
 
-func Authentication(db *sql.DB) func(http.Handler) http.Handler {
+// Authentication accepts either a personal access token in an "Authorization: Bearer"
+// header or the session cookie. Token requests get a session carrying the token's user.
+// Session requests slide the session's expiry forward and rotate its token when it is due,
+// setting the cookie again when they do.
+func Authentication(db *sql.DB, cookie auth.SessionCookie) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			sessionID, err := auth.GetUserSession(r)
+			ctx := r.Context()
+
+			if bearer, ok := auth.BearerToken(r); ok {
+				tokenModel := database.TokenModel{DB: db}
+				token, err := tokenModel.Validate(ctx, auth.HashAPIToken(bearer))
+				if err != nil {
+					errorcode.WriteJSONError(w, err, http.StatusUnauthorized)
+					return
+				}
+
+				session := models.Session{UserID: token.UserID}
+				if token.ExpiresAt != nil {
+					session.ExpiresAt = *token.ExpiresAt
+				}
+				ctx = auth.ContextWithSession(ctx, session)
+				ctx = auth.ContextWithAPIToken(ctx, token)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			sessionToken, err := auth.GetUserSession(r)
 			if err != nil {
 				errorcode.WriteJSONError(w, err, http.StatusUnauthorized)
 				return
 			}
 
-			ctx := r.Context()
 			sessionModel := database.SessionModel{DB: db}
-			sessionData, err := sessionModel.Validate(ctx, sessionID)
+			sessionData, err := sessionModel.Validate(ctx, sessionToken)
 			if err != nil {
 				if err == auth.ErrSessionExpired {
-					auth.DeleteUserSessionCookie(w)
+					cookie.Delete(w)
 				}
 				fmt.Println(err.Error())
 				errorcode.WriteJSONError(w, err, http.StatusUnauthorized)
 				return
 			}
 
+			if sessionData.MFAPending {
+				errorcode.WriteJSONError(w, errorcode.ErrMFARequired, http.StatusUnauthorized)
+				return
+			}
+
+			// Using the session keeps it alive. A failed refresh only costs the extension, so the request goes on.
+			refreshed, err := sessionModel.Refresh(ctx, &sessionData)
+			if err != nil {
+				log.Printf("error refreshing session %s: %s", sessionData.ID, err.Error())
+			} else if refreshed {
+				cookie.Set(w, sessionData.Token, sessionData.ExpiresAt)
+			}
+
 			ctx = auth.ContextWithSession(ctx, sessionData)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireScope rejects token requests whose token lacks the scope. Session requests have every scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := auth.APITokenFromContext(r.Context()); ok && !slices.Contains(token.Scopes, scope) {
+				errorcode.WriteJSONError(w, errorcode.ErrInsufficientScope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireReadWriteScope requires the read scope for safe methods and the write scope for everything else.
+func RequireReadWriteScope(next http.Handler) http.Handler {
+	read, write := RequireScope(auth.ScopeRead)(next), RequireScope(auth.ScopeWrite)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			read.ServeHTTP(w, r)
+		default:
+			write.ServeHTTP(w, r)
+		}
+	})
+}
+
+// RequireSession rejects requests authenticated with a personal access token, for actions
+// such as managing tokens that should need a real login.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.APITokenFromContext(r.Context()); ok {
+			errorcode.WriteJSONError(w, errorcode.ErrSessionRequired, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireMFA guards sensitive routes for users who enabled two-factor authentication: their session must have
+// passed it. Access tokens are refused for these users, as a token carries no proof of the second factor.
+func RequireMFA(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			session, ok := auth.SessionFromContext(ctx)
+			if !ok {
+				errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusUnauthorized)
+				return
+			}
+			_, isToken := auth.APITokenFromContext(ctx)
+			if !isToken && session.MFAVerifiedAt != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mfaModel := database.MFAModel{DB: db}
+			enabled, err := mfaModel.Enabled(ctx, session.UserID)
+			if err != nil {
+				errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if enabled {
+				errorcode.WriteJSONError(w, errorcode.ErrMFARequired, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdmin only lets admins through. The role is read on every request, so a demotion takes effect at once.
+func RequireAdmin(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			session, ok := auth.SessionFromContext(ctx)
+			if !ok {
+				errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusUnauthorized)
+				return
+			}
+
+			userModel := database.UserModel{DB: db}
+			user, err := userModel.ByID(ctx, session.UserID)
+			if err != nil {
+				errorcode.WriteJSONError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if user.Role != auth.RoleAdmin {
+				errorcode.WriteJSONError(w, errorcode.ErrAdminRequired, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// recentAuthWindow is how long after signing in, or passing two-factor authentication, a session counts as recently authenticated.
+const recentAuthWindow = 10 * time.Minute
+
+// RequireRecentAuth guards destructive actions, such as deleting the account, from a stolen long-lived cookie: the
+// session must have signed in within recentAuthWindow. Guest sessions cannot sign in again and are let through.
+// It expects RequireSession to have run first.
+func RequireRecentAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := auth.SessionFromContext(r.Context())
+		if !ok {
+			errorcode.WriteJSONError(w, errorcode.ErrNoSession, http.StatusUnauthorized)
+			return
+		}
+		if session.ProviderType != nil && *session.ProviderType == "guest" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticatedAt := session.CreatedAt
+		if session.MFAVerifiedAt != nil && session.MFAVerifiedAt.After(authenticatedAt) {
+			authenticatedAt = *session.MFAVerifiedAt
+		}
+		if time.Since(authenticatedAt) > recentAuthWindow {
+			errorcode.WriteJSONError(w, errorcode.ErrReauthRequired, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
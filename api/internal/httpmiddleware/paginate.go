@@ -12,6 +12,7 @@ type paginationCtxKey struct{}
 type Pagination struct {
 	Page     int
 	PageSize int
+	Cursor   string
 	Sorting  Sorting
 }
 
@@ -42,6 +43,7 @@ func Paginate(next http.Handler) http.Handler {
 		ctx := context.WithValue(r.Context(), paginationCtxKey{}, Pagination{
 			Page:     page,
 			PageSize: pageSize,
+			Cursor:   query.Get("cursor"),
 			Sorting: Sorting{
 				SortBy:  sortBy,
 				Order:   order,
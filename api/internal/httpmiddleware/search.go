@@ -3,6 +3,7 @@ package httpmiddleware
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 )
@@ -10,7 +11,8 @@ import (
 type searchCtxKey struct{}
 
 type Search struct {
-	Term string
+	Term  string
+	Limit int
 }
 
 func Searching(next http.Handler) http.Handler {
@@ -24,8 +26,14 @@ func Searching(next http.Handler) http.Handler {
 			return
 		}
 
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+
 		ctx := context.WithValue(r.Context(), searchCtxKey{}, Search{
-			Term: searchTerm,
+			Term:  searchTerm,
+			Limit: limit,
 		})
 
 		next.ServeHTTP(w, r.WithContext(ctx))
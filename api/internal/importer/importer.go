@@ -0,0 +1,400 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatAnki   = "anki"
+	FormatKindle = "kindle"
+)
+
+var ValidFormats = []string{FormatCSV, FormatAnki, FormatKindle}
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Detect guesses the format of an upload from its name and first bytes.
+func Detect(filename string, head []byte) string {
+	if bytes.HasPrefix(head, sqliteHeader) {
+		return FormatKindle
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".db", ".sqlite":
+		return FormatKindle
+	case ".txt", ".tsv":
+		return FormatAnki
+	}
+
+	if bytes.HasPrefix(head, []byte("#")) {
+		return FormatAnki
+	}
+	firstLine, _, _ := bytes.Cut(head, []byte("\n"))
+	if bytes.Contains(firstLine, []byte("\t")) && !bytes.Contains(firstLine, []byte(",")) {
+		return FormatAnki
+	}
+	return FormatCSV
+}
+
+// ReadFile reads every record of the file at path in the given format.
+func ReadFile(ctx context.Context, format, path string) ([]models.ImportRecord, error) {
+	if format == FormatKindle {
+		return ReadKindle(ctx, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case FormatCSV:
+		return ReadCSV(f)
+	case FormatAnki:
+		return ReadAnki(f)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+// Header names accepted for each field, matched case-insensitively. The first names
+// are the ones written by the CSV export so exports can be imported back.
+var (
+	phraseColumns     = []string{"phrase", "word", "term", "front", "expression"}
+	definitionColumns = []string{"phrase_definition", "definition", "meaning", "back"}
+	foundInColumns    = []string{"found_in", "source", "book"}
+	usageColumns      = []string{"usage", "example", "context", "sentence"}
+	tagsColumns       = []string{"tags", "tag"}
+	pinnedColumns     = []string{"pinned"}
+	publicColumns     = []string{"public"}
+	createdAtColumns  = []string{"created_at"}
+)
+
+// columns maps record fields to their index in a row, -1 when absent.
+type columns struct {
+	phrase, definition, foundIn, usage, tags, pinned, public, createdAt int
+}
+
+// positionalColumns is used for files without a recognised header: phrase, definition and tags.
+var positionalColumns = columns{phrase: 0, definition: 1, foundIn: -1, usage: -1, tags: 2, pinned: -1, public: -1, createdAt: -1}
+
+func headerColumns(header []string) (columns, bool) {
+	find := func(names []string) int {
+		for i, h := range header {
+			h = strings.ToLower(strings.TrimSpace(h))
+			for _, name := range names {
+				if h == name {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	c := columns{
+		phrase:     find(phraseColumns),
+		definition: find(definitionColumns),
+		foundIn:    find(foundInColumns),
+		usage:      find(usageColumns),
+		tags:       find(tagsColumns),
+		pinned:     find(pinnedColumns),
+		public:     find(publicColumns),
+		createdAt:  find(createdAtColumns),
+	}
+	return c, c.phrase >= 0
+}
+
+// ReadCSV reads a comma separated file. A header row naming a phrase column is used to
+// map the other columns; without one the columns are taken as phrase, definition and tags.
+func ReadCSV(r io.Reader) ([]models.ImportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []models.ImportRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	cols, ok := headerColumns(header)
+	records := []models.ImportRecord{}
+	if !ok {
+		cols = positionalColumns
+		records = append(records, csvRecord(1, header, cols))
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				records = append(records, models.ImportRecord{Row: parseErr.StartLine, Err: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("reading csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, csvRecord(line, row, cols))
+	}
+
+	return records, nil
+}
+
+func csvRecord(line int, row []string, cols columns) models.ImportRecord {
+	field := func(i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	rec := models.ImportRecord{
+		Row: line,
+		Phrase: models.Phrase{
+			Phrase:           field(cols.phrase),
+			PhraseDefinition: withUsage(field(cols.definition), field(cols.usage)),
+			FoundIn:          field(cols.foundIn),
+		},
+		Tags: splitTags(field(cols.tags), ";,"),
+	}
+
+	var err error
+	if rec.Phrase.Pinned, err = parseBool(field(cols.pinned)); err != nil {
+		rec.Err = "invalid pinned value"
+	}
+	if rec.Phrase.Public, err = parseBool(field(cols.public)); err != nil {
+		rec.Err = "invalid public value"
+	}
+	if v := field(cols.createdAt); v != "" {
+		if rec.Phrase.CreatedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			rec.Err = "invalid created_at value"
+		}
+	}
+
+	return validate(rec)
+}
+
+// ankiSeparators are the names Anki writes in the #separator header.
+var ankiSeparators = map[string]rune{
+	"tab":       '\t',
+	"comma":     ',',
+	"semicolon": ';',
+	"space":     ' ',
+	"pipe":      '|',
+	"colon":     ':',
+}
+
+// ankiFoundIn matches the suffix the Anki export appends to the back of a card.
+var ankiFoundIn = regexp.MustCompile(`\s*\(Found in: (.*)\)$`)
+
+// ReadAnki reads an Anki "Notes in Plain Text" export. The file headers select the
+// separator and the tags, deck, notetype and guid columns; of the remaining fields the
+// first is the phrase and the second its definition. Decks become the found in value.
+func ReadAnki(r io.Reader) ([]models.ImportRecord, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading anki file: %w", err)
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+
+	separator := '\t'
+	useHTML := false
+	tagsCol, deckCol, skipCols := -1, -1, map[int]bool{}
+	var cols *columns
+
+	headerLines := 0
+	for bytes.HasPrefix(raw, []byte("#")) {
+		line, rest, _ := bytes.Cut(raw, []byte("\n"))
+		raw = rest
+		headerLines++
+
+		key, value, ok := strings.Cut(strings.TrimSpace(string(line[1:])), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "separator":
+			if sep, ok := ankiSeparators[strings.ToLower(value)]; ok {
+				separator = sep
+			} else if len([]rune(value)) == 1 {
+				separator = []rune(value)[0]
+			}
+		case "html":
+			useHTML = value == "true"
+		case "columns":
+			// Column names are only known once the separator is, which Anki always writes first.
+			if c, ok := headerColumns(strings.Split(value, string(separator))); ok {
+				cols = &c
+			}
+		case "tags column":
+			tagsCol = ankiColumn(value)
+		case "deck column":
+			deckCol = ankiColumn(value)
+		case "notetype column", "guid column":
+			skipCols[ankiColumn(value)] = true
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(raw))
+	reader.Comma = separator
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records := []models.ImportRecord{}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				records = append(records, models.ImportRecord{Row: headerLines + parseErr.StartLine, Err: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("reading anki file: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if useHTML {
+			for i := range row {
+				row[i] = stripHTML(row[i])
+			}
+		}
+
+		rowCols := positionalColumns
+		if cols != nil {
+			rowCols = *cols
+		} else {
+			// Without named columns the note fields are whatever is not a tag, deck or metadata column.
+			fields := []int{}
+			for i := range row {
+				if i != tagsCol && i != deckCol && !skipCols[i] {
+					fields = append(fields, i)
+				}
+			}
+			rowCols.phrase, rowCols.definition, rowCols.tags = -1, -1, tagsCol
+			if len(fields) > 0 {
+				rowCols.phrase = fields[0]
+			}
+			if len(fields) > 1 {
+				rowCols.definition = fields[1]
+			}
+			if tagsCol < 0 && len(fields) > 2 {
+				rowCols.tags = fields[2]
+			}
+		}
+
+		rec := csvRecord(headerLines+line, row, rowCols)
+		if rowCols.tags >= 0 && rowCols.tags < len(row) {
+			rec.Tags = ankiTags(row[rowCols.tags], &rec.Phrase)
+		}
+		if m := ankiFoundIn.FindStringSubmatch(rec.Phrase.PhraseDefinition); m != nil && rec.Phrase.FoundIn == "" {
+			rec.Phrase.FoundIn = m[1]
+			rec.Phrase.PhraseDefinition = strings.TrimSuffix(rec.Phrase.PhraseDefinition, m[0])
+		}
+		if rec.Phrase.FoundIn == "" && deckCol >= 0 && deckCol < len(row) {
+			rec.Phrase.FoundIn = strings.TrimSpace(row[deckCol])
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// ankiColumn converts a 1-based Anki column header to an index.
+func ankiColumn(value string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		return -1
+	}
+	return n - 1
+}
+
+// ankiTags splits space separated Anki tags, undoing the underscores the export puts in
+// place of spaces. The "pinned" tag pins the phrase instead of being imported.
+func ankiTags(s string, phrase *models.Phrase) []string {
+	tags := []string{}
+	for _, tag := range strings.Fields(s) {
+		if strings.EqualFold(tag, "pinned") {
+			phrase.Pinned = true
+			continue
+		}
+		tags = append(tags, strings.ReplaceAll(tag, "_", " "))
+	}
+	return tags
+}
+
+var (
+	htmlBreak = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+func stripHTML(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+func splitTags(s string, separators string) []string {
+	tags := []string{}
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune(separators, r) }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func parseBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// withUsage appends usage sentences to a definition, one per line.
+func withUsage(definition string, usages ...string) string {
+	lines := []string{}
+	if definition != "" {
+		lines = append(lines, definition)
+	}
+	for _, usage := range usages {
+		if usage = strings.TrimSpace(usage); usage != "" {
+			lines = append(lines, usage)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func validate(rec models.ImportRecord) models.ImportRecord {
+	if rec.Err == "" && rec.Phrase.Phrase == "" {
+		rec.Err = "missing phrase"
+	}
+	return rec
+}
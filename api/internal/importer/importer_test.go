@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		head     string
+		expected string
+	}{
+		{"SQLite Header", "upload", "SQLite format 3\x00rest", FormatKindle},
+		{"Kindle Extension", "vocab.db", "", FormatKindle},
+		{"Anki Headers", "deck", "#separator:tab\nfront\tback", FormatAnki},
+		{"Tab Separated", "deck", "front\tback\n", FormatAnki},
+		{"CSV", "words.csv", "phrase,definition\n", FormatCSV},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.filename, []byte(tt.head)); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	t.Run("Header Mapping", func(t *testing.T) {
+		input := "Word,Meaning,Source,Tags,Usage,Pinned\n" +
+			"serendipity,a happy accident,Some Book,noun;nice,\"It was pure serendipity.\",true\n" +
+			",no phrase,,,,\n" +
+			"ephemeral,short lived,,,,maybe\n"
+		records, err := ReadCSV(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Failed to read csv: %v", err)
+		}
+		if len(records) != 3 {
+			t.Fatalf("Expected 3 records, got %d", len(records))
+		}
+
+		first := records[0]
+		if first.Row != 2 || first.Err != "" {
+			t.Errorf("Expected clean record on row 2, got row %d with error %q", first.Row, first.Err)
+		}
+		if first.Phrase.PhraseDefinition != "a happy accident\nIt was pure serendipity." {
+			t.Errorf("Expected usage to follow definition, got %q", first.Phrase.PhraseDefinition)
+		}
+		if first.Phrase.FoundIn != "Some Book" || !first.Phrase.Pinned || len(first.Tags) != 2 {
+			t.Errorf("Unexpected mapping: %+v", first)
+		}
+		if records[1].Err != "missing phrase" {
+			t.Errorf("Expected missing phrase error, got %q", records[1].Err)
+		}
+		if records[2].Err != "invalid pinned value" {
+			t.Errorf("Expected invalid pinned error, got %q", records[2].Err)
+		}
+	})
+
+	t.Run("Positional Without Header", func(t *testing.T) {
+		records, err := ReadCSV(strings.NewReader("serendipity,a happy accident,noun\n"))
+		if err != nil {
+			t.Fatalf("Failed to read csv: %v", err)
+		}
+		if len(records) != 1 || records[0].Phrase.Phrase != "serendipity" || records[0].Tags[0] != "noun" {
+			t.Errorf("Unexpected records: %+v", records)
+		}
+	})
+}
+
+func TestReadAnki(t *testing.T) {
+	t.Run("Export Round Trip", func(t *testing.T) {
+		input := "#separator:tab\n#html:false\n#columns:Front\tBack\tTags\n#tags column:3\n" +
+			"serendipity\ta happy accident (Found in: Some Book)\tnice_words pinned\n"
+		records, err := ReadAnki(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Failed to read anki file: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record, got %d", len(records))
+		}
+
+		rec := records[0]
+		if rec.Row != 5 {
+			t.Errorf("Expected row 5, got %d", rec.Row)
+		}
+		if rec.Phrase.PhraseDefinition != "a happy accident" || rec.Phrase.FoundIn != "Some Book" {
+			t.Errorf("Expected found in to be split from the back, got %q and %q", rec.Phrase.PhraseDefinition, rec.Phrase.FoundIn)
+		}
+		if !rec.Phrase.Pinned || len(rec.Tags) != 1 || rec.Tags[0] != "nice words" {
+			t.Errorf("Unexpected tags: pinned %v, %v", rec.Phrase.Pinned, rec.Tags)
+		}
+	})
+
+	t.Run("Deck And HTML", func(t *testing.T) {
+		input := "#separator:semicolon\n#html:true\n#guid column:1\n#deck column:2\n#tags column:5\n" +
+			"abc;Spanish;<b>hola</b>;hello<br>hi;greeting\n"
+		records, err := ReadAnki(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Failed to read anki file: %v", err)
+		}
+
+		rec := records[0]
+		if rec.Phrase.Phrase != "hola" || rec.Phrase.PhraseDefinition != "hello\nhi" {
+			t.Errorf("Expected html to be stripped, got %q and %q", rec.Phrase.Phrase, rec.Phrase.PhraseDefinition)
+		}
+		if rec.Phrase.FoundIn != "Spanish" || len(rec.Tags) != 1 || rec.Tags[0] != "greeting" {
+			t.Errorf("Unexpected deck or tags: %q, %v", rec.Phrase.FoundIn, rec.Tags)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ReadKindle reads the words of a Kindle Vocabulary Builder database (vocab.db). Each
+// looked up word becomes one record; the titles of the books it was looked up in go into
+// found in and the sentences it was used in become the definition, as Kindle stores none.
+func ReadKindle(ctx context.Context, path string) ([]models.ImportRecord, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&immutable=1", path))
+	if err != nil {
+		return nil, fmt.Errorf("opening kindle database: %w", err)
+	}
+	defer db.Close()
+
+	query := `
+		SELECT w.id, w.word, w.timestamp, COALESCE(l.usage, ''), COALESCE(b.title, '')
+		FROM WORDS w
+		LEFT JOIN LOOKUPS l ON l.word_key = w.id
+		LEFT JOIN BOOK_INFO b ON b.id = l.book_key
+		ORDER BY w.timestamp, w.id, l.timestamp
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("querying kindle words: %w", err)
+	}
+	defer rows.Close()
+
+	records := []models.ImportRecord{}
+	var current *models.ImportRecord
+	var wordID string
+	var usages, titles []string
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Phrase.PhraseDefinition = withUsage("", usages...)
+		current.Phrase.FoundIn = strings.Join(titles, "; ")
+		records = append(records, validate(*current))
+	}
+
+	for rows.Next() {
+		var id, word, usage, title string
+		var timestamp int64
+		if err := rows.Scan(&id, &word, &timestamp, &usage, &title); err != nil {
+			return nil, fmt.Errorf("scanning kindle word: %w", err)
+		}
+
+		if current == nil || id != wordID {
+			flush()
+			wordID = id
+			usages, titles = nil, nil
+			current = &models.ImportRecord{
+				Row:    len(records) + 1,
+				Phrase: models.Phrase{Phrase: strings.TrimSpace(word)},
+				Tags:   []string{},
+			}
+			if timestamp > 0 {
+				current.Phrase.CreatedAt = time.UnixMilli(timestamp).UTC()
+			}
+		}
+
+		if usage = strings.TrimSpace(usage); usage != "" && !slices.Contains(usages, usage) {
+			usages = append(usages, usage)
+		}
+		if title = strings.TrimSpace(title); title != "" && !slices.Contains(titles, title) {
+			titles = append(titles, title)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating kindle words: %w", err)
+	}
+	flush()
+
+	return records, nil
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/database"
+)
+
+// Backup writes an integrity checked snapshot of the database into the backup directory every interval, then
+// deletes the snapshots the retention rules no longer keep.
+func Backup(db *sql.DB, c config.Backup) Job {
+	return Job{
+		Name:     "backup",
+		Interval: c.Interval,
+		Timeout:  30 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			now := time.Now()
+			path, err := database.Snapshot(ctx, db, c.Dir, now)
+			if err != nil {
+				return "", err
+			}
+			log.Printf("backed up the database to %s", path)
+
+			deleted, err := database.PruneSnapshots(c.Dir, c.Keep, c.MaxAge, now)
+			if err != nil {
+				return "", fmt.Errorf("pruning backups: %w", err)
+			}
+			if len(deleted) > 0 {
+				log.Printf("deleted %d old backups", len(deleted))
+			}
+			return fmt.Sprintf("wrote %s, deleted %d old backups", filepath.Base(path), len(deleted)), nil
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/utils/idgen"
+)
+
+// maxJitter caps the random delay added before each run, which keeps servers started together from running their
+// jobs in lockstep.
+const maxJitter = 5 * time.Minute
+
+// Job is recurring work run by the Scheduler.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Timeout bounds a run. The job stays locked for as long, so a run lost in a crash blocks it for no longer.
+	Timeout time.Duration
+	// Run does the work and returns a short summary, shown by the jobs status endpoint.
+	Run func(ctx context.Context) (string, error)
+}
+
+// Scheduler runs each job about once per interval. Servers sharing the database take turns through a lock in the
+// job_runs table, so a job never runs twice at once or more often than its interval.
+type Scheduler struct {
+	db    *sql.DB
+	owner string
+	jobs  []Job
+	wg    sync.WaitGroup
+}
+
+func NewScheduler(db *sql.DB) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		db:    db,
+		owner: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), idgen.GenerateRandomID(6, idgen.URLSafeAlphanumericCharset)),
+	}
+}
+
+func (s *Scheduler) Add(jobs ...Job) {
+	s.jobs = append(s.jobs, jobs...)
+}
+
+// Start runs every job in its own goroutine until ctx is cancelled. The first run of each comes after a short
+// random delay.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Wait returns once every job has stopped, after the context given to Start is cancelled. A run in progress sees
+// its context cancelled and is waited for.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(jitter(job.Interval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		s.run(ctx, job)
+		timer.Reset(job.Interval + jitter(job.Interval))
+	}
+}
+
+// run runs the job if it is due and no other server is running it.
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	jobModel := database.JobModel{DB: s.db}
+	now := time.Now()
+	locked, err := jobModel.Acquire(ctx, job.Name, s.owner, now, now.Add(job.Timeout))
+	if err != nil {
+		log.Printf("error locking job %s: %s", job.Name, err.Error())
+		return
+	}
+	if !locked {
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	result, runErr := job.Run(runCtx)
+	cancel()
+	if runErr != nil {
+		log.Printf("job %s failed: %s", job.Name, runErr.Error())
+	}
+
+	// The lock is released even while the server stops, so the next start does not wait for it to expire.
+	finishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	finished := time.Now()
+	if err := jobModel.Finish(finishCtx, job.Name, s.owner, finished, finished.Add(job.Interval), result, runErr); err != nil {
+		log.Printf("error finishing job %s: %s", job.Name, err.Error())
+	}
+}
+
+// jitter returns a random delay of up to a tenth of interval, and at most maxJitter.
+func jitter(interval time.Duration) time.Duration {
+	limit := min(interval/10, maxJitter)
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		limit    time.Duration
+	}{
+		{"Tenth Of Interval", 10 * time.Minute, time.Minute},
+		{"Capped", 24 * time.Hour, maxJitter},
+		{"Tiny Interval", time.Nanosecond, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := jitter(tt.interval)
+				if got < 0 || (got >= tt.limit && got != 0) {
+					t.Fatalf("Expected jitter below %s, got %s", tt.limit, got)
+				}
+			}
+		})
+	}
+}
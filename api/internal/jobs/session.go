@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/oauth"
+)
+
+// SessionCleanup deletes expired sessions and email login tokens every hour. Email login tokens are kept for the
+// rate limit window after they expire, as the limit counts them.
+func SessionCleanup(db *sql.DB) Job {
+	return Job{
+		Name:     "session-cleanup",
+		Interval: time.Hour,
+		Timeout:  5 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			sessionModel := database.SessionModel{DB: db}
+			emailTokenModel := database.EmailTokenModel{DB: db}
+
+			sessions, err := sessionModel.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				return "", fmt.Errorf("purging expired sessions: %w", err)
+			}
+			if sessions > 0 {
+				log.Printf("purged %d expired sessions", sessions)
+			}
+
+			tokens, err := emailTokenModel.DeleteExpired(ctx, time.Now().Add(-oauth.EmailLoginWindow))
+			if err != nil {
+				return "", fmt.Errorf("purging expired email login tokens: %w", err)
+			}
+			if tokens > 0 {
+				log.Printf("purged %d expired email login tokens", tokens)
+			}
+
+			return fmt.Sprintf("purged %d sessions and %d email login tokens", sessions, tokens), nil
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/oauth"
+)
+
+const (
+	tokenRefreshInterval = 15 * time.Minute
+	// tokenRefreshAhead is how long before it expires an access token is refreshed. It spans two runs, so a token
+	// is not missed when a run is late.
+	tokenRefreshAhead = 2 * tokenRefreshInterval
+	// tokenRefreshGiveUp is how long after it expired a token stops being retried, so a revoked refresh token is not
+	// sent to its provider on every run. Such a provider gets new tokens on its next sign in.
+	tokenRefreshGiveUp = 24 * time.Hour
+)
+
+// TokenRefresh refreshes stored OAuth access tokens shortly before they expire, keeping refresh tokens in use.
+func TokenRefresh(db *sql.DB, providers *oauth.Providers) Job {
+	return Job{
+		Name:     "token-refresh",
+		Interval: tokenRefreshInterval,
+		Timeout:  5 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			providerModel := database.ProviderModel{DB: db}
+			now := time.Now()
+			due, err := providerModel.ExpiringBetween(ctx, now.Add(-tokenRefreshGiveUp), now.Add(tokenRefreshAhead))
+			if err != nil {
+				return "", fmt.Errorf("listing expiring tokens: %w", err)
+			}
+
+			refreshed, failed := 0, 0
+			for _, p := range due {
+				if ctx.Err() != nil {
+					break
+				}
+				provider, err := providers.New(ctx, p.Type)
+				if errors.Is(err, errorcode.ErrUnsupportedProvider) {
+					continue
+				}
+				if err != nil {
+					log.Printf("error creating %s provider to refresh provider %s: %s", p.Type, p.ID, err.Error())
+					failed++
+					continue
+				}
+
+				// RefreshAccessToken only trades the refresh token in a token's last minutes, so the token is
+				// handed over as already expired.
+				accessToken := p.AccessToken
+				p.ExpiresAt = now.Add(-time.Minute)
+				if err := provider.RefreshAccessToken(&p); err != nil {
+					log.Printf("error refreshing the access token of %s provider %s: %s", p.Type, p.ID, err.Error())
+					failed++
+					continue
+				}
+				if p.AccessToken == accessToken {
+					continue
+				}
+				if err := providerModel.UpdateTokens(ctx, &p); err != nil {
+					log.Printf("error storing the refreshed tokens of %s provider %s: %s", p.Type, p.ID, err.Error())
+					failed++
+					continue
+				}
+				refreshed++
+			}
+
+			if refreshed > 0 || failed > 0 {
+				log.Printf("refreshed %d OAuth tokens, %d failed", refreshed, failed)
+			}
+			result := fmt.Sprintf("refreshed %d tokens, %d failed", refreshed, failed)
+			if failed > 0 && refreshed == 0 {
+				return result, fmt.Errorf("every one of %d token refreshes failed", failed)
+			}
+			return result, nil
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+)
+
+// TrashPurge permanently deletes phrases that have been in the trash for longer than retention, every hour.
+func TrashPurge(db *sql.DB, retention time.Duration) Job {
+	return Job{
+		Name:     "trash-purge",
+		Interval: time.Hour,
+		Timeout:  5 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			phraseModel := database.PhraseModel{DB: db}
+			purged, err := phraseModel.PurgeTrashedBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return "", fmt.Errorf("purging trashed phrases: %w", err)
+			}
+			if purged > 0 {
+				log.Printf("purged %d trashed phrases", purged)
+			}
+			return fmt.Sprintf("purged %d trashed phrases", purged), nil
+		},
+	}
+}
@@ -3,18 +3,37 @@ package models
 import "time"
 
 type User struct {
-	ID        string    `json:"id" sql:"id"`
-	Username  string    `json:"username" sql:"username"`
-	Email     string    `json:"email" sql:"email"`
-	CreatedAt time.Time `json:"created_at" sql:"createdAt"`
+	ID         string     `json:"id" sql:"id"`
+	Username   string     `json:"username" sql:"username"`
+	Email      string     `json:"email" sql:"email"`
+	Role       string     `json:"role" sql:"role"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty" sql:"disabledAt"`
+	CreatedAt  time.Time  `json:"created_at" sql:"createdAt"`
+}
+
+// UserDetail is a user as shown to admins, with a summary of what they own.
+type UserDetail struct {
+	User
+	ProviderTypes []string `json:"provider_types"`
+	SessionCount  int      `json:"session_count"`
+	PhraseCount   int      `json:"phrase_count"`
+}
+
+type UserPage struct {
+	Items      []User `json:"items"`
+	TotalCount int    `json:"total_count"`
+	TotalPages int    `json:"total_pages"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
 }
 
 type OauthProvider struct {
 	ID           string    `json:"id" sql:"id"`
 	UserID       string    `json:"user_id" sql:"userId"`
 	Type         string    `json:"type" sql:"type"`
-	RefreshToken string    `json:"refresh_token" sql:"refreshToken"`
-	AccessToken  string    `json:"access_token" sql:"accessToken"`
+	Subject      string    `json:"subject" sql:"subject"`
+	RefreshToken string    `json:"-" sql:"refreshToken"`
+	AccessToken  string    `json:"-" sql:"accessToken"`
 	ExpiresAt    time.Time `json:"expires_at" sql:"expiresAt"`
 	CreatedAt    time.Time `json:"created_at" sql:"createdAt"`
 }
@@ -28,6 +47,34 @@ type Session struct {
 	IP           string    `json:"ip" sql:"ip"`
 	ExpiresAt    time.Time `json:"expires_at" sql:"expiresAt"`
 	CreatedAt    time.Time `json:"created_at" sql:"createdAt"`
+	Current      bool      `json:"current"`
+	// MFAPending marks a session waiting for the second factor. It cannot be used for anything else.
+	MFAPending    bool       `json:"mfa_pending" sql:"mfaPending"`
+	MFAVerifiedAt *time.Time `json:"mfa_verified_at,omitempty" sql:"mfaVerifiedAt"`
+	// Token is the cookie value. The database only keeps its hash, so it is set when the session is created or
+	// rotated, and by Validate with the token the session was looked up by.
+	Token     string    `json:"-"`
+	RotatedAt time.Time `json:"-" sql:"rotatedAt"`
+}
+
+type MFA struct {
+	UserID       string     `json:"user_id" sql:"userId"`
+	Secret       string     `json:"-" sql:"secret"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty" sql:"confirmedAt"`
+	LastUsedStep *int64     `json:"-" sql:"lastUsedStep"`
+	LockedUntil  *time.Time `json:"-" sql:"lockedUntil"`
+	CreatedAt    time.Time  `json:"created_at" sql:"createdAt"`
+}
+
+type APIToken struct {
+	ID         string     `json:"id" sql:"id"`
+	UserID     string     `json:"user_id" sql:"userId"`
+	Name       string     `json:"name" sql:"name"`
+	Prefix     string     `json:"prefix" sql:"prefix"`
+	Scopes     []string   `json:"scopes" sql:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" sql:"expiresAt"`
+	LastUsedAt *time.Time `json:"last_used_at" sql:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"created_at" sql:"createdAt"`
 }
 
 type Phrase struct {
@@ -42,6 +89,7 @@ type Phrase struct {
 	CreatedAt        time.Time  `json:"created_at" sql:"createdAt"`
 	UpdatedAt        time.Time  `json:"updated_at" sql:"updatedAt"`
 	DeletedAt        *time.Time `json:"deleted_at" sql:"deletedAt"`
+	Version          int        `json:"version" sql:"version"`
 }
 
 type PhraseTag struct {
@@ -50,6 +98,7 @@ type PhraseTag struct {
 	TagName   string    `json:"tag_name" sql:"tagName"`
 	TagColor  string    `json:"tag_color" sql:"tagColor"`
 	CreatedAt time.Time `json:"created_at" sql:"createdAt"`
+	Version   int       `json:"version" sql:"version"`
 }
 
 type TaggedPhrase struct {
@@ -62,3 +111,115 @@ type SyncMetadata struct {
 	UserID        string    `json:"user_id" sql:"userId"`
 	LastUpdatedAt time.Time `json:"last_updated_at" sql:"lastUpdatedAt"`
 }
+
+type PhraseReview struct {
+	ID             string     `json:"id" sql:"id"`
+	PhraseID       string     `json:"phrase_id" sql:"phraseId"`
+	UserID         string     `json:"user_id" sql:"userId"`
+	EaseFactor     float64    `json:"ease_factor" sql:"easeFactor"`
+	Interval       int        `json:"interval" sql:"interval"`
+	Repetitions    int        `json:"repetitions" sql:"repetitions"`
+	Lapses         int        `json:"lapses" sql:"lapses"`
+	DueAt          time.Time  `json:"due_at" sql:"dueAt"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at" sql:"lastReviewedAt"`
+}
+
+type ReviewItem struct {
+	Phrase Phrase       `json:"phrase"`
+	Review PhraseReview `json:"review"`
+}
+
+type PhraseChanges struct {
+	Created []Phrase `json:"created"`
+	Updated []Phrase `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+type TagChanges struct {
+	Created []PhraseTag `json:"created"`
+	Updated []PhraseTag `json:"updated"`
+	Deleted []string    `json:"deleted"`
+}
+
+type SyncChanges struct {
+	Phrases PhraseChanges `json:"phrases"`
+	Tags    TagChanges    `json:"tags"`
+	Cursor  string        `json:"cursor"`
+	HasMore bool          `json:"has_more"`
+}
+
+type SyncMutation struct {
+	ClientID    string     `json:"client_id"`
+	Entity      string     `json:"entity"`
+	Operation   string     `json:"operation"`
+	EntityID    string     `json:"entity_id"`
+	BaseVersion int        `json:"base_version"`
+	Phrase      *Phrase    `json:"phrase,omitempty"`
+	Tag         *PhraseTag `json:"tag,omitempty"`
+}
+
+type SyncMutationResult struct {
+	ClientID string     `json:"client_id"`
+	Status   string     `json:"status"`
+	EntityID string     `json:"entity_id,omitempty"`
+	Version  int        `json:"version,omitempty"`
+	Conflict bool       `json:"conflict"`
+	Error    string     `json:"error,omitempty"`
+	Phrase   *Phrase    `json:"phrase,omitempty"`
+	Tag      *PhraseTag `json:"tag,omitempty"`
+}
+
+type PhraseSearchResult struct {
+	Phrase            Phrase  `json:"phrase"`
+	PhraseHighlight   string  `json:"phrase_highlight"`
+	DefinitionSnippet string  `json:"definition_snippet"`
+	Rank              float64 `json:"rank"`
+}
+
+type PhrasePage struct {
+	Items      []TaggedPhrase `json:"items"`
+	TotalCount int            `json:"total_count"`
+	TotalPages int            `json:"total_pages"`
+	Page       int            `json:"page,omitempty"`
+	PageSize   int            `json:"page_size"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	PrevCursor string         `json:"prev_cursor,omitempty"`
+}
+
+// ImportRecord is a single phrase read from an import file.
+type ImportRecord struct {
+	// Row is the line of the file the record starts on, or its position for Kindle words.
+	Row    int
+	Phrase Phrase
+	Tags   []string
+	// Err explains why the row could not be mapped onto a phrase. Such records are reported, not imported.
+	Err string
+}
+
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Phrase   string `json:"phrase"`
+	PhraseID string `json:"phrase_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type ImportReport struct {
+	Format  string      `json:"format"`
+	Created []ImportRow `json:"created"`
+	Skipped []ImportRow `json:"skipped"`
+	Failed  []ImportRow `json:"failed"`
+}
+
+// JobRun is the state of a background job, shared by every server running against the database.
+type JobRun struct {
+	Name           string     `json:"name" sql:"name"`
+	Running        bool       `json:"running"`
+	LockedBy       string     `json:"locked_by,omitempty" sql:"lockedBy"`
+	LastStartedAt  *time.Time `json:"last_started_at" sql:"lastStartedAt"`
+	LastFinishedAt *time.Time `json:"last_finished_at" sql:"lastFinishedAt"`
+	LastResult     string     `json:"last_result,omitempty" sql:"lastResult"`
+	LastError      string     `json:"last_error,omitempty" sql:"lastError"`
+	NextRunAt      *time.Time `json:"next_run_at" sql:"nextRunAt"`
+	Runs           int        `json:"runs" sql:"runs"`
+	Failures       int        `json:"failures" sql:"failures"`
+}
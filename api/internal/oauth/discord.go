@@ -7,8 +7,8 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 
+	"github.com/arinji2/vocab-thing/internal/config"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
 	"golang.org/x/oauth2"
@@ -18,15 +18,15 @@ type Discord struct {
 	BaseProvider
 }
 
-func NewDiscordProvider(ctx context.Context) *Discord {
+func NewDiscordProvider(ctx context.Context, client config.OAuthClient) *Discord {
 	return &Discord{
 		BaseProvider{
 			ProviderType: "discord",
 			Ctx:          ctx,
 			Config: &oauth2.Config{
-				ClientID:     os.Getenv("DISCORD_CLIENT_ID"),
-				ClientSecret: os.Getenv("DISCORD_CLIENT_SECRET"),
-				RedirectURL:  os.Getenv("DISCORD_REDIRECT_URL"),
+				ClientID:     client.ClientID,
+				ClientSecret: client.ClientSecret,
+				RedirectURL:  client.RedirectURL,
 				Scopes:       []string{"identify", "email"},
 				Endpoint: oauth2.Endpoint{
 					AuthURL:  "https://discord.com/oauth2/authorize",
@@ -84,9 +84,7 @@ func (p *Discord) FetchAuthUser(o *models.OauthProvider) (*models.User, error) {
 		Email:    extracted.Email,
 	}
 
-	if o.UserID == "" {
-		o.UserID = extracted.Id
-	}
+	o.Subject = extracted.Id
 
 	return user, nil
 }
@@ -0,0 +1,115 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/mailer"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/utils/idgen"
+)
+
+const (
+	// emailLoginExpiry is how long a login link can be used after it is sent.
+	emailLoginExpiry = 15 * time.Minute
+	// emailLoginLimit caps the links sent to one address per EmailLoginWindow, so the endpoint cannot flood an inbox.
+	emailLoginLimit = 5
+	// EmailLoginWindow is also how long sent tokens must be kept, expired or not, for the limit to count them.
+	EmailLoginWindow = time.Hour
+)
+
+// Email signs users in with a one-time link sent to their address instead of an OAuth provider.
+type Email struct {
+	Provider BaseProvider
+	Db       *sql.DB
+	Mailer   mailer.Mailer
+	// FrontendURL is where the login links point, as the frontend finishes the sign in.
+	FrontendURL string
+}
+
+func NewEmailProvider(ctx context.Context, db *sql.DB, m mailer.Mailer, frontendURL string) *Email {
+	return &Email{
+		Provider: BaseProvider{
+			ProviderType: "email",
+			Ctx:          ctx,
+		},
+		Db:          db,
+		Mailer:      m,
+		FrontendURL: frontendURL,
+	}
+}
+
+// NormalizeEmail accepts a bare address and returns it lowercased, so each inbox maps to one identity.
+func NormalizeEmail(address string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil || parsed.Name != "" || parsed.Address != strings.TrimSpace(address) {
+		return "", errorcode.ErrInvalidEmail
+	}
+	return strings.ToLower(parsed.Address), nil
+}
+
+// SendLoginLink emails a one-time login link to the address. Only the token's hash is stored.
+func (p *Email) SendLoginLink(address string) error {
+	email, err := NormalizeEmail(address)
+	if err != nil {
+		return err
+	}
+
+	tokenModel := database.EmailTokenModel{DB: p.Db}
+	token := idgen.GenerateRandomID(idgen.DefaultIDSize, idgen.URLSafeAlphanumericCharset)
+	now := time.Now()
+	err = tokenModel.CreateLimited(p.Provider.Ctx, email, HashLoginToken(token), now.Add(emailLoginExpiry), now.Add(-EmailLoginWindow), emailLoginLimit)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/auth/email/callback?token=%s", strings.TrimSuffix(p.FrontendURL, "/"), url.QueryEscape(token))
+	err = p.Mailer.Send(p.Provider.Ctx, mailer.Message{
+		To:      email,
+		Subject: "Sign in to Vocab Thing",
+		Body: fmt.Sprintf("Use this link to sign in to Vocab Thing:\n\n%s\n\nThe link works once and expires in %d minutes. If you did not ask to sign in, you can ignore this email.",
+			link, int(emailLoginExpiry/time.Minute)),
+	})
+	if err != nil {
+		log.Printf("error sending login email to %s: %s", email, err.Error())
+		return errorcode.ErrSendingEmail
+	}
+
+	return nil
+}
+
+// AuthenticateWithToken redeems a login link, returning the user and provider of its address for the
+// same sign in as an OAuth callback. The address itself is the provider subject.
+func (p *Email) AuthenticateWithToken(token string) (*models.User, *models.OauthProvider, error) {
+	tokenModel := database.EmailTokenModel{DB: p.Db}
+	email, err := tokenModel.Consume(p.Provider.Ctx, HashLoginToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := &models.User{
+		Username: strings.SplitN(email, "@", 2)[0],
+		Email:    email,
+	}
+	provider := &models.OauthProvider{
+		Type:    p.Provider.ProviderType,
+		Subject: email,
+	}
+
+	return user, provider, nil
+}
+
+func HashLoginToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,8 +7,8 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 
+	"github.com/arinji2/vocab-thing/internal/config"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
 	"golang.org/x/oauth2"
@@ -18,15 +18,15 @@ type Github struct {
 	BaseProvider
 }
 
-func NewGithubProvider(ctx context.Context) *Github {
+func NewGithubProvider(ctx context.Context, client config.OAuthClient) *Github {
 	return &Github{
 		BaseProvider{
 			ProviderType: "github",
 			Ctx:          ctx,
 			Config: &oauth2.Config{
-				ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-				ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-				RedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
+				ClientID:     client.ClientID,
+				ClientSecret: client.ClientSecret,
+				RedirectURL:  client.RedirectURL,
 				Scopes:       []string{"read:user", "user:email"},
 				Endpoint: oauth2.Endpoint{
 					AuthURL:  "https://github.com/login/oauth/authorize",
@@ -96,9 +96,7 @@ func (p *Github) FetchAuthUser(o *models.OauthProvider) (*models.User, error) {
 		Email:    extracted.Email,
 	}
 
-	if o.UserID == "" {
-		o.UserID = fmt.Sprintf("%d", extracted.ID)
-	}
+	o.Subject = fmt.Sprintf("%d", extracted.ID)
 
 	return user, nil
 }
@@ -7,8 +7,8 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 
+	"github.com/arinji2/vocab-thing/internal/config"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/models"
 	"golang.org/x/oauth2"
@@ -18,15 +18,15 @@ type Google struct {
 	BaseProvider
 }
 
-func NewGoogleProvider(ctx context.Context) *Google {
+func NewGoogleProvider(ctx context.Context, client config.OAuthClient) *Google {
 	return &Google{
 		BaseProvider{
 			ProviderType: "google",
 			Ctx:          ctx,
 			Config: &oauth2.Config{
-				ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-				ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-				RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+				ClientID:     client.ClientID,
+				ClientSecret: client.ClientSecret,
+				RedirectURL:  client.RedirectURL,
 				Scopes:       []string{"openid", "email", "profile"},
 				Endpoint: oauth2.Endpoint{
 					AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
@@ -87,9 +87,7 @@ func (p *Google) FetchAuthUser(o *models.OauthProvider) (*models.User, error) {
 		Email:    extracted.Email,
 	}
 
-	if o.UserID == "" {
-		o.UserID = extracted.Sub
-	}
+	o.Subject = extracted.Sub
 
 	return user, nil
 }
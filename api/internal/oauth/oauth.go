@@ -2,22 +2,26 @@ package oauth
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
 	"time"
 
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/config"
 	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/mailer"
 	"github.com/arinji2/vocab-thing/internal/models"
-	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
 )
 
 type ProviderInterface interface {
 	FetchAuthUser(o *models.OauthProvider) (*models.User, error)
 	GenerateCodeURL(r *http.Request, w http.ResponseWriter) (string, error)
-	AuthenticateWithCode(r *http.Request, code, state string) (*models.OauthProvider, error)
+	AuthenticateWithCode(r *http.Request, w http.ResponseWriter, code, state string) (*models.OauthProvider, error)
 	RefreshAccessToken(o *models.OauthProvider) error
 }
 
@@ -26,87 +30,152 @@ type BaseProvider struct {
 	Ctx          context.Context
 	Config       *oauth2.Config
 	UserInfoURL  string
+	// Nonce binds the ID token to the login, for providers whose ID token is verified.
+	Nonce bool
+	flows *flowStore
 }
 
-var (
-	sessionStore            = sessions.NewCookieStore([]byte(os.Getenv("SESSION_SECRET")))
-	ValidProviders []string = []string{"google", "github", "discord"}
-)
+// reservedNames are the provider types an OIDC provider cannot be registered under.
+var reservedNames = []string{"google", "github", "discord", "guest", "email"}
+
+// Providers creates the providers enabled in the configuration. A built-in provider without a client is turned
+// off, and asking for it fails as for an unknown provider.
+type Providers struct {
+	cfg   *config.Config
+	oidc  map[string]config.OIDCProvider
+	flows *flowStore
+}
 
-func NewProvider(ctx context.Context, providerType string) (ProviderInterface, error) {
+// NewProviders registers the configured providers. OIDC discovery happens on first use, so an identity provider
+// that is briefly down does not stop the server from starting.
+func NewProviders(cfg *config.Config) (*Providers, error) {
+	p := &Providers{
+		cfg:   cfg,
+		oidc:  map[string]config.OIDCProvider{},
+		flows: newFlowStore(cfg.SessionSecret, cfg.Production()),
+	}
+	for _, provider := range cfg.OIDC {
+		if err := p.registerOIDC(provider); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Providers) registerOIDC(provider config.OIDCProvider) error {
+	if slices.Contains(reservedNames, provider.Name) {
+		return fmt.Errorf("oidc provider name %q is already in use", provider.Name)
+	}
+	if _, ok := p.oidc[provider.Name]; ok {
+		return fmt.Errorf("oidc provider %q is registered twice", provider.Name)
+	}
+	if provider.Issuer == "" || provider.ClientID == "" {
+		return fmt.Errorf("oidc provider %q needs an issuer and client id", provider.Name)
+	}
+	if len(provider.Scopes) == 0 {
+		provider.Scopes = []string{"openid", "email", "profile"}
+	} else if !slices.Contains(provider.Scopes, "openid") {
+		provider.Scopes = append([]string{"openid"}, provider.Scopes...)
+	}
+
+	p.oidc[provider.Name] = provider
+	return nil
+}
+
+func (p *Providers) New(ctx context.Context, providerType string) (ProviderInterface, error) {
 	switch providerType {
 	case "google":
-		return NewGoogleProvider(ctx), nil
+		if !p.cfg.Google.Enabled() {
+			return nil, errorcode.ErrUnsupportedProvider
+		}
+		provider := NewGoogleProvider(ctx, p.cfg.Google)
+		provider.flows = p.flows
+		return provider, nil
 	case "github":
-		return NewGithubProvider(ctx), nil
+		if !p.cfg.GitHub.Enabled() {
+			return nil, errorcode.ErrUnsupportedProvider
+		}
+		provider := NewGithubProvider(ctx, p.cfg.GitHub)
+		provider.flows = p.flows
+		return provider, nil
 	case "discord":
-		return NewDiscordProvider(ctx), nil
+		if !p.cfg.Discord.Enabled() {
+			return nil, errorcode.ErrUnsupportedProvider
+		}
+		provider := NewDiscordProvider(ctx, p.cfg.Discord)
+		provider.flows = p.flows
+		return provider, nil
 	default:
-		return nil, errorcode.ErrUnsupportedProvider
+		c, ok := p.oidc[providerType]
+		if !ok {
+			return nil, errorcode.ErrUnsupportedProvider
+		}
+		provider, err := NewOIDCProvider(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		provider.flows = p.flows
+		return provider, nil
 	}
 }
 
+// NewEmail creates the provider that signs users in with a link sent to their address, pointing at the frontend.
+func (p *Providers) NewEmail(ctx context.Context, db *sql.DB, m mailer.Mailer) *Email {
+	return NewEmailProvider(ctx, db, m, p.cfg.FrontendURL)
+}
+
 func (p *BaseProvider) GenerateCodeURL(r *http.Request, w http.ResponseWriter) (string, error) {
-	state := GenerateState(r, w)
-	session, err := sessionStore.Get(r, "oauth_session")
-	if err != nil {
-		log.Printf("error getting session store: %s", err.Error())
-		return "", errorcode.ErrGettingSessionStore
+	f := newFlow(p.Nonce)
+	if err := p.flows.save(r, w, f); err != nil {
+		return "", err
 	}
-	session.Values["oauth_state"] = state
 
-	session.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   SessionExpiry(time.Now()).UTC().Second(),
-		HttpOnly: true,
-		Secure:   os.Getenv("ENVIRONMENT") == "production",
-		SameSite: http.SameSiteLaxMode,
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(f.Verifier)}
+	if f.Nonce != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", f.Nonce))
 	}
-	err = session.Save(r, w)
-	if err != nil {
-		log.Printf("error saving session store: %s", err.Error())
-		return "", errorcode.ErrSavingSessionStore
-	}
-	return p.Config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), nil
+	return p.Config.AuthCodeURL(f.State, opts...), nil
 }
 
-func (p *BaseProvider) AuthenticateWithCode(r *http.Request, code string, state string) (*models.OauthProvider, error) {
-	session, err := sessionStore.Get(r, "oauth_session")
+func (p *BaseProvider) AuthenticateWithCode(r *http.Request, w http.ResponseWriter, code string, state string) (*models.OauthProvider, error) {
+	token, _, err := p.exchange(r, w, code, state)
 	if err != nil {
-		log.Printf("error getting session store: %s", err.Error())
-		return nil, errorcode.ErrGettingSessionStore
-	}
-	val := session.Values["oauth_state"]
-	sessionState, ok := val.(string)
-	if !ok {
-		return nil, errorcode.ErrInvalidOauthState
+		return nil, err
 	}
-	state, err = url.QueryUnescape(state)
+	return &models.OauthProvider{
+		Type:         p.ProviderType,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    token.Expiry,
+	}, nil
+}
+
+// exchange redeems the login started by GenerateCodeURL and trades the code for a token, proving
+// with the PKCE verifier that this is the client that started it.
+func (p *BaseProvider) exchange(r *http.Request, w http.ResponseWriter, code string, state string) (*oauth2.Token, flow, error) {
+	state, err := url.QueryUnescape(state)
 	if err != nil {
 		log.Printf("error unescaping state: %s", err.Error())
-		return nil, errorcode.ErrURLUnescape
+		return nil, flow{}, errorcode.ErrURLUnescape
 	}
 
 	code, err = url.QueryUnescape(code)
 	if err != nil {
 		log.Printf("error unescaping code: %s", err.Error())
-		return nil, errorcode.ErrURLUnescape
+		return nil, flow{}, errorcode.ErrURLUnescape
 	}
 
-	if sessionState != state {
-		return nil, errorcode.ErrInvalidOauthState
+	f, err := p.flows.take(r, w, state)
+	if err != nil {
+		return nil, flow{}, err
 	}
-	token, err := p.Config.Exchange(p.Ctx, code)
+
+	token, err := p.Config.Exchange(p.Ctx, code, oauth2.VerifierOption(f.Verifier))
 	if err != nil {
 		log.Printf("error exchanging token: %s", err.Error())
-		return nil, errorcode.ErrExchangeToken
+		return nil, flow{}, errorcode.ErrExchangeToken
 	}
-	return &models.OauthProvider{
-		Type:         p.ProviderType,
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
-		ExpiresAt:    token.Expiry,
-	}, nil
+	return token, f, nil
 }
 
 func (p *BaseProvider) RefreshAccessToken(o *models.OauthProvider) error {
@@ -138,6 +207,22 @@ func (p *BaseProvider) RefreshAccessToken(o *models.OauthProvider) error {
 	return nil
 }
 
+// PlaceholderEmail stands in for the email of identities whose provider shares none, such as GitHub users with private emails.
+func PlaceholderEmail(providerType, subject string) string {
+	return fmt.Sprintf("%s-%s@noreply.example.com", providerType, subject)
+}
+
+// AccountEmail is the email a user signing in with a provider is stored and matched under. It is normalized the way
+// email sign in does, so both reach the same user, and is a placeholder when the provider shares no valid address.
+func AccountEmail(email, providerType, subject string) string {
+	if normalized, err := NormalizeEmail(email); err == nil {
+		return normalized
+	}
+	return PlaceholderEmail(providerType, subject)
+}
+
+// SessionExpiry returns when a session signed in at t expires if it is not used. Each use slides the expiry
+// forward again, see auth.SessionRefresh.
 func SessionExpiry(t time.Time) time.Time {
-	return t.Add(time.Hour * 24 * 7) // 7 days
+	return t.Add(auth.SessionIdleTimeout)
 }
@@ -0,0 +1,23 @@
+package oauth
+
+import "testing"
+
+func TestAccountEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"Mixed Case", " Alice@Example.COM ", "alice@example.com"},
+		{"Missing", "", "github-42@noreply.example.com"},
+		{"Not An Address", "Alice <alice@example.com>", "github-42@noreply.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AccountEmail(tt.email, "github", "42"); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"golang.org/x/oauth2"
+)
+
+type OIDC struct {
+	BaseProvider
+	issuer   *oidcIssuer
+	clientID string
+	// claims holds the verified ID token of the last AuthenticateWithCode call.
+	claims *oidcClaims
+}
+
+// discoveryTTL is how long a provider's discovery document and keys are cached before being fetched again.
+const discoveryTTL = 24 * time.Hour
+
+var (
+	oidcIssuers   = map[string]*oidcIssuer{}
+	oidcIssuersMu sync.Mutex
+)
+
+func NewOIDCProvider(ctx context.Context, c config.OIDCProvider) (*OIDC, error) {
+	issuer, err := discoverIssuer(ctx, c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDC{
+		BaseProvider: BaseProvider{
+			ProviderType: c.Name,
+			Ctx:          ctx,
+			Config: &oauth2.Config{
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+				RedirectURL:  c.RedirectURL,
+				Scopes:       c.Scopes,
+				Endpoint: oauth2.Endpoint{
+					AuthURL:  issuer.discovery.AuthorizationEndpoint,
+					TokenURL: issuer.discovery.TokenEndpoint,
+				},
+			},
+			UserInfoURL: issuer.discovery.UserinfoEndpoint,
+			Nonce:       true,
+		},
+		issuer:   issuer,
+		clientID: c.ClientID,
+	}, nil
+}
+
+// AuthenticateWithCode exchanges the code and verifies the ID token that comes with the access token.
+func (p *OIDC) AuthenticateWithCode(r *http.Request, w http.ResponseWriter, code, state string) (*models.OauthProvider, error) {
+	token, f, err := p.exchange(r, w, code, state)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		log.Printf("no id token in %s token response", p.ProviderType)
+		return nil, errorcode.ErrInvalidIDToken
+	}
+	claims, err := p.verifyIDToken(rawIDToken, f.Nonce)
+	if err != nil {
+		log.Printf("error verifying %s id token: %s", p.ProviderType, err.Error())
+		return nil, errorcode.ErrInvalidIDToken
+	}
+	p.claims = &claims
+
+	return &models.OauthProvider{
+		Type:         p.ProviderType,
+		Subject:      claims.Subject,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    token.Expiry,
+	}, nil
+}
+
+// FetchAuthUser maps the ID token claims to a user, asking the userinfo endpoint when the ID token
+// has no email, as providers are free to only put the subject in it.
+func (p *OIDC) FetchAuthUser(o *models.OauthProvider) (*models.User, error) {
+	var claims oidcClaims
+	if p.claims != nil {
+		claims = *p.claims
+	}
+
+	if claims.Email == "" && p.UserInfoURL != "" {
+		info, err := p.fetchUserInfo(o)
+		if err != nil {
+			return nil, err
+		}
+		if claims.Subject != "" && info.Subject != claims.Subject {
+			log.Printf("%s userinfo subject %q does not match id token subject %q", p.ProviderType, info.Subject, claims.Subject)
+			return nil, errorcode.ErrFetchingOauthUser
+		}
+		claims = info
+	}
+
+	// An unverified email would let anyone claim an existing account that signed in another way. Providers need not
+	// send email_verified at all, so only an email they vouch for is used.
+	email := claims.Email
+	if claims.EmailVerified == nil || !*claims.EmailVerified {
+		email = ""
+	}
+	username := claims.Name
+	if username == "" {
+		username = claims.PreferredUsername
+	}
+
+	o.Subject = claims.Subject
+
+	return &models.User{
+		Username: username,
+		Email:    email,
+	}, nil
+}
+
+func (p *OIDC) fetchUserInfo(o *models.OauthProvider) (oidcClaims, error) {
+	var claims oidcClaims
+
+	err := p.RefreshAccessToken(o)
+	if err != nil {
+		log.Printf("error refreshing access token: %s", err.Error())
+		return claims, errorcode.ErrRefreshToken
+	}
+
+	req, err := http.NewRequestWithContext(p.Ctx, "GET", p.UserInfoURL, nil)
+	if err != nil {
+		log.Printf("error creating request: %s", err.Error())
+		return claims, errorcode.ErrFetchingOauthUser
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.AccessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("error making request: %s", err.Error())
+		return claims, errorcode.ErrFetchingOauthUser
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("unexpected status code: %d", resp.StatusCode)
+		return claims, errorcode.ErrFetchingOauthUser
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("error reading response body: %s", err.Error())
+		return claims, errorcode.ErrFetchingOauthUser
+	}
+
+	if err := json.Unmarshal(body, &claims); err != nil {
+		log.Printf("error unmarshalling response body: %s", err.Error())
+		return claims, errorcode.ErrFetchingOauthUser
+	}
+
+	return claims, nil
+}
+
+// verifyIDToken checks the signature of an ID token against the issuer's keys, then its issuer, audience,
+// expiry and that its nonce is the one sent with this login, so a token issued for another login is refused.
+func (p *OIDC) verifyIDToken(raw, nonce string) (oidcClaims, error) {
+	var claims oidcClaims
+
+	payload, err := verifyJWT(raw, p.issuer.discovery.IDTokenSigningAlgs, func(kid string) (any, error) {
+		return p.issuer.key(p.Ctx, kid)
+	})
+	if err != nil {
+		return claims, err
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("decoding claims: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.issuer.discovery.Issuer:
+		return claims, fmt.Errorf("issuer %q does not match %q", claims.Issuer, p.issuer.discovery.Issuer)
+	case !slices.Contains(claims.Audience, p.clientID):
+		return claims, fmt.Errorf("audience %v does not include client %q", claims.Audience, p.clientID)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		return claims, fmt.Errorf("authorized party %q is not client %q", claims.AuthorizedParty, p.clientID)
+	case claims.Expiry == 0 || now.Add(-jwtLeeway).Unix() > claims.Expiry:
+		return claims, fmt.Errorf("token expired at %d", claims.Expiry)
+	case claims.IssuedAt > now.Add(jwtLeeway).Unix():
+		return claims, fmt.Errorf("token issued in the future at %d", claims.IssuedAt)
+	case claims.Subject == "":
+		return claims, fmt.Errorf("token has no subject")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return claims, fmt.Errorf("nonce does not match")
+	}
+
+	return claims, nil
+}
+
+type oidcClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     *bool    `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience accepts both forms of the aud claim, a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+type oidcDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	IDTokenSigningAlgs    []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// oidcIssuer caches the discovery document and signing keys of an issuer across requests.
+type oidcIssuer struct {
+	discovery     oidcDiscovery
+	fetchedAt     time.Time
+	mu            sync.Mutex
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func discoverIssuer(ctx context.Context, issuerURL string) (*oidcIssuer, error) {
+	oidcIssuersMu.Lock()
+	defer oidcIssuersMu.Unlock()
+
+	if issuer, ok := oidcIssuers[issuerURL]; ok && time.Since(issuer.fetchedAt) < discoveryTTL {
+		return issuer, nil
+	}
+
+	var discovery oidcDiscovery
+	wellKnown := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, wellKnown, &discovery); err != nil {
+		log.Printf("error fetching openid configuration of %s: %s", issuerURL, err.Error())
+		return nil, errorcode.ErrOIDCDiscovery
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(issuerURL, "/") {
+		log.Printf("openid configuration of %s names issuer %s", issuerURL, discovery.Issuer)
+		return nil, errorcode.ErrOIDCDiscovery
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		log.Printf("openid configuration of %s is missing endpoints", issuerURL)
+		return nil, errorcode.ErrOIDCDiscovery
+	}
+
+	issuer := &oidcIssuer{discovery: discovery, fetchedAt: time.Now()}
+	oidcIssuers[issuerURL] = issuer
+	return issuer, nil
+}
+
+// key returns the signing key with the given ID. Unknown IDs refetch the key set, at most once a
+// minute, so keys the provider rotated in are picked up without a restart.
+func (i *oidcIssuer) key(ctx context.Context, kid string) (any, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if key, ok := i.lookupKey(kid); ok && time.Since(i.keysFetchedAt) < discoveryTTL {
+		return key, nil
+	}
+	if time.Since(i.keysFetchedAt) < time.Minute {
+		return nil, fmt.Errorf("no key with id %q", kid)
+	}
+
+	var set jwkSet
+	if err := getJSON(ctx, i.discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	i.keys = set.publicKeys()
+	i.keysFetchedAt = time.Now()
+
+	if key, ok := i.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no key with id %q", kid)
+}
+
+func (i *oidcIssuer) lookupKey(kid string) (any, bool) {
+	// Tokens without a key ID can only be checked against a set of one.
+	if kid == "" && len(i.keys) == 1 {
+		for _, key := range i.keys {
+			return key, true
+		}
+	}
+	key, ok := i.keys[kid]
+	return key, ok
+}
+
+func getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
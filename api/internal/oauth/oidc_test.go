@@ -0,0 +1,288 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+// testIssuer is a stand-in OIDC provider serving discovery, keys, a token endpoint and userinfo.
+type testIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	claims    map[string]any
+	userInfo  map[string]any
+	challenge string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	ti := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                ti.URL,
+			"authorization_endpoint":                ti.URL + "/authorize",
+			"token_endpoint":                        ti.URL + "/token",
+			"userinfo_endpoint":                     ti.URL + "/userinfo",
+			"jwks_uri":                              ti.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifier[:]) != ti.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"id_token":      ti.sign(t, "test-key", ti.claims),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(ti.userInfo)
+	})
+
+	ti.Server = httptest.NewServer(mux)
+	t.Cleanup(ti.Close)
+	return ti
+}
+
+func (ti *testIssuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, ti.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (ti *testIssuer) validClaims() map[string]any {
+	return map[string]any{
+		"iss":                ti.URL,
+		"sub":                "user-1",
+		"aud":                "client",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"email":              "user@example.com",
+		"email_verified":     true,
+		"name":               "Test User",
+		"preferred_username": "test",
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ti := newTestIssuer(t)
+
+	sso := config.OIDCProvider{Name: "test-sso", Issuer: ti.URL, ClientID: "client", ClientSecret: "secret"}
+	cfg := &config.Config{SessionSecret: "test-secret", OIDC: []config.OIDCProvider{sso}}
+	providers, err := NewProviders(cfg)
+	if err != nil {
+		t.Fatalf("Failed to register provider: %v", err)
+	}
+	if _, err := NewProviders(&config.Config{OIDC: []config.OIDCProvider{sso, sso}}); err == nil {
+		t.Errorf("Expected a second provider with the same name to be rejected")
+	}
+	if _, err := providers.New(context.Background(), "google"); err == nil {
+		t.Errorf("Expected a built-in provider without a client to be turned off")
+	}
+
+	login := func(t *testing.T) (*OIDC, *models.OauthProvider, error) {
+		provider, err := providers.New(context.Background(), "test-sso")
+		if err != nil {
+			t.Fatalf("Failed to create provider: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		codeURL, err := provider.GenerateCodeURL(httptest.NewRequest("POST", "/", nil), w)
+		if err != nil {
+			t.Fatalf("Failed to generate code url: %v", err)
+		}
+		if !strings.HasPrefix(codeURL, ti.URL+"/authorize?") {
+			t.Errorf("Expected code url from discovery, got %s", codeURL)
+		}
+		query, _ := url.Parse(codeURL)
+		params := query.Query()
+		if params.Get("code_challenge_method") != "S256" || params.Get("nonce") == "" {
+			t.Errorf("Expected pkce challenge and nonce in code url, got %s", codeURL)
+		}
+		ti.challenge = params.Get("code_challenge")
+		if _, ok := ti.claims["nonce"]; !ok {
+			ti.claims["nonce"] = params.Get("nonce")
+		}
+
+		callback := func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+			return r
+		}
+		p, err := provider.AuthenticateWithCode(callback(), httptest.NewRecorder(), "code", params.Get("state"))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Replaying a copy of the flow cookie must not redeem the same state again.
+		if _, err := provider.AuthenticateWithCode(callback(), httptest.NewRecorder(), "code", params.Get("state")); err == nil {
+			t.Errorf("Expected state to be single use")
+		}
+		if p.Subject != "user-1" || p.AccessToken != "access" {
+			t.Errorf("Unexpected provider: %+v", p)
+		}
+		return provider.(*OIDC), p, nil
+	}
+
+	t.Run("ID Token Claims", func(t *testing.T) {
+		ti.claims = ti.validClaims()
+		provider, p, err := login(t)
+		if err != nil {
+			t.Fatalf("Failed to authenticate: %v", err)
+		}
+		user, err := provider.FetchAuthUser(p)
+		if err != nil {
+			t.Fatalf("Failed to fetch user: %v", err)
+		}
+		if user.Email != "user@example.com" || user.Username != "Test User" {
+			t.Errorf("Unexpected user: %+v", user)
+		}
+	})
+
+	t.Run("Email Without Verified Claim", func(t *testing.T) {
+		ti.claims = ti.validClaims()
+		delete(ti.claims, "email_verified")
+		provider, p, err := login(t)
+		if err != nil {
+			t.Fatalf("Failed to authenticate: %v", err)
+		}
+		user, err := provider.FetchAuthUser(p)
+		if err != nil {
+			t.Fatalf("Failed to fetch user: %v", err)
+		}
+		if user.Email != "" {
+			t.Errorf("Expected an email not marked verified to be dropped, got %s", user.Email)
+		}
+	})
+
+	t.Run("Userinfo Fallback", func(t *testing.T) {
+		ti.claims = ti.validClaims()
+		delete(ti.claims, "email")
+		ti.userInfo = map[string]any{"sub": "user-1", "email": "info@example.com", "email_verified": false, "preferred_username": "test"}
+		provider, p, err := login(t)
+		if err != nil {
+			t.Fatalf("Failed to authenticate: %v", err)
+		}
+		user, err := provider.FetchAuthUser(p)
+		if err != nil {
+			t.Fatalf("Failed to fetch user: %v", err)
+		}
+		if user.Email != "" || user.Username != "test" {
+			t.Errorf("Expected unverified email to be dropped, got %+v", user)
+		}
+
+		ti.userInfo["sub"] = "someone-else"
+		if _, err := provider.FetchAuthUser(p); err == nil {
+			t.Errorf("Expected userinfo for another subject to be rejected")
+		}
+	})
+
+	t.Run("Rejected ID Tokens", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			modify func(claims map[string]any)
+		}{
+			{"Wrong Issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }},
+			{"Wrong Audience", func(c map[string]any) { c["aud"] = "other-client" }},
+			{"Other Authorized Party", func(c map[string]any) { c["aud"] = []string{"client", "other"}; c["azp"] = "other" }},
+			{"Expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+			{"No Subject", func(c map[string]any) { delete(c, "sub") }},
+			{"Other Nonce", func(c map[string]any) { c["nonce"] = "other-login" }},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ti.claims = ti.validClaims()
+				tt.modify(ti.claims)
+				if _, _, err := login(t); err == nil {
+					t.Errorf("Expected id token to be rejected")
+				}
+			})
+		}
+	})
+}
+
+func TestVerifyJWT(t *testing.T) {
+	ti := newTestIssuer(t)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keyFor := func(kid string) (any, error) { return &ti.key.PublicKey, nil }
+
+	token := ti.sign(t, "test-key", map[string]any{"sub": "user-1"})
+	if _, err := verifyJWT(token, nil, keyFor); err != nil {
+		t.Errorf("Expected valid token, got %v", err)
+	}
+	if _, err := verifyJWT(token, []string{"ES256"}, keyFor); err == nil {
+		t.Errorf("Expected algorithm outside the allowed list to be rejected")
+	}
+
+	forged := ti.sign(t, "test-key", map[string]any{"sub": "user-2"})
+	parts := strings.Split(token, ".")
+	forgedParts := strings.Split(forged, ".")
+	if _, err := verifyJWT(parts[0]+"."+forgedParts[1]+"."+parts[2], nil, keyFor); err == nil {
+		t.Errorf("Expected swapped payload to be rejected")
+	}
+
+	if _, err := verifyJWT(token, nil, func(string) (any, error) { return &other.PublicKey, nil }); err == nil {
+		t.Errorf("Expected token signed by another key to be rejected")
+	}
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	if _, err := verifyJWT(none, nil, keyFor); err == nil {
+		t.Errorf("Expected unsigned token to be rejected")
+	}
+}
@@ -1,26 +1,139 @@
 package oauth
 
 import (
+	"crypto/subtle"
+	"log"
 	"net/http"
-	"os"
+	"sync"
 	"time"
 
+	"github.com/arinji2/vocab-thing/internal/errorcode"
 	"github.com/arinji2/vocab-thing/internal/utils/idgen"
+	"github.com/gorilla/sessions"
 )
 
-// GenerateState creates a random state string and stores it in a cookie
-func GenerateState(r *http.Request, w http.ResponseWriter) string {
-	state := idgen.GenerateRandomID(idgen.DefaultIDSize, idgen.URLSafeAlphanumericCharset)
+// flowExpiry is how long a user has to finish signing in with a provider after the code URL is generated.
+const flowExpiry = 10 * time.Minute
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
+const flowSessionName = "oauth_session"
+
+// redeemed remembers the states used until they expire, as clearing the cookie cannot stop a copy of it being replayed.
+var (
+	redeemed   = map[string]int64{}
+	redeemedMu sync.Mutex
+)
+
+// flow holds the secrets of a login in progress, kept in an encrypted cookie between the code URL and the callback.
+type flow struct {
+	State    string
+	Verifier string
+	Nonce    string
+}
+
+// GenerateState creates a random state string
+func GenerateState() string {
+	return idgen.GenerateRandomID(idgen.OauthStateSize, idgen.URLSafeAlphanumericCharset)
+}
+
+// newFlow starts a login with a fresh state and PKCE code verifier, and a nonce when the provider checks ID tokens.
+func newFlow(withNonce bool) flow {
+	f := flow{
+		State:    GenerateState(),
+		Verifier: idgen.GenerateRandomID(idgen.OauthCodeVerifierSize, idgen.URLSafeAlphanumericCharset),
+	}
+	if withNonce {
+		f.Nonce = idgen.GenerateRandomID(idgen.OauthStateSize, idgen.URLSafeAlphanumericCharset)
+	}
+	return f
+}
+
+// flowStore keeps logins in progress in a cookie encrypted and signed with SESSION_SECRET.
+type flowStore struct {
+	store  *sessions.CookieStore
+	secure bool
+}
+
+func newFlowStore(secret string, secure bool) *flowStore {
+	return &flowStore{store: sessions.NewCookieStore([]byte(secret)), secure: secure}
+}
+
+func (s *flowStore) save(r *http.Request, w http.ResponseWriter, f flow) error {
+	session, err := s.store.Get(r, flowSessionName)
+	if err != nil {
+		// A cookie signed with an old secret is replaced rather than failing the login.
+		log.Printf("error getting session store, starting a new one: %s", err.Error())
+	}
+	session.Values["oauth_state"] = f.State
+	session.Values["oauth_verifier"] = f.Verifier
+	session.Values["oauth_nonce"] = f.Nonce
+	session.Values["oauth_expires"] = time.Now().Add(flowExpiry).Unix()
+	session.Options = s.cookieOptions(int(flowExpiry / time.Second))
+
+	if err := session.Save(r, w); err != nil {
+		log.Printf("error saving session store: %s", err.Error())
+		return errorcode.ErrSavingSessionStore
+	}
+	return nil
+}
+
+// take returns the login in progress if state matches it. The cookie is cleared either way, so a
+// state can only be redeemed once.
+func (s *flowStore) take(r *http.Request, w http.ResponseWriter, state string) (flow, error) {
+	session, err := s.store.Get(r, flowSessionName)
+	if err != nil {
+		log.Printf("error getting session store: %s", err.Error())
+		return flow{}, errorcode.ErrGettingSessionStore
+	}
+
+	sessionState, _ := session.Values["oauth_state"].(string)
+	verifier, _ := session.Values["oauth_verifier"].(string)
+	nonce, _ := session.Values["oauth_nonce"].(string)
+	expires, _ := session.Values["oauth_expires"].(int64)
+
+	session.Values = map[any]any{}
+	session.Options = s.cookieOptions(-1)
+	if err := session.Save(r, w); err != nil {
+		log.Printf("error clearing session store: %s", err.Error())
+		return flow{}, errorcode.ErrSavingSessionStore
+	}
+
+	if sessionState == "" || verifier == "" || time.Now().Unix() > expires {
+		return flow{}, errorcode.ErrInvalidOauthState
+	}
+	if subtle.ConstantTimeCompare([]byte(sessionState), []byte(state)) != 1 {
+		return flow{}, errorcode.ErrInvalidOauthState
+	}
+	if !redeem(sessionState, expires) {
+		return flow{}, errorcode.ErrInvalidOauthState
+	}
+
+	return flow{State: sessionState, Verifier: verifier, Nonce: nonce}, nil
+}
+
+// redeem marks a state as used, reporting false if it already was.
+func redeem(state string, expires int64) bool {
+	redeemedMu.Lock()
+	defer redeemedMu.Unlock()
+
+	now := time.Now().Unix()
+	for s, exp := range redeemed {
+		if now > exp {
+			delete(redeemed, s)
+		}
+	}
+	if _, ok := redeemed[state]; ok {
+		return false
+	}
+	redeemed[state] = expires
+	return true
+}
+
+func (s *flowStore) cookieOptions(maxAge int) *sessions.Options {
+	return &sessions.Options{
 		Path:     "/",
+		MaxAge:   maxAge,
 		HttpOnly: true,
-		Secure:   os.Getenv("ENVIRONMENT") == "production",
+		Secure:   s.secure,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   SessionExpiry(time.Now()).UTC().Second(),
-	})
-
-	return state
+	}
 }
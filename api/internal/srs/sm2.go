@@ -0,0 +1,69 @@
+package srs
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	DefaultEaseFactor = 2.5
+	MinEaseFactor     = 1.3
+	MinQuality        = 0
+	MaxQuality        = 5
+	// Grades below this are treated as a failed recall and reset the card.
+	PassingQuality = 3
+)
+
+// State is the scheduling state of a single reviewed item.
+type State struct {
+	EaseFactor  float64
+	Interval    int // days
+	Repetitions int
+	Lapses      int
+	DueAt       time.Time
+}
+
+// NewState returns the state for an item that has never been reviewed, due immediately.
+func NewState(now time.Time) State {
+	return State{
+		EaseFactor: DefaultEaseFactor,
+		DueAt:      now,
+	}
+}
+
+// ValidQuality reports whether q is a grade the scheduler accepts.
+func ValidQuality(q int) bool {
+	return q >= MinQuality && q <= MaxQuality
+}
+
+// Schedule applies an SM-2 review with grade q (0-5) at time now and returns the next state.
+func Schedule(s State, q int, now time.Time) State {
+	if s.EaseFactor == 0 {
+		s.EaseFactor = DefaultEaseFactor
+	}
+
+	if q < PassingQuality {
+		s.Repetitions = 0
+		s.Interval = 1
+		s.Lapses++
+	} else {
+		s.Repetitions++
+		switch s.Repetitions {
+		case 1:
+			s.Interval = 1
+		case 2:
+			s.Interval = 6
+		default:
+			s.Interval = int(math.Round(float64(s.Interval) * s.EaseFactor))
+		}
+	}
+
+	miss := float64(MaxQuality - q)
+	s.EaseFactor += 0.1 - miss*(0.08+miss*0.02)
+	if s.EaseFactor < MinEaseFactor {
+		s.EaseFactor = MinEaseFactor
+	}
+
+	s.DueAt = now.Add(time.Duration(s.Interval) * 24 * time.Hour)
+	return s
+}
@@ -0,0 +1,50 @@
+package srs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2025, 3, 22, 10, 0, 0, 0, time.UTC)
+
+	t.Run("Passing Grades Grow Interval", func(t *testing.T) {
+		s := NewState(now)
+		expected := []int{1, 6, 15}
+		for i, want := range expected {
+			s = Schedule(s, 4, now)
+			if s.Interval != want {
+				t.Fatalf("review %d: expected interval %d, got %d", i+1, want, s.Interval)
+			}
+		}
+		if s.Repetitions != 3 {
+			t.Errorf("Expected 3 repetitions, got %d", s.Repetitions)
+		}
+		if !s.DueAt.Equal(now.Add(15 * 24 * time.Hour)) {
+			t.Errorf("Expected due date 15 days out, got %s", s.DueAt)
+		}
+	})
+
+	t.Run("Failing Grade Resets", func(t *testing.T) {
+		s := NewState(now)
+		s = Schedule(s, 5, now)
+		s = Schedule(s, 5, now)
+		s = Schedule(s, 1, now)
+		if s.Repetitions != 0 || s.Interval != 1 {
+			t.Errorf("Expected reset to 0 repetitions and 1 day, got %d and %d", s.Repetitions, s.Interval)
+		}
+		if s.Lapses != 1 {
+			t.Errorf("Expected 1 lapse, got %d", s.Lapses)
+		}
+	})
+
+	t.Run("Ease Floor", func(t *testing.T) {
+		s := NewState(now)
+		for range 10 {
+			s = Schedule(s, 0, now)
+		}
+		if s.EaseFactor != MinEaseFactor {
+			t.Errorf("Expected ease factor %.2f, got %.2f", MinEaseFactor, s.EaseFactor)
+		}
+	})
+}
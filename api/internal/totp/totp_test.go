@@ -0,0 +1,61 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		if got != tt.expected {
+			t.Errorf("Expected %s at %d, got %s", tt.expected, tt.unix, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Step(now))
+
+	if step, ok := Validate(rfcSecret, code, now); !ok || step != Step(now) {
+		t.Errorf("Expected current code to match step %d, got %d %v", Step(now), step, ok)
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(Period)); !ok {
+		t.Errorf("Expected code from the previous period to be accepted")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(3*Period)); ok {
+		t.Errorf("Expected code from three periods ago to be rejected")
+	}
+	if _, ok := Validate(rfcSecret, "000000", now); ok {
+		t.Errorf("Expected wrong code to be rejected")
+	}
+	if _, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now); !ok {
+		t.Errorf("Expected code with a space to be accepted")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Vocab Thing", "user@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Vocab%20Thing:user@example.com?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("Unexpected uri: %s", uri)
+	}
+}
@@ -3,4 +3,8 @@ package idgen
 const (
 	URLSafeAlphanumericCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
 	NumberCharset              = "123456789"
+	// RecoveryCodeCharset is Crockford's base32 alphabet, which leaves out letters that are easily misread as digits.
+	RecoveryCodeCharset = "0123456789abcdefghjkmnpqrstvwxyz"
+	// EntityIDCharset is the alphabet of phrase and tag IDs, which the database generates as lowercase hex.
+	EntityIDCharset = "0123456789abcdef"
 )
@@ -29,3 +29,16 @@ func GenerateRandomID(length int, charset string) string {
 
 	return idBuilder.String()
 }
+
+// IsValid reports whether id has the given length and only uses characters from charset.
+func IsValid(id string, length int, charset string) bool {
+	if len(id) != length {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(charset, c) {
+			return false
+		}
+	}
+	return true
+}
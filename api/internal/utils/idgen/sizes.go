@@ -4,4 +4,8 @@ var (
 	OauthCodeVerifierSize = 48
 	OauthStateSize        = 32
 	DefaultIDSize         = 32
+	APITokenSize          = 40
+	SessionTokenSize      = 40
+	RecoveryCodeSize      = 10
+	EntityIDSize          = 32
 )
@@ -1,31 +1,256 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/arinji2/vocab-thing/internal/config"
 	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/jobs"
+	"github.com/arinji2/vocab-thing/internal/mailer"
+	"github.com/arinji2/vocab-thing/internal/oauth"
 	"github.com/arinji2/vocab-thing/routes"
 	_ "github.com/joho/godotenv/autoload"
 )
 
+const usage = `Usage: vocab-thing [--config file] [--db path] [--addr :8080] <command> [arguments]
+
+Commands:
+  serve                                        start the API server (the default)
+  migrate up|down|status                       apply, roll back or list schema migrations
+  user list [--search s] [--page n]            list users
+  user create --username u --email e [--admin] create a user, who signs in with an email link
+  user disable|enable <user>                   disable a user and expire their sessions, or enable them again
+  session purge [--user <user>]                delete expired sessions, or every session of a user
+  backup [<file>]                              write a checked copy of the database while it is in use
+  restore [--yes] <file>                       replace the database with a backup, with the server stopped
+  export --user <user> [--format f] [--out f]  export a user's phrases, as the export endpoint does
+  reencrypt-tokens                             encrypt stored OAuth tokens with the active key
+
+A <user> is a user ID, username or email. Settings are read from the environment and the optional --config file,
+which is in the same format as .env; the flags override both. See docs/cli.md.
+`
+
 func main() {
-	db, err := database.SetupDatabase("../db/app.db")
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(usage)
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	if err := run(cfg, args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "serve":
+		if len(args) > 1 {
+			return fmt.Errorf("serve takes no arguments, flags such as --addr go before the command")
+		}
+		return serve(cfg)
+	case "migrate":
+		return migrateCommand(cfg, args[1:])
+	case "user":
+		return userCommand(cfg, args[1:])
+	case "session":
+		return sessionCommand(cfg, args[1:])
+	case "backup":
+		return backupCommand(cfg, args[1:])
+	case "restore":
+		return restoreCommand(cfg, args[1:])
+	case "export":
+		return exportCommand(cfg, args[1:])
+	case "reencrypt-tokens":
+		return reencryptTokens(cfg)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// openDatabase opens the database with the token keyring set up. Only serve migrates the schema on its own; every
+// other command refuses a schema with pending migrations, so it never runs against tables it does not expect.
+func openDatabase(cfg *config.Config, autoMigrate bool) (*sql.DB, error) {
+	db, err := database.SetupDatabase(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.TokenKeys == nil {
+		log.Println("Warning: TOKEN_ENCRYPTION_KEYS is not set, OAuth tokens are stored unencrypted.")
+	}
+	database.SetTokenKeys(cfg.TokenKeys)
+
+	if err := prepareSchema(db, autoMigrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// prepareSchema brings the schema up to date before anything uses the database. With autoMigrate off it only checks
+// that no migration is pending, for deployments that run the migrate command themselves. A schema newer than this
+// build is always refused, as the binary cannot know what it would break.
+func prepareSchema(db *sql.DB, autoMigrate bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if autoMigrate {
+		applied, err := database.MigrateUp(ctx, db)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			log.Printf("Applied %d migrations.", applied)
+		}
+		return nil
+	}
+
+	pending, err := database.PendingMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations are pending, starting with %s; run the migrate command first", len(pending), pending[0].Name)
+	}
+	return nil
+}
+
+// shutdownTimeout is how long a stopping server waits for requests in progress, such as a long export, before it
+// cuts them off.
+const shutdownTimeout = 30 * time.Second
+
+// serve runs the API server and the background jobs until SIGINT or SIGTERM. It then stops taking requests, lets
+// the ones in progress and any running job finish, and closes the database.
+func serve(cfg *config.Config) error {
+	if err := cfg.ValidateServer(); err != nil {
+		return err
+	}
+	providers, err := oauth.NewProviders(cfg)
+	if err != nil {
+		return err
+	}
+	m, err := mailer.New(cfg.Mailer)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg, cfg.AutoMigrate)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := database.Close(db); err != nil {
+			log.Printf("error closing database: %s", err.Error())
+		}
+	}()
 
 	log.Println("Database setup complete and ready to use.")
 
+	if err := hashLegacySessions(db); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheduler := jobs.NewScheduler(db)
+	scheduler.Add(
+		jobs.SessionCleanup(db),
+		jobs.TrashPurge(db, cfg.TrashRetention),
+		jobs.TokenRefresh(db, providers),
+	)
+	if cfg.Backup.Dir != "" {
+		scheduler.Add(jobs.Backup(db, cfg.Backup))
+	}
+	scheduler.Start(ctx)
+	defer scheduler.Wait()
+
 	srv := http.Server{
-		Addr:    ":8080",
-		Handler: routes.RegisterRoutes(db),
+		Addr:    cfg.Addr,
+		Handler: routes.RegisterRoutes(db, cfg, providers, m),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", cfg.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stop()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down, waiting for requests in progress.")
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Requests still running after %s were cut off: %s", shutdownTimeout, err.Error())
+		srv.Close()
 	}
 
-	log.Println("Starting server on port 8080")
-	err = srv.ListenAndServe()
+	log.Println("Server stopped.")
+	return nil
+}
+
+// hashLegacySessions moves sessions stored before token hashing over to hashed tokens, so the database never holds
+// a usable cookie value. Once every session is moved it does nothing.
+func hashLegacySessions(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	sessionModel := database.SessionModel{DB: db}
+	moved, err := sessionModel.HashLegacyTokens(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	if moved > 0 {
+		log.Printf("Hashed the tokens of %d sessions.", moved)
+	}
+	return nil
+}
+
+// reencryptTokens seals every OAuth token in the database with the active key, for after encryption is first
+// enabled or the active key is rotated. Old keys must stay configured until it has run.
+func reencryptTokens(cfg *config.Config) error {
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	providerModel := database.ProviderModel{DB: db}
+	updated, err := providerModel.ReencryptTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Re-encrypted the tokens of %d providers.", updated)
+	return nil
 }
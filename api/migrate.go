@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/database"
+)
+
+// migrateCommand runs the migrations embedded in the binary. It opens the database without the schema check the
+// other commands make, as fixing the schema is its job.
+func migrateCommand(cfg *config.Config, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	db, err := database.SetupDatabase(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch action {
+	case "up":
+		applied, err := database.MigrateUp(ctx, db)
+		if err != nil {
+			return err
+		}
+		version, err := database.SchemaVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations, the schema is at version %d.\n", applied, version)
+	case "down":
+		migration, err := database.MigrateDown(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %s.\n", migration.Name)
+	case "status":
+		statuses, err := database.MigrationStatuses(ctx, db)
+		if err != nil {
+			return err
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(out, "APPLIED AT\tMIGRATION")
+		for _, status := range statuses {
+			appliedAt, name := "Pending", status.Name
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if name == "" {
+				name = fmt.Sprintf("%d (unknown to this build)", status.Version)
+			}
+			fmt.Fprintf(out, "%s\t%s\n", appliedAt, name)
+		}
+		return out.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected up, down or status", action)
+	}
+	return nil
+}
@@ -6,42 +6,82 @@ import (
 	"time"
 
 	"github.com/arinji2/vocab-thing/handlers"
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/config"
 	"github.com/arinji2/vocab-thing/internal/httpmiddleware"
+	"github.com/arinji2/vocab-thing/internal/mailer"
+	"github.com/arinji2/vocab-thing/internal/oauth"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func RegisterRoutes(db *sql.DB) http.Handler {
-	handler := handlers.NewHandler(db)
+func RegisterRoutes(db *sql.DB, cfg *config.Config, providers *oauth.Providers, m mailer.Mailer) http.Handler {
+	handler := handlers.NewHandler(db, cfg, providers, m)
 	userHandler := handlers.UserHandler{Handler: handler}
 	phraseHandler := handlers.PhraseHandler{Handler: handler}
 	syncHandler := handlers.SyncHandler{Handler: handler}
+	reviewHandler := handlers.ReviewHandler{Handler: handler}
+	exportHandler := handlers.ExportHandler{Handler: handler}
+	importHandler := handlers.ImportHandler{Handler: handler}
+	tokenHandler := handlers.TokenHandler{Handler: handler}
+	sessionHandler := handlers.SessionHandler{Handler: handler}
+	providerHandler := handlers.ProviderHandler{Handler: handler}
+	mfaHandler := handlers.MFAHandler{Handler: handler}
+	adminHandler := handlers.AdminHandler{Handler: handler}
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.RealIP)
-	r.Use(httpmiddleware.Cors)
+	r.Use(httpmiddleware.Cors(cfg.FrontendURL))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Heartbeat("/ping"))
-	r.Use(middleware.Timeout(60 * time.Second))
 
 	r.Group(func(r chi.Router) {
-		r.Get("/", userHandler.GetAllUsers)
-		r.Post("/user/create", userHandler.CreateUser)
+		r.Use(middleware.Timeout(60 * time.Second))
 		r.Post("/oauth/generate-code-url", userHandler.GenerateCodeURL)
 		r.Post("/oauth/callback", userHandler.CallbackHandler)
+		r.Post("/auth/email/start", userHandler.StartEmailLogin)
+		r.Post("/auth/email/verify", userHandler.VerifyEmailLogin)
+		r.Post("/auth/mfa/verify", mfaHandler.VerifyMFA)
 		r.Post("/user/create/guest", userHandler.CreateGuestUser)
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(httpmiddleware.Authentication(db))
-		r.Get("/user/authenticated", userHandler.AuthenticatedRoute)
+		r.Use(middleware.Timeout(60 * time.Second))
+		r.Use(httpmiddleware.Authentication(db, handler.Cookie))
+		r.With(httpmiddleware.RequireScope(auth.ScopeRead)).Get("/user/authenticated", userHandler.AuthenticatedRoute)
+		r.Route("/user/tokens", func(r chi.Router) {
+			r.Use(httpmiddleware.RequireSession)
+			r.Get("/", tokenHandler.GetTokens)
+			r.Post("/", tokenHandler.CreateToken)
+			r.Delete("/{id}", tokenHandler.DeleteToken)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(httpmiddleware.RequireSession)
+			r.Get("/user/sessions", sessionHandler.GetSessions)
+			r.Delete("/user/sessions/{id}", sessionHandler.DeleteSession)
+			r.Post("/user/logout", sessionHandler.Logout)
+			r.Post("/user/logout-all", sessionHandler.LogoutAll)
+			r.Get("/user/providers", providerHandler.GetProviders)
+			r.Post("/user/providers", providerHandler.LinkProvider)
+			r.Delete("/user/providers/{id}", providerHandler.UnlinkProvider)
+			r.Get("/user/mfa", mfaHandler.GetMFA)
+			r.Post("/user/mfa/enroll", mfaHandler.EnrollMFA)
+			r.Post("/user/mfa/confirm", mfaHandler.ConfirmMFA)
+			r.Post("/user/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+			r.Delete("/user/mfa", mfaHandler.DisableMFA)
+			r.With(httpmiddleware.RequireMFA(db), httpmiddleware.RequireRecentAuth).Delete("/user", userHandler.DeleteAccount)
+		})
 		r.Route("/sync", func(r chi.Router) {
+			r.Use(httpmiddleware.RequireScope(auth.ScopeSync))
 			r.Get("/", syncHandler.GetSync)
 			r.Post("/", syncHandler.ManualSync)
+			r.Get("/changes", syncHandler.GetChanges)
+			r.Post("/push", syncHandler.PushChanges)
 		})
 		r.Route("/phrase", func(r chi.Router) {
+			r.Use(httpmiddleware.RequireReadWriteScope)
 			r.Route("/create", func(r chi.Router) {
 				r.Post("/phrase", phraseHandler.CreatePhrase)
 				r.Post("/tag", phraseHandler.CreateTag)
@@ -49,13 +89,39 @@ func RegisterRoutes(db *sql.DB) http.Handler {
 			r.Get("/{id}", phraseHandler.GetPhraseByID)
 			r.With(httpmiddleware.Paginate).Get("/", phraseHandler.GetAllPhrases)
 			r.With(httpmiddleware.Searching).Get("/search", phraseHandler.SearchPhrases)
+			r.With(httpmiddleware.Paginate).Get("/trash", phraseHandler.GetTrash)
+
+			r.Post("/{id}/restore", phraseHandler.RestorePhrase)
 
 			r.Put("/{id}", phraseHandler.UpdatePhrase)
 			r.Put("/{phraseID}/tag/{tagID}", phraseHandler.UpdateTag)
 
 			r.Delete("/{id}", phraseHandler.DeletePhrase)
+			r.Delete("/{id}/purge", phraseHandler.PurgePhrase)
 			r.Delete("/{phraseID}/tag/{tagID}", phraseHandler.DeleteTag)
 		})
+		r.Route("/review", func(r chi.Router) {
+			r.Use(httpmiddleware.RequireReadWriteScope)
+			r.Get("/due", reviewHandler.GetDue)
+			r.Post("/{phraseID}", reviewHandler.ReviewPhrase)
+		})
+		r.With(httpmiddleware.RequireScope(auth.ScopeWrite)).Post("/import", importHandler.Import)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(httpmiddleware.RequireSession, httpmiddleware.RequireAdmin(db), httpmiddleware.RequireMFA(db))
+			r.With(httpmiddleware.Paginate).Get("/users", adminHandler.ListUsers)
+			r.Get("/users/{id}", adminHandler.GetUser)
+			r.Post("/users/{id}/disable", adminHandler.DisableUser)
+			r.Post("/users/{id}/enable", adminHandler.EnableUser)
+			r.Post("/users/{id}/expire-sessions", adminHandler.ExpireSessions)
+			r.Get("/jobs", adminHandler.ListJobs)
+		})
+	})
+
+	// Streaming routes run for as long as the client reads, so they skip the request timeout.
+	r.Group(func(r chi.Router) {
+		r.Use(httpmiddleware.Authentication(db, handler.Cookie))
+		r.With(httpmiddleware.RequireScope(auth.ScopeRead), httpmiddleware.RequireMFA(db)).Get("/export", exportHandler.Export)
+		r.With(httpmiddleware.RequireSession, httpmiddleware.RequireMFA(db)).Get("/user/data-export", userHandler.ExportData)
 	})
 
 	return r
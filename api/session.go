@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/oauth"
+)
+
+func sessionCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "purge" {
+		return errors.New("expected session purge")
+	}
+	flags := flag.NewFlagSet("session purge", flag.ExitOnError)
+	userRef := flags.String("user", "", "revoke every session of this user instead")
+	flags.Parse(args[1:])
+
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	sessionModel := database.SessionModel{DB: db}
+	if *userRef != "" {
+		user, err := findUser(ctx, db, *userRef)
+		if err != nil {
+			return err
+		}
+		deleted, err := sessionModel.DeleteByUserID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %d sessions of %s.\n", deleted, user.Username)
+		return nil
+	}
+
+	// The same cleanup the hourly job does.
+	sessions, err := sessionModel.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	emailTokenModel := database.EmailTokenModel{DB: db}
+	emailTokens, err := emailTokenModel.DeleteExpired(ctx, time.Now().Add(-oauth.EmailLoginWindow))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d expired sessions and %d expired email login tokens.\n", sessions, emailTokens)
+	return nil
+}
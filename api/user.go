@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arinji2/vocab-thing/internal/auth"
+	"github.com/arinji2/vocab-thing/internal/config"
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/models"
+	"github.com/arinji2/vocab-thing/internal/oauth"
+)
+
+func userCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected user list, create, disable or enable")
+	}
+
+	db, err := openDatabase(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		return listUsers(ctx, db, args[1:])
+	case "create":
+		return createUser(ctx, db, args[1:])
+	case "disable", "enable":
+		if len(args) != 2 {
+			return fmt.Errorf("expected user %s <user>", args[0])
+		}
+		return setUserDisabled(ctx, db, args[1], args[0] == "disable")
+	default:
+		return fmt.Errorf("unknown user action %q, expected list, create, disable or enable", args[0])
+	}
+}
+
+func listUsers(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("user list", flag.ExitOnError)
+	search := flags.String("search", "", "only users whose username or email contains this")
+	page := flags.Int("page", 1, "page to show")
+	pageSize := flags.Int("page-size", 50, "users per page")
+	flags.Parse(args)
+	if *page < 1 || *pageSize < 1 {
+		return errors.New("page and page-size must be at least 1")
+	}
+
+	userModel := database.UserModel{DB: db}
+	users, err := userModel.List(ctx, *page, *pageSize, strings.TrimSpace(*search))
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "ID\tUSERNAME\tEMAIL\tROLE\tDISABLED AT\tCREATED AT")
+	for _, user := range users.Items {
+		disabledAt := "-"
+		if user.DisabledAt != nil {
+			disabledAt = user.DisabledAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n", user.ID, user.Username, user.Email, user.Role, disabledAt, user.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Page %d of %d, %d users.\n", users.Page, users.TotalPages, users.TotalCount)
+	return nil
+}
+
+// createUser adds a user without a provider. They sign in with an email login link, which links the email provider.
+func createUser(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	username := flags.String("username", "", "username of the new user")
+	email := flags.String("email", "", "email address the user signs in with")
+	admin := flags.Bool("admin", false, "give the user the admin role")
+	flags.Parse(args)
+
+	user := models.User{Username: strings.TrimSpace(*username), Email: strings.TrimSpace(*email), Role: auth.RoleUser}
+	if user.Username == "" || user.Email == "" {
+		return errors.New("--username and --email are required")
+	}
+	// Stored the way email sign in looks it up, or the user could never sign in.
+	normalized, err := oauth.NormalizeEmail(user.Email)
+	if err != nil {
+		return fmt.Errorf("invalid email %s", user.Email)
+	}
+	user.Email = normalized
+	if *admin {
+		user.Role = auth.RoleAdmin
+	}
+
+	userModel := database.UserModel{DB: db}
+	_, err = userModel.ByEmail(ctx, user.Email)
+	if err == nil {
+		return fmt.Errorf("a user with email %s already exists", user.Email)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err := userModel.Create(ctx, &user); err != nil {
+		return err
+	}
+	syncModel := database.SyncModel{DB: db}
+	if err := syncModel.CreateSync(ctx, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created user %s with role %s and ID %s.\n", user.Username, user.Role, user.ID)
+	return nil
+}
+
+// setUserDisabled does what the admin endpoints do: disabling a user also expires their sessions.
+func setUserDisabled(ctx context.Context, db *sql.DB, ref string, disabled bool) error {
+	user, err := findUser(ctx, db, ref)
+	if err != nil {
+		return err
+	}
+
+	userModel := database.UserModel{DB: db}
+	if err := userModel.SetDisabled(ctx, user.ID, disabled); err != nil {
+		return err
+	}
+	if !disabled {
+		fmt.Printf("Enabled user %s.\n", user.Username)
+		return nil
+	}
+
+	sessionModel := database.SessionModel{DB: db}
+	expired, err := sessionModel.ExpireByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Disabled user %s and expired %d sessions.\n", user.Username, expired)
+	return nil
+}
+
+// findUser looks a user up by ID, username or email, in that order.
+func findUser(ctx context.Context, db *sql.DB, ref string) (models.User, error) {
+	userModel := database.UserModel{DB: db}
+	if user, err := userModel.ByID(ctx, ref); err == nil {
+		return user, nil
+	}
+	if user, err := userModel.ByUsername(ctx, ref); err == nil {
+		return user, nil
+	}
+	if user, err := userModel.ByEmail(ctx, ref); err == nil {
+		return user, nil
+	}
+	// Emails are stored in lower case, except where lowercasing would have clashed with another user's.
+	if email, err := oauth.NormalizeEmail(ref); err == nil {
+		if user, err := userModel.ByEmail(ctx, email); err == nil {
+			return user, nil
+		}
+	}
+	return models.User{}, fmt.Errorf("no user with ID, username or email %q", ref)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arinji2/vocab-thing/internal/database"
+	"github.com/arinji2/vocab-thing/internal/errorcode"
+	"github.com/arinji2/vocab-thing/internal/models"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.SetupDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to setup database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.MigrateUp(context.Background(), db); err != nil {
+		if strings.Contains(err.Error(), "sqlite_fts5") {
+			t.Skip("Needs the sqlite_fts5 build tag")
+		}
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestCreateUser(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if err := createUser(ctx, db, []string{"--username", "alice", "--email", " Alice@Example.COM "}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	userModel := database.UserModel{DB: db}
+	if _, err := userModel.ByEmail(ctx, "alice@example.com"); err != nil {
+		t.Errorf("Expected the email to be stored the way sign in looks it up: %v", err)
+	}
+	user, err := findUser(ctx, db, "ALICE@example.com")
+	if err != nil || user.Username != "alice" {
+		t.Errorf("Expected to find the user by email in any case, got %+v, %v", user, err)
+	}
+
+	// An email lowercasing would have clashed on is still stored as the provider sent it.
+	legacy := models.User{Username: "legacy", Email: "Legacy@Example.com"}
+	if err := userModel.Create(ctx, &legacy); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user, err := findUser(ctx, db, "Legacy@Example.com"); err != nil || user.ID != legacy.ID {
+		t.Errorf("Expected to find the user by their stored email, got %+v, %v", user, err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"Missing Email", []string{"--username", "bob"}, "required"},
+		{"Invalid Email", []string{"--username", "bob", "--email", "Bob <bob@example.com>"}, "invalid email"},
+		{"Existing Email", []string{"--username", "alice2", "--email", "ALICE@example.com"}, "already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := createUser(ctx, db, tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error about %s, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("Lookup Failure", func(t *testing.T) {
+		broken := newTestDB(t)
+		broken.Close()
+		err := createUser(ctx, broken, []string{"--username", "carol", "--email", "carol@example.com"})
+		if !errors.Is(err, errorcode.ErrScanningRow) {
+			t.Errorf("Expected the lookup error to be returned, got %v", err)
+		}
+	})
+}